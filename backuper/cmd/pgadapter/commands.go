@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/backuper"
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/revision"
+
+	_ "github.com/lib/pq"
+)
+
+// revisionUsage describes optional revision argument of commands.
+const revisionUsage = "Revision is latest (default), latest-verified, a key of the backup or a tag."
+
+func newBackupCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup",
+		Short: "Dump the database and upload the backup with its manifest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runBackup(cmd.Context(), cmd.OutOrStdout(), *s)
+		},
+	}
+}
+
+func newRestoreCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore [revision]",
+		Short: "Download a backup and restore it to the database",
+		Long: "Download a backup and restore it to the database, dropping existing objects first.\n" +
+			"The database must exist. " + revisionUsage,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRestore(cmd.Context(), cmd.OutOrStdout(), *s, revisionArg(args))
+		},
+	}
+}
+
+func newListCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List backups of the database, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runList(cmd.Context(), cmd.OutOrStdout(), *s)
+		},
+	}
+}
+
+func newVerifyCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify [revision]",
+		Short: "Download a backup and check its checksum and that it is readable",
+		Long:  "Download a backup, compare its checksum with the manifest and read it back.\n" + revisionUsage,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerify(cmd.Context(), cmd.OutOrStdout(), *s, revisionArg(args))
+		},
+	}
+}
+
+func newPruneCommand(s *settings) *cobra.Command {
+	var keep int
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the oldest backups of the database, keeping pinned ones",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if keep < 1 {
+				return fmt.Errorf("--keep must be positive, got %d", keep)
+			}
+			return runPrune(cmd.Context(), cmd.OutOrStdout(), *s, keep)
+		},
+	}
+	cmd.Flags().IntVar(&keep, "keep", 0, "number of unpinned backups to keep")
+	_ = cmd.MarkFlagRequired("keep")
+	return cmd
+}
+
+func newInspectCommand(s *settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect [revision]",
+		Short: "Print manifest of a backup",
+		Long:  "Print manifest of a backup.\n" + revisionUsage,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInspect(cmd.Context(), cmd.OutOrStdout(), *s, revisionArg(args))
+		},
+	}
+}
+
+// runBackup dumps database and uploads backup with its manifest like backuper
+// does, without pruning and reporting to core.
+func runBackup(ctx context.Context, out io.Writer, s settings) error {
+	clients, err := pgclient.Find(ctx, s.PgClientDirs)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "pgadapter-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	backupPath := filepath.Join(dir, "backup")
+
+	b := backuper.NewBackuper(s.DbHost, s.DbPort, s.DbUser, s.DbPassword, s.DbName, backupPath, backuper.Options{
+		Dump:    backuper.DumpOptions{Format: s.BackupFormat, Verify: s.VerifyBackup},
+		Clients: clients,
+	})
+	stats, err := b.Backup(ctx, s.Secure)
+	if err != nil {
+		return err
+	}
+
+	createdAt := time.Now()
+	backupKey := backuper.Key(s.DbName, s.BackupFormat, createdAt)
+	newManifest := manifest.New(s.DbName, backupKey, s.BackupFormat, createdAt)
+	newManifest.Standby = stats.Standby
+	newManifest.Tags = s.BackupTags
+	newManifest.Pinned = s.BackupPin
+	newManifest.Verified = stats.Verified
+	backupFile, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer backupFile.Close()
+	checkedManifest, err := newManifest.WithChecksum(backupFile)
+	if err != nil {
+		return err
+	}
+	backupManifest, err := checkedManifest.Marshal()
+	if err != nil { // coverage-ignore
+		return fmt.Errorf("failed to build manifest: %v", err)
+	}
+
+	uploader, err := storage.NewS3Uploader(ctx, s.storageConfig(), storage.UploadOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to initialize s3-client: %v", err)
+	}
+	// Uploads of seekable files start from the beginning.
+	err = uploader.Upload(ctx, s.S3BucketName, backupKey, backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to upload backup: %v", err)
+	}
+	err = uploader.Upload(ctx, s.S3BucketName, manifest.KeyFor(backupKey), bytes.NewReader(backupManifest))
+	if err != nil {
+		return fmt.Errorf("failed to upload manifest: %v", err)
+	}
+	fmt.Fprintf(out, "%s\t%d bytes\tverified: %t\n", backupKey, checkedManifest.Size, stats.Verified)
+	return nil
+}
+
+// runRestore restores backup selected by revision to database.
+func runRestore(ctx context.Context, out io.Writer, s settings, revision string) error {
+	client, err := newestClient(ctx, s)
+	if err != nil {
+		return err
+	}
+	backup, path, cleanup, err := download(ctx, s, revision)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	format, err := formatOf(backup)
+	if err != nil {
+		return err
+	}
+
+	err = backuper.Restore(ctx, client, s.DbHost, s.DbPort, s.DbUser, s.DbPassword, s.DbName, format, path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s restored to %s\n", backup.Key, s.DbName)
+	return nil
+}
+
+// runList prints table of backups of database.
+func runList(ctx context.Context, out io.Writer, s settings) error {
+	reader, err := storage.NewS3Reader(ctx, s.storageConfig())
+	if err != nil {
+		return fmt.Errorf("failed to initialize s3-client: %v", err)
+	}
+	backups, err := reader.List(ctx, s.S3BucketName, s.DbName)
+	if err != nil {
+		return err
+	}
+	return printBackups(out, backups)
+}
+
+// printBackups writes table of backups to out.
+// Time of creation is taken from manifest, or time of upload if there is none.
+func printBackups(out io.Writer, backups []storage.Backup) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tSIZE\tCREATED\tFORMAT\tTAGS\tPINNED\tVERIFIED")
+	for _, backup := range backups {
+		createdAt, tags, pinned, verified := backup.LastModified, "", false, false
+		format, _ := formatOf(backup)
+		if backup.Manifest != nil {
+			if !backup.Manifest.CreatedAt.IsZero() {
+				createdAt = backup.Manifest.CreatedAt
+			}
+			tags = strings.Join(backup.Manifest.Tags, ",")
+			pinned, verified = backup.Manifest.Pinned, backup.Manifest.Verified
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%t\t%t\n", backup.Key, backup.Size,
+			createdAt.UTC().Format(time.RFC3339), format, tags, pinned, verified)
+	}
+	return tw.Flush()
+}
+
+// runVerify checks that backup selected by revision matches checksum in its
+// manifest and can be read back.
+func runVerify(ctx context.Context, out io.Writer, s settings, revision string) error {
+	client, err := newestClient(ctx, s)
+	if err != nil {
+		return err
+	}
+	backup, path, cleanup, err := download(ctx, s, revision)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	format, err := formatOf(backup)
+	if err != nil {
+		return err
+	}
+
+	checksum := "not recorded"
+	if backup.Manifest != nil && backup.Manifest.SHA256 != "" {
+		err = verifyChecksum(*backup.Manifest, path)
+		if err != nil {
+			return err
+		}
+		checksum = "ok"
+	}
+	err = backuper.Verify(ctx, client, format, path)
+	if err != nil {
+		return fmt.Errorf("backup %s is not readable: %v", backup.Key, err)
+	}
+	fmt.Fprintf(out, "%s\tchecksum: %s\treadable: ok\n", backup.Key, checksum)
+	return nil
+}
+
+// verifyChecksum returns error if size or checksum of backup at path differs from m.
+func verifyChecksum(m manifest.Manifest, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer file.Close()
+	actual, err := m.WithChecksum(file)
+	if err != nil {
+		return err
+	}
+	if actual.Size != m.Size || actual.SHA256 != m.SHA256 {
+		return fmt.Errorf("checksum mismatch of %s: manifest has %s of %d bytes, backup has %s of %d bytes",
+			m.BackupKey, m.SHA256, m.Size, actual.SHA256, actual.Size)
+	}
+	return nil
+}
+
+// runPrune deletes oldest unpinned backups of database but keep.
+func runPrune(ctx context.Context, out io.Writer, s settings, keep int) error {
+	cleaner, err := storage.NewS3Cleaner(ctx, s.storageConfig())
+	if err != nil {
+		return fmt.Errorf("failed to initialize s3-client: %v", err)
+	}
+	pruned, err := cleaner.Clean(ctx, s.S3BucketName, s.DbName, keep)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d backups deleted\n", pruned)
+	return nil
+}
+
+// runInspect prints manifest of backup selected by revision.
+func runInspect(ctx context.Context, out io.Writer, s settings, revision string) error {
+	reader, err := storage.NewS3Reader(ctx, s.storageConfig())
+	if err != nil {
+		return fmt.Errorf("failed to initialize s3-client: %v", err)
+	}
+	backup, err := find(ctx, reader, s, revision)
+	if err != nil {
+		return err
+	}
+	if backup.Manifest == nil {
+		return fmt.Errorf("backup %s has no manifest", backup.Key)
+	}
+	data, err := backup.Manifest.Marshal()
+	if err != nil { // coverage-ignore
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// revisionArg returns revision passed as optional argument.
+func revisionArg(args []string) string {
+	if len(args) == 0 {
+		return revision.Latest
+	}
+	return args[0]
+}
+
+// find returns backup of database selected by revision.
+func find(ctx context.Context, reader storage.S3Reader, s settings, revision string) (storage.Backup, error) {
+	backups, err := reader.List(ctx, s.S3BucketName, s.DbName)
+	if err != nil {
+		return storage.Backup{}, err
+	}
+	return resolve(ctx, backups, revision)
+}
+
+// download downloads backup selected by revision to a temporary file.
+// cleanup removes the file.
+func download(ctx context.Context, s settings, revision string) (backup storage.Backup, path string, cleanup func(), err error) {
+	reader, err := storage.NewS3Reader(ctx, s.storageConfig())
+	if err != nil {
+		return storage.Backup{}, "", nil, fmt.Errorf("failed to initialize s3-client: %v", err)
+	}
+	backup, err = find(ctx, reader, s, revision)
+	if err != nil {
+		return storage.Backup{}, "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "pgadapter-")
+	if err != nil {
+		return storage.Backup{}, "", nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	path = filepath.Join(dir, filepath.Base(backup.Key))
+	file, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return storage.Backup{}, "", nil, fmt.Errorf("failed to create backup file: %v", err)
+	}
+	err = reader.Download(ctx, s.S3BucketName, backup.Key, file)
+	closeErr := file.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write backup file: %v", closeErr)
+	}
+	if err != nil {
+		cleanup()
+		return storage.Backup{}, "", nil, err
+	}
+	return backup, path, cleanup, nil
+}
+
+// formatOf returns format of backup recorded in its manifest or,
+// for backups without one, by extension of its key.
+func formatOf(backup storage.Backup) (string, error) {
+	if backup.Manifest != nil && backup.Manifest.Format != "" {
+		return backup.Manifest.Format, nil
+	}
+	format := backuper.FormatOf(backup.Key)
+	if format == "" {
+		return "", fmt.Errorf("unknown format of backup %s", backup.Key)
+	}
+	return format, nil
+}
+
+// newestClient returns the newest installed client tools, whose pg_restore
+// reads archives of all older versions.
+func newestClient(ctx context.Context, s settings) (pgclient.Client, error) {
+	clients, err := pgclient.Find(ctx, s.PgClientDirs)
+	if err != nil {
+		return pgclient.Client{}, err
+	}
+	return clients[len(clients)-1], nil
+}
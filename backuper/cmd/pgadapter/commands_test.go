@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/revision"
+)
+
+func Test_PrintBackups(t *testing.T) {
+	uploaded := time.Date(2025, 1, 2, 0, 0, 5, 0, time.UTC)
+	var out bytes.Buffer
+	require.NoError(t, printBackups(&out, []storage.Backup{
+		{Key: "db/2025-01-02-00-00-00-backup.sql", Size: 20, LastModified: uploaded, Manifest: &manifest.Manifest{
+			CreatedAt: uploaded.Add(-5 * time.Second),
+			Format:    "plain",
+			Tags:      []string{"manual", "pre-migration"},
+			Pinned:    true,
+			Verified:  true,
+		}},
+		{Key: "db/2025-01-01-00-00-00-backup.dump", Size: 10, LastModified: uploaded.Add(-24 * time.Hour)},
+	}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"KEY", "SIZE", "CREATED", "FORMAT", "TAGS", "PINNED", "VERIFIED"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"db/2025-01-02-00-00-00-backup.sql", "20", "2025-01-02T00:00:00Z", "plain", "manual,pre-migration", "true", "true"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"db/2025-01-01-00-00-00-backup.dump", "10", "2025-01-01T00:00:05Z", "custom", "false", "false"}, strings.Fields(lines[2]))
+}
+
+func Test_VerifyChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.dump")
+	require.NoError(t, os.WriteFile(path, []byte("PGDMP"), 0o600))
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	m, err := manifest.Manifest{BackupKey: "db/backup.dump"}.WithChecksum(file)
+	require.NoError(t, err)
+
+	assert.NoError(t, verifyChecksum(m, path))
+	require.NoError(t, os.WriteFile(path, []byte("PGDMP corrupted"), 0o600))
+	assert.ErrorContains(t, verifyChecksum(m, path), "checksum mismatch of db/backup.dump")
+}
+
+func Test_FormatOf(t *testing.T) {
+	format, err := formatOf(storage.Backup{Key: "db/backup.dump", Manifest: &manifest.Manifest{Format: "tar"}})
+	require.NoError(t, err)
+	assert.Equal(t, "tar", format)
+	format, err = formatOf(storage.Backup{Key: "db/backup.dir.tar"})
+	require.NoError(t, err)
+	assert.Equal(t, "directory", format)
+	_, err = formatOf(storage.Backup{Key: "db/backup.zip"})
+	assert.ErrorContains(t, err, "unknown format of backup db/backup.zip")
+}
+
+func Test_RevisionArg(t *testing.T) {
+	assert.Equal(t, revision.Latest, revisionArg(nil))
+	assert.Equal(t, "pre-migration", revisionArg([]string{"pre-migration"}))
+}
@@ -0,0 +1,42 @@
+// Command pgadapter backs up, restores and inspects backups of a PostgreSQL
+// database ad hoc, e.g. against a local database and MinIO, without the
+// operator. Backups are stored the same way backuper stores them.
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	err := newRootCommand().Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCommand returns pgadapter command with all subcommands.
+func newRootCommand() *cobra.Command {
+	var s settings
+	root := &cobra.Command{
+		Use:          "pgadapter",
+		Short:        "Back up, restore and inspect PostgreSQL backups in s3-compatible storage",
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			var err error
+			s, err = loadSettings(cmd.Flags(), os.Environ())
+			return err
+		},
+	}
+	addFlags(root.PersistentFlags())
+	root.AddCommand(
+		newBackupCommand(&s),
+		newRestoreCommand(&s),
+		newListCommand(&s),
+		newVerifyCommand(&s),
+		newPruneCommand(&s),
+		newInspectCommand(&s),
+	)
+	return root
+}
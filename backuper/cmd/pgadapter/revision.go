@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/revision"
+)
+
+// resolve returns backup selected by revision among listed backups, the same
+// way restorer resolves BACKUP_REVISION. See revision.Resolve for accepted values.
+func resolve(ctx context.Context, backups []storage.Backup, rev string) (storage.Backup, error) {
+	listed := make([]revision.Backup, 0, len(backups))
+	byKey := map[string]storage.Backup{}
+	for _, b := range backups {
+		listed = append(listed, revision.Backup{Key: b.Key, LastModified: b.LastModified, HasManifest: b.Manifest != nil})
+		byKey[b.Key] = b
+	}
+	// Manifests are read by List already.
+	key, err := revision.Resolve(ctx, rev, listed, func(_ context.Context, key string) (manifest.Manifest, error) {
+		return *byKey[key].Manifest, nil
+	})
+	if err != nil {
+		return storage.Backup{}, err
+	}
+	return byKey[key], nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/common/revision/revisiontest"
+)
+
+func Test_Resolve(t *testing.T) {
+	backups := []storage.Backup{}
+	for _, b := range revisiontest.Backups {
+		backups = append(backups, storage.Backup{Key: b.Key, LastModified: b.LastModified, Manifest: b.Manifest})
+	}
+
+	for revision, key := range revisiontest.Resolved {
+		backup, err := resolve(context.Background(), backups, revision)
+		require.NoError(t, err, revision)
+		assert.Equal(t, key, backup.Key, revision)
+	}
+	for revision, expected := range revisiontest.Unresolved {
+		_, err := resolve(context.Background(), backups, revision)
+		assert.ErrorContains(t, err, expected, revision)
+	}
+
+	backup, err := resolve(context.Background(), backups, "nightly")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pre-migration", "nightly"}, backup.Manifest.Tags)
+}
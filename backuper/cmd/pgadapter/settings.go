@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+	"github.com/spf13/pflag"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/backuper"
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+)
+
+// configFlag names flag with path of env file settings are read from.
+const configFlag = "config"
+
+// A settings stores configuration of pgadapter. Variables are the same as
+// of backuper, defaults point to a database and MinIO on localhost.
+type settings struct {
+	DbHost     string `env:"DB_HOST" envDefault:"localhost"`
+	DbPort     string `env:"DB_PORT" envDefault:"5432"`
+	DbUser     string `env:"DB_USER" envDefault:"postgres"`
+	DbPassword string `env:"DB_PASSWORD"`
+	DbName     string `env:"DB_NAME"`
+
+	S3Endpoint       string `env:"S3_ENDPOINT" envDefault:"http://localhost:9000"`
+	S3AccessKey      string `env:"S3_ACCESS_KEY"`
+	S3SecretKey      string `env:"S3_SECRET_KEY"`
+	S3BucketName     string `env:"S3_BUCKET_NAME"`
+	S3Region         string `env:"S3_REGION" envDefault:"us-east-1"`
+	S3ForcePathStyle bool   `env:"S3_FORCE_PATH_STYLE" envDefault:"true"`
+	Secure           bool   `env:"SECURE" envDefault:"false"` // TLS/SSL Encryption
+
+	BackupFormat string   `env:"BACKUP_FORMAT" envDefault:"custom"`
+	VerifyBackup bool     `env:"VERIFY_BACKUP" envDefault:"true"`
+	BackupTags   []string `env:"BACKUP_TAGS"`
+	BackupPin    bool     `env:"BACKUP_PIN" envDefault:"false"`
+
+	PgClientDirs []string `env:"PG_CLIENT_DIRS" envDefault:"/usr/lib/postgresql/*/bin,/usr/libexec/postgresql*"`
+}
+
+// An option binds a flag to environment variable of settings.
+type option struct {
+	flag    string
+	env     string
+	usage   string
+	boolean bool
+}
+
+// options lists settings which can be set with flags.
+var options = []option{
+	{flag: "db-host", env: "DB_HOST", usage: "database host (default localhost)"},
+	{flag: "db-port", env: "DB_PORT", usage: "database port (default 5432)"},
+	{flag: "db-user", env: "DB_USER", usage: "database user (default postgres)"},
+	{flag: "db-password", env: "DB_PASSWORD", usage: "database password"},
+	{flag: "db-name", env: "DB_NAME", usage: "database name, also the directory of its backups in bucket"},
+	{flag: "s3-endpoint", env: "S3_ENDPOINT", usage: "s3-api endpoint (default http://localhost:9000)"},
+	{flag: "s3-access-key", env: "S3_ACCESS_KEY", usage: "s3 access key"},
+	{flag: "s3-secret-key", env: "S3_SECRET_KEY", usage: "s3 secret key"},
+	{flag: "s3-bucket", env: "S3_BUCKET_NAME", usage: "bucket backups are stored in"},
+	{flag: "s3-region", env: "S3_REGION", usage: "s3 region (default us-east-1)"},
+	{flag: "secure", env: "SECURE", usage: "use TLS to connect to s3", boolean: true},
+	{flag: "format", env: "BACKUP_FORMAT", usage: "backup format: plain, custom, tar or directory (default custom)"},
+	{flag: "verify", env: "VERIFY_BACKUP", usage: "read back backup before upload (default true)", boolean: true},
+	{flag: "tags", env: "BACKUP_TAGS", usage: "comma-separated tags of backup"},
+	{flag: "pin", env: "BACKUP_PIN", usage: "pin backup, so that prune never deletes it", boolean: true},
+	{flag: "pg-client-dirs", env: "PG_CLIENT_DIRS", usage: "comma-separated glob patterns of directories with client tools"},
+}
+
+// addFlags adds flags of options and configFlag to flags.
+// Flags have no defaults, so that unset ones do not override environment.
+func addFlags(flags *pflag.FlagSet) {
+	flags.String(configFlag, "", "env file with KEY=VALUE lines, overridden by environment and flags")
+	for _, o := range options {
+		if o.boolean {
+			flags.Bool(o.flag, false, o.usage)
+			continue
+		}
+		flags.String(o.flag, "", o.usage)
+	}
+}
+
+// loadSettings reads settings from flags, environ and env file set with
+// configFlag, in order of precedence, and validates them.
+func loadSettings(flags *pflag.FlagSet, environ []string) (settings, error) {
+	environment := map[string]string{}
+	path, err := flags.GetString(configFlag)
+	if err != nil { // coverage-ignore
+		return settings{}, err
+	}
+	if path != "" {
+		fileEnvironment, err := readEnvFile(path)
+		if err != nil {
+			return settings{}, err
+		}
+		maps.Copy(environment, fileEnvironment)
+	}
+	maps.Copy(environment, env.ToMap(environ))
+	for _, o := range options {
+		f := flags.Lookup(o.flag)
+		if f != nil && f.Changed {
+			environment[o.env] = f.Value.String()
+		}
+	}
+
+	s, err := env.ParseAsWithOptions[settings](env.Options{Environment: environment})
+	if err != nil {
+		return settings{}, err
+	}
+	err = s.validate()
+	if err != nil {
+		return settings{}, err
+	}
+	return s, nil
+}
+
+// readEnvFile reads KEY=VALUE lines of env file at path. Blank lines and
+// lines starting with # are skipped, values might be quoted.
+func readEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer file.Close()
+
+	environment := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		environment[key] = value
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	return environment, nil
+}
+
+// validate checks settings every command needs.
+func (s settings) validate() error {
+	if s.DbName == "" {
+		return fmt.Errorf("DB_NAME is required")
+	}
+	if s.S3BucketName == "" {
+		return fmt.Errorf("S3_BUCKET_NAME is required")
+	}
+	if (s.S3AccessKey == "") != (s.S3SecretKey == "") {
+		return fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY must be set together")
+	}
+	err := backuper.ValidateFormat(s.BackupFormat)
+	if err != nil {
+		return fmt.Errorf("BACKUP_FORMAT: %v", err)
+	}
+	err = manifest.ValidateTags(s.BackupTags)
+	if err != nil {
+		return fmt.Errorf("BACKUP_TAGS: %v", err)
+	}
+	return nil
+}
+
+// storageConfig returns parameters to connect to s3-compatible storage.
+func (s settings) storageConfig() s3client.Config {
+	return s3client.Config{
+		Endpoint:       s.S3Endpoint,
+		AccessKey:      s.S3AccessKey,
+		SecretKey:      s.S3SecretKey,
+		Region:         s.S3Region,
+		ForcePathStyle: s.S3ForcePathStyle,
+		Secure:         s.Secure,
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFlags returns flags of pgadapter parsed from args.
+func newFlags(t *testing.T, args ...string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("pgadapter", pflag.ContinueOnError)
+	addFlags(flags)
+	require.NoError(t, flags.Parse(args))
+	return flags
+}
+
+func Test_LoadSettings_Defaults(t *testing.T) {
+	s, err := loadSettings(newFlags(t), []string{"DB_NAME=db", "S3_BUCKET_NAME=bucket"})
+	require.NoError(t, err)
+	assert.Equal(t, settings{
+		DbHost:           "localhost",
+		DbPort:           "5432",
+		DbUser:           "postgres",
+		DbName:           "db",
+		S3Endpoint:       "http://localhost:9000",
+		S3BucketName:     "bucket",
+		S3Region:         "us-east-1",
+		S3ForcePathStyle: true,
+		BackupFormat:     "custom",
+		VerifyBackup:     true,
+		PgClientDirs:     []string{"/usr/lib/postgresql/*/bin", "/usr/libexec/postgresql*"},
+	}, s)
+}
+
+func Test_LoadSettings_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pgadapter.env")
+	require.NoError(t, os.WriteFile(path, []byte(`# local database
+DB_HOST=file-host
+DB_PORT=6543
+export DB_NAME="file-db"
+
+S3_BUCKET_NAME='backups'
+BACKUP_TAGS=nightly
+`), 0o600))
+
+	s, err := loadSettings(newFlags(t, "--config", path, "--db-name", "flag-db", "--tags", "manual,pre-migration", "--pin", "--verify=false"),
+		[]string{"DB_PORT=7654", "DB_NAME=env-db"})
+	require.NoError(t, err)
+	assert.Equal(t, "file-host", s.DbHost)
+	assert.Equal(t, "7654", s.DbPort)
+	assert.Equal(t, "flag-db", s.DbName)
+	assert.Equal(t, "backups", s.S3BucketName)
+	assert.Equal(t, []string{"manual", "pre-migration"}, s.BackupTags)
+	assert.True(t, s.BackupPin)
+	assert.False(t, s.VerifyBackup)
+}
+
+func Test_LoadSettings_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pgadapter.env")
+	require.NoError(t, os.WriteFile(path, []byte("DB_NAME=db\nmalformed\n"), 0o600))
+
+	for name, tc := range map[string]struct {
+		args    []string
+		environ []string
+		err     string
+	}{
+		"missing database":   {environ: []string{"S3_BUCKET_NAME=bucket"}, err: "DB_NAME is required"},
+		"missing bucket":     {environ: []string{"DB_NAME=db"}, err: "S3_BUCKET_NAME is required"},
+		"half credentials":   {args: []string{"--s3-access-key", "key"}, environ: []string{"DB_NAME=db", "S3_BUCKET_NAME=bucket"}, err: "must be set together"},
+		"unknown format":     {args: []string{"--format", "zip"}, environ: []string{"DB_NAME=db", "S3_BUCKET_NAME=bucket"}, err: "BACKUP_FORMAT"},
+		"reserved tag":       {args: []string{"--tags", "latest"}, environ: []string{"DB_NAME=db", "S3_BUCKET_NAME=bucket"}, err: "BACKUP_TAGS"},
+		"malformed file":     {args: []string{"--config", path}, err: "pgadapter.env:2: expected KEY=VALUE"},
+		"missing file":       {args: []string{"--config", path + ".missing"}, err: "failed to open config file"},
+		"malformed variable": {environ: []string{"DB_NAME=db", "S3_BUCKET_NAME=bucket", "SECURE=maybe"}, err: "Secure"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadSettings(newFlags(t, tc.args...), tc.environ)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func Test_StorageConfig(t *testing.T) {
+	s := settings{S3Endpoint: "http://localhost:9000", S3AccessKey: "key", S3SecretKey: "secret", S3Region: "us-east-1", S3ForcePathStyle: true}
+	cc := s.storageConfig()
+	assert.Equal(t, "http://localhost:9000", cc.Endpoint)
+	assert.Equal(t, "key", cc.AccessKey)
+	assert.Equal(t, "secret", cc.SecretKey)
+	assert.True(t, cc.ForcePathStyle)
+	assert.False(t, cc.Secure)
+}
@@ -7,8 +7,15 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/tracing"
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+	"github.com/oiler-backup/postgres-adapter/common/retry"
 )
 
 // An ErrBackup is required for more verbosity.
@@ -20,6 +27,89 @@ func buildBackupError(msg string, opts ...any) ErrBackup {
 	return fmt.Errorf(msg, opts...)
 }
 
+// A Scope limits objects included in a backup.
+// Values are pg_dump patterns, e.g. "tenant_*" or "public.audit_log".
+// Empty Scope means the whole database.
+type Scope struct {
+	Schemas          []string `json:"schemas,omitempty"`          // Dump only matching schemas
+	ExcludeSchemas   []string `json:"excludeSchemas,omitempty"`   // Do not dump matching schemas
+	Tables           []string `json:"tables,omitempty"`           // Dump only matching tables
+	ExcludeTables    []string `json:"excludeTables,omitempty"`    // Do not dump matching tables
+	ExcludeTableData []string `json:"excludeTableData,omitempty"` // Dump definitions but not data of matching tables
+}
+
+// args returns pg_dump arguments applying the scope.
+func (s Scope) args() []string {
+	args := []string{}
+	for _, flag := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"--schema", s.Schemas},
+		{"--exclude-schema", s.ExcludeSchemas},
+		{"--table", s.Tables},
+		{"--exclude-table", s.ExcludeTables},
+		{"--exclude-table-data", s.ExcludeTableData},
+	} {
+		for _, pattern := range flag.patterns {
+			args = append(args, flag.name+"="+pattern)
+		}
+	}
+	return args
+}
+
+// A DumpOptions controls output format of pg_dump and how it waits for locks
+// and long-running statements. Zero values keep defaults of pg_dump and the server.
+type DumpOptions struct {
+	Format                   string        // One of Formats, empty means FormatCustom
+	LockWaitTimeout          time.Duration // Fail instead of waiting longer for a shared lock on a table
+	StatementTimeout         time.Duration // statement_timeout of the pg_dump session
+	IdleInTransactionTimeout time.Duration // idle_in_transaction_session_timeout of the pg_dump session
+	SerializableDeferrable   bool          // Wait for a snapshot free of serialization anomalies
+	Verify                   bool          // Read back backup after dump and fail if it is incomplete
+}
+
+// format returns output format of pg_dump.
+func (o DumpOptions) format() string {
+	if o.Format == "" {
+		return FormatCustom
+	}
+	return o.Format
+}
+
+// args returns pg_dump arguments applying timeouts and isolation.
+func (o DumpOptions) args() []string {
+	args := []string{}
+	if o.LockWaitTimeout > 0 {
+		args = append(args, fmt.Sprintf("--lock-wait-timeout=%d", o.LockWaitTimeout.Milliseconds()))
+	}
+	if o.SerializableDeferrable {
+		args = append(args, "--serializable-deferrable")
+	}
+	return args
+}
+
+// onStandby returns options usable on a hot standby. Serializable transactions
+// cannot run in recovery, so pg_dump fails with --serializable-deferrable there
+// and it is dropped.
+func (o DumpOptions) onStandby() DumpOptions {
+	o.SerializableDeferrable = false
+	return o
+}
+
+// pgOptions returns value of PGOPTIONS setting session timeouts of pg_dump,
+// empty if there are none.
+func (o DumpOptions) pgOptions() string {
+	options := []string{}
+	if o.StatementTimeout > 0 {
+		options = append(options, fmt.Sprintf("-c statement_timeout=%d", o.StatementTimeout.Milliseconds()))
+	}
+	if o.IdleInTransactionTimeout > 0 {
+		options = append(options, fmt.Sprintf("-c idle_in_transaction_session_timeout=%d", o.IdleInTransactionTimeout.Milliseconds()))
+	}
+	return strings.Join(options, " ")
+}
+
 // A Backuper performs backup of PostgreSQL Database.
 type Backuper struct {
 	dbHost string
@@ -29,11 +119,26 @@ type Backuper struct {
 	dbName string
 
 	backupPath string
+	opts       Options
+}
+
+// An Options describes how backup is taken. Zero Options dumps the whole
+// database in FormatCustom with pg_dump in PATH, connecting once.
+type Options struct {
+	Scope   Scope          // Objects included in the backup
+	Dump    DumpOptions    // Format, timeouts and isolation of pg_dump
+	Standby StandbyOptions // Checks of backups taken from a hot standby
+	Retry   retry.Policy   // Retries of connecting to database
+	Hooks   Hooks          // Actions run around dump
+
+	// Installed client tools to choose pg_dump matching the server from,
+	// pg_dump in PATH is used without version check if there are none.
+	Clients []pgclient.Client
 }
 
 // NewBackuper is a constructor for Backuper.
 // Accepts parameters to connect to database and backupPath where backup will be stored locally.
-func NewBackuper(dbHost, dbPort, dbUser, dbPassword, dbName, backupPath string) Backuper {
+func NewBackuper(dbHost, dbPort, dbUser, dbPassword, dbName, backupPath string, opts Options) Backuper {
 	return Backuper{
 		dbHost:     dbHost,
 		dbPort:     dbPort,
@@ -41,18 +146,41 @@ func NewBackuper(dbHost, dbPort, dbUser, dbPassword, dbName, backupPath string)
 		dbPass:     dbPassword,
 		dbName:     dbName,
 		backupPath: backupPath,
+		opts:       opts,
 	}
 }
 
+// A Stats describes a finished backup.
+type Stats struct {
+	Connect      time.Duration // Time spent connecting to database
+	Dump         time.Duration // Time spent in pg_dump
+	DatabaseSize int64         // Size of database in bytes when backup started
+	ServerMajor  int           // Major version of database server
+	ClientMajor  int           // Major version of pg_dump, 0 if its version was not checked
+	Standby      *StandbyState // Replay position if database is a standby, nil otherwise
+	Verified     bool          // Backup was read back successfully after dump
+
+	// --serializable-deferrable was requested but dropped because database is a standby.
+	SerializableDeferrableDropped bool
+}
+
 // Backup performs backup of PostgreSQL Database by using pg_dump CLI.
-func (b Backuper) Backup(ctx context.Context, secure bool) error {
+// Backup is written to backupPath in format of DumpOptions.
+// pg_dump is chosen to match version of the server, backup fails before
+// running any hook if there is no compatible one.
+// If database is a standby, backup fails when replication lags too much,
+// WAL replay is optionally paused while pg_dump runs and
+// DumpOptions.SerializableDeferrable is ignored.
+// Pre-backup hooks are run before dump and post-backup hooks after it.
+// If DumpOptions.Verify is set, backup fails when it cannot be read back.
+func (b Backuper) Backup(ctx context.Context, secure bool) (stats Stats, err error) {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		b.dbHost, b.dbPort, b.dbUser, b.dbPass, b.dbName,
 	)
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil { // coverage-ignore
-		return buildBackupError("Failed to open driver for database: %+v", err)
+		return stats, buildBackupError("Failed to open driver for database: %+v", err)
 	}
 	defer func() {
 		err := db.Close()
@@ -60,9 +188,77 @@ func (b Backuper) Backup(ctx context.Context, secure bool) error {
 			panic(err)
 		}
 	}()
-	err = db.PingContext(ctx)
+	start := time.Now()
+	connectCtx, span := tracing.Start(ctx, "connect")
+	err = retry.Do(connectCtx, b.opts.Retry, retry.IsTransient, db.PingContext)
+	tracing.End(span, err)
+	stats.Connect = time.Since(start)
 	if err != nil { // coverage-ignore
-		return buildBackupError("Failed to connect to database: %+v", err)
+		return stats, buildBackupError("Failed to connect to database: %w", err)
+	}
+	err = db.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&stats.DatabaseSize)
+	if err != nil { // coverage-ignore
+		return stats, buildBackupError("Failed to get database size: %w", err)
+	}
+	client, err := b.selectClient(ctx, db, &stats)
+	if err != nil {
+		return stats, err
+	}
+	stats.Standby, err = standbyState(ctx, db)
+	if err != nil { // coverage-ignore
+		return stats, buildBackupError("Failed to get standby state: %w", err)
+	}
+	err = b.opts.Standby.checkLag(stats.Standby)
+	if err != nil {
+		return stats, err
+	}
+	dump := b.opts.Dump
+	if stats.Standby != nil && dump.SerializableDeferrable {
+		dump = dump.onStandby()
+		stats.SerializableDeferrableDropped = true
+	}
+	if stats.Standby != nil && b.opts.Standby.PauseReplay {
+		var resume func() error
+		resume, err = pauseReplay(ctx, db)
+		if err != nil { // coverage-ignore
+			return stats, buildBackupError("Failed to pause WAL replay: %w", err)
+		}
+		defer func() {
+			resumeErr := resume()
+			if err == nil && resumeErr != nil {
+				err = buildBackupError("Failed to resume WAL replay: %+v", resumeErr)
+			}
+		}()
+		// Position replay is paused at is what the dump contains.
+		paused, stateErr := standbyState(ctx, db)
+		if stateErr == nil && paused != nil {
+			stats.Standby.ReplayLSN = paused.ReplayLSN
+			stats.Standby.ReplayTimestamp = paused.ReplayTimestamp
+		}
+	}
+
+	env := b.hookEnv()
+	defer func() {
+		postErr := b.opts.Hooks.run(ctx, b.opts.Hooks.Post, db, env)
+		if err == nil && postErr != nil {
+			err = buildBackupError("Failed post-backup hook: %+v", postErr)
+		}
+	}()
+	err = b.opts.Hooks.run(ctx, b.opts.Hooks.Pre, db, env)
+	if err != nil {
+		return stats, buildBackupError("Failed pre-backup hook: %+v", err)
+	}
+
+	// Directory output is archived to backupPath after dump.
+	format := b.opts.Dump.format()
+	outputPath := b.backupPath
+	if format == FormatDirectory {
+		outputPath = b.backupPath + ".dir"
+		err = os.RemoveAll(outputPath)
+		if err != nil { // coverage-ignore
+			return stats, buildBackupError("Failed to remove previous dump directory: %+v", err)
+		}
+		defer os.RemoveAll(outputPath)
 	}
 
 	args := []string{
@@ -70,19 +266,72 @@ func (b Backuper) Backup(ctx context.Context, secure bool) error {
 		"-p", b.dbPort,
 		"-U", b.dbUser,
 		"-d", b.dbName,
-		"-F",
-		"c",
-		"-f", b.backupPath,
 	}
+	args = append(args, formatArgs(format, outputPath)...)
+	args = append(args, b.opts.Scope.args()...)
+	args = append(args, dump.args()...)
 
-	dumpCmd := exec.CommandContext(ctx, "pg_dump",
+	dumpCmd := exec.CommandContext(ctx, client.Path("pg_dump"),
 		args...,
 	)
 	dumpCmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", b.dbPass))
+	if pgOptions := b.opts.Dump.pgOptions(); pgOptions != "" {
+		dumpCmd.Env = append(dumpCmd.Env, "PGOPTIONS="+pgOptions)
+	}
 
+	start = time.Now()
+	_, span = tracing.Start(ctx, "pg_dump")
 	output, err := dumpCmd.CombinedOutput()
+	tracing.End(span, err)
+	stats.Dump = time.Since(start)
 	if err != nil { // coverage-ignore
-		return buildBackupError("Failed executing pg_dump: %+v\n.Output:%s", err, string(output))
+		return stats, pgoutput.NewCommandError("pg_dump", err, output)
+	}
+	if b.opts.Dump.Verify {
+		err = Verify(ctx, client, format, outputPath)
+		if err != nil {
+			return stats, buildBackupError("Failed to verify backup: %+v", err)
+		}
+		stats.Verified = true
+	}
+	if format == FormatDirectory {
+		err = archiveDirectory(outputPath, b.backupPath)
+		if err != nil {
+			return stats, buildBackupError("Failed to archive dump directory: %+v", err)
+		}
+	}
+	return stats, nil
+}
+
+// selectClient returns client tools compatible with version of the server
+// and records both versions in stats.
+func (b Backuper) selectClient(ctx context.Context, db *sql.DB, stats *Stats) (pgclient.Client, error) {
+	var versionNum int
+	err := db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&versionNum)
+	if err != nil { // coverage-ignore
+		return pgclient.Client{}, buildBackupError("Failed to get server version: %w", err)
+	}
+	stats.ServerMajor = pgclient.ServerMajor(versionNum)
+	if len(b.opts.Clients) == 0 {
+		return pgclient.Client{}, nil
+	}
+
+	client, err := pgclient.Select(b.opts.Clients, stats.ServerMajor)
+	if err != nil {
+		return pgclient.Client{}, buildBackupError("Failed to choose pg_dump: %w", err)
+	}
+	stats.ClientMajor = client.Major
+	return client, nil
+}
+
+// hookEnv returns libpq environment variables letting hook commands,
+// e.g. psql, connect to the backed up database.
+func (b Backuper) hookEnv() []string {
+	return []string{
+		"PGHOST=" + b.dbHost,
+		"PGPORT=" + b.dbPort,
+		"PGUSER=" + b.dbUser,
+		"PGPASSWORD=" + b.dbPass,
+		"PGDATABASE=" + b.dbName,
 	}
-	return nil
 }
@@ -1,11 +1,14 @@
 package backuper
 
 import (
+	"archive/tar"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -51,9 +54,10 @@ func Test_Backup_CreatesValidDump(t *testing.T) {
 		"testpass",
 		"testdb",
 		backupFile,
+		Options{},
 	)
 
-	err = b.Backup(ctx, false)
+	_, err = b.Backup(ctx, false)
 	require.NoError(t, err)
 
 	fileInfo, err := os.Stat(backupFile)
@@ -67,3 +71,89 @@ func Test_BuildBackup(t *testing.T) {
 	err := buildBackupError(message, option)
 	assert.Equal(t, fmt.Sprintf(message, option), err.Error())
 }
+
+func Test_Scope_Args(t *testing.T) {
+	assert.Empty(t, Scope{}.args())
+
+	scope := Scope{
+		Schemas:          []string{"tenant_a", "tenant_b"},
+		ExcludeSchemas:   []string{"tmp"},
+		Tables:           []string{"public.orders"},
+		ExcludeTables:    []string{"public.cache_*"},
+		ExcludeTableData: []string{"public.audit_log"},
+	}
+	assert.Equal(t, []string{
+		"--schema=tenant_a",
+		"--schema=tenant_b",
+		"--exclude-schema=tmp",
+		"--table=public.orders",
+		"--exclude-table=public.cache_*",
+		"--exclude-table-data=public.audit_log",
+	}, scope.args())
+}
+
+func Test_DumpOptions(t *testing.T) {
+	assert.Empty(t, DumpOptions{}.args())
+	assert.Empty(t, DumpOptions{}.pgOptions())
+
+	options := DumpOptions{
+		LockWaitTimeout:          30 * time.Second,
+		StatementTimeout:         time.Hour,
+		IdleInTransactionTimeout: 10 * time.Minute,
+		SerializableDeferrable:   true,
+	}
+	assert.Equal(t, []string{"--lock-wait-timeout=30000", "--serializable-deferrable"}, options.args())
+	assert.Equal(t, "-c statement_timeout=3600000 -c idle_in_transaction_session_timeout=600000", options.pgOptions())
+	assert.Equal(t, []string{"--lock-wait-timeout=30000"}, options.onStandby().args())
+}
+
+func Test_StandbyOptions_CheckLag(t *testing.T) {
+	options := StandbyOptions{MaxLag: time.Minute}
+	assert.NoError(t, options.checkLag(nil))
+	assert.NoError(t, options.checkLag(&StandbyState{Lag: time.Minute}))
+	assert.ErrorContains(t, options.checkLag(&StandbyState{Lag: 90 * time.Second}), "Replication lag 1m30s exceeds maximum 1m0s")
+	assert.NoError(t, StandbyOptions{}.checkLag(&StandbyState{Lag: time.Hour}))
+}
+
+func Test_FormatArgs(t *testing.T) {
+	assert.Equal(t, []string{"-F", "c", "-f", "backup"}, formatArgs(FormatCustom, "backup"))
+	assert.Equal(t, []string{"-F", "p", "-f", "backup", "--clean", "--if-exists"}, formatArgs(FormatPlain, "backup"))
+	assert.Equal(t, FormatCustom, DumpOptions{}.format())
+	assert.Equal(t, ".dir.tar", Extension(FormatDirectory))
+	assert.ErrorContains(t, ValidateFormat("zip"), "unknown backup format")
+	assert.Equal(t, FormatDirectory, FormatOf("db/2025-01-01-00-00-00-backup.dir.tar"))
+	assert.Equal(t, FormatTar, FormatOf("db/2025-01-01-00-00-00-backup.tar"))
+	assert.Equal(t, "", FormatOf("db/backup.zip"))
+	assert.Equal(t, "db/2025-01-02-03-04-05-backup.sql", Key("db", FormatPlain, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
+
+func Test_ArchiveDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dump")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "toc.dat"), []byte("toc"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "3001.dat.gz"), []byte("data"), 0o644))
+
+	path := filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, archiveDirectory(dir, path))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	names := []string{}
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+	}
+	assert.ElementsMatch(t, []string{"toc.dat", "3001.dat.gz"}, names)
+
+	extracted := filepath.Join(t.TempDir(), "extracted")
+	require.NoError(t, extractDirectory(path, extracted))
+	data, err := os.ReadFile(filepath.Join(extracted, "3001.dat.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
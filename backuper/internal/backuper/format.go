@@ -0,0 +1,191 @@
+package backuper
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Output formats of pg_dump.
+const (
+	FormatPlain     = "plain"     // SQL script restored with psql
+	FormatCustom    = "custom"    // Compressed archive restored with pg_restore
+	FormatTar       = "tar"       // Tar archive restored with pg_restore
+	FormatDirectory = "directory" // Directory of compressed files, uploaded as a tar archive of it
+)
+
+// Formats lists supported output formats.
+var Formats = []string{FormatPlain, FormatCustom, FormatTar, FormatDirectory}
+
+// formatFlags maps output formats to values of pg_dump --format flag.
+var formatFlags = map[string]string{
+	FormatPlain:     "p",
+	FormatCustom:    "c",
+	FormatTar:       "t",
+	FormatDirectory: "d",
+}
+
+// extensions maps output formats to extensions of uploaded files.
+var extensions = map[string]string{
+	FormatPlain:     ".sql",
+	FormatCustom:    ".dump",
+	FormatTar:       ".tar",
+	FormatDirectory: ".dir.tar",
+}
+
+// ValidateFormat returns error if format is not one of Formats.
+func ValidateFormat(format string) error {
+	if !slices.Contains(Formats, format) {
+		return fmt.Errorf("unknown backup format %q, expected one of %v", format, Formats)
+	}
+	return nil
+}
+
+// Extension returns extension of uploaded backups in format, e.g. ".dump".
+func Extension(format string) string {
+	return extensions[format]
+}
+
+// FormatOf returns format of uploaded backup by extension of its key,
+// empty if extension is unknown.
+func FormatOf(key string) string {
+	format := ""
+	for _, f := range Formats {
+		// .dir.tar ends with .tar, the longest extension wins.
+		if strings.HasSuffix(key, extensions[f]) && len(extensions[f]) > len(extensions[format]) {
+			format = f
+		}
+	}
+	return format
+}
+
+// Key returns key backup of database in format created at createdAt is uploaded under,
+// e.g. db/2025-01-01-00-00-00-backup.dump.
+func Key(database, format string, createdAt time.Time) string {
+	return fmt.Sprintf("%s/%s-backup%s", database, createdAt.Format("2006-01-02-15-04-05"), Extension(format))
+}
+
+// formatArgs returns pg_dump arguments writing backup in format to path.
+// Plain scripts drop existing objects before creating them, as psql cannot
+// do it on restore like pg_restore --clean.
+func formatArgs(format, path string) []string {
+	args := []string{"-F", formatFlags[format], "-f", path}
+	if format == FormatPlain {
+		args = append(args, "--clean", "--if-exists")
+	}
+	return args
+}
+
+// archiveDirectory writes files of pg_dump output directory dir to a tar
+// archive at path, so that it can be uploaded as a single object.
+func archiveDirectory(dir, path string) (err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read dump directory: %v", err)
+	}
+	archive, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %v", err)
+	}
+	defer func() {
+		closeErr := archive.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close archive: %v", closeErr)
+		}
+	}()
+
+	tw := tar.NewWriter(archive)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		err = addFile(tw, filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %v", entry.Name(), err)
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+	return nil
+}
+
+// addFile writes file at path to tw under its base name.
+func addFile(tw *tar.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// extractDirectory extracts tar archive of pg_dump directory output at path to dir.
+func extractDirectory(path, dir string) error {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return fmt.Errorf("failed to remove previous directory: %v", err)
+	}
+	err = os.Mkdir(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %v", err)
+		}
+		// archiveDirectory writes regular files under their base names only.
+		name := filepath.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || name != header.Name {
+			continue
+		}
+		err = extractFile(tr, filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %v", name, err)
+		}
+	}
+}
+
+// extractFile writes contents of r to a new file at path.
+func extractFile(r io.Reader, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
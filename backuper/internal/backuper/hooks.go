@@ -0,0 +1,148 @@
+package backuper
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Failure policies of hooks.
+const (
+	// OnFailureAbort fails the backup. A failed pre-backup hook prevents dump.
+	OnFailureAbort = "abort"
+	// OnFailureContinue ignores failure of a hook.
+	OnFailureContinue = "continue"
+)
+
+// A Hook is an action run before or after dump: a SQL statement executed
+// over connection of Backuper or a command run in the container.
+type Hook struct {
+	Name      string        // Used in errors and logs
+	SQL       string        // Statement executed on the backed up database, e.g. CHECKPOINT
+	Exec      []string      // Command with arguments. PGHOST, PGPORT, PGUSER, PGPASSWORD and PGDATABASE are set
+	Timeout   time.Duration // Zero leaves hook limited by the backup context only
+	OnFailure string        // OnFailureAbort or OnFailureContinue. Empty means OnFailureAbort
+}
+
+// UnmarshalJSON decodes hook, e.g. {"name": "checkpoint", "sql": "CHECKPOINT", "timeout": "30s"}.
+func (h *Hook) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name      string   `json:"name"`
+		SQL       string   `json:"sql"`
+		Exec      []string `json:"exec"`
+		Timeout   string   `json:"timeout"`
+		OnFailure string   `json:"onFailure"`
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	*h = Hook{Name: raw.Name, SQL: raw.SQL, Exec: raw.Exec, OnFailure: raw.OnFailure}
+	if raw.Timeout != "" {
+		h.Timeout, err = time.ParseDuration(raw.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout of hook %q: %v", raw.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that hook has exactly one action and a known failure policy.
+func (h Hook) Validate() error {
+	if (h.SQL == "") == (len(h.Exec) == 0) {
+		return fmt.Errorf("hook %q must have either sql or exec", h.Name)
+	}
+	switch h.OnFailure {
+	case "", OnFailureAbort, OnFailureContinue:
+	default:
+		return fmt.Errorf("unknown onFailure %q of hook %q, expected %s or %s", h.OnFailure, h.Name, OnFailureAbort, OnFailureContinue)
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("timeout of hook %q must not be negative", h.Name)
+	}
+	return nil
+}
+
+// A HookList is a list of hooks decoded from JSON array.
+type HookList []Hook
+
+// UnmarshalText decodes hooks from JSON array, so that HookList can be read from environment.
+func (l *HookList) UnmarshalText(text []byte) error {
+	var hooks []Hook
+	err := json.Unmarshal(text, &hooks)
+	if err != nil {
+		return fmt.Errorf("failed to parse hooks: %v", err)
+	}
+	*l = hooks
+	return nil
+}
+
+// A Hooks lists actions run around dump.
+//
+// Post hooks run whenever pre hooks were started, even if dump or a pre hook
+// failed, so that they can undo actions of pre hooks, e.g. resume a paused consumer.
+type Hooks struct {
+	Pre  HookList
+	Post HookList
+
+	// Notify, if set, is called on failures of hooks with OnFailureContinue.
+	Notify func(hook Hook, err error)
+}
+
+// Validate checks all hooks.
+func (h Hooks) Validate() error {
+	for _, hook := range append(append(HookList{}, h.Pre...), h.Post...) {
+		err := hook.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run runs hooks one by one. It stops on the first failed hook with OnFailureAbort.
+func (h Hooks) run(ctx context.Context, hooks HookList, db *sql.DB, env []string) error {
+	for _, hook := range hooks {
+		err := hook.run(ctx, db, env)
+		if err == nil {
+			continue
+		}
+		if hook.OnFailure != OnFailureContinue {
+			return err
+		}
+		if h.Notify != nil {
+			h.Notify(hook, err)
+		}
+	}
+	return nil
+}
+
+// run executes hook within its timeout.
+func (h Hook) run(ctx context.Context, db *sql.DB, env []string) error {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	if h.SQL != "" {
+		_, err := db.ExecContext(ctx, h.SQL)
+		if err != nil {
+			return fmt.Errorf("hook %q failed: %v", h.Name, err)
+		}
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, h.Exec[0], h.Exec[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hook %q failed: %v\n.Output:%s", h.Name, err, string(output))
+	}
+	return nil
+}
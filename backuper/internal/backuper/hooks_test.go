@@ -0,0 +1,88 @@
+package backuper
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HookList_UnmarshalText(t *testing.T) {
+	var hooks HookList
+	err := hooks.UnmarshalText([]byte(`[
+		{"name": "checkpoint", "sql": "CHECKPOINT", "timeout": "1m"},
+		{"name": "pause", "exec": ["sh", "-c", "echo pause"], "onFailure": "continue"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, HookList{
+		{Name: "checkpoint", SQL: "CHECKPOINT", Timeout: time.Minute},
+		{Name: "pause", Exec: []string{"sh", "-c", "echo pause"}, OnFailure: OnFailureContinue},
+	}, hooks)
+
+	err = hooks.UnmarshalText([]byte(`{"name": "checkpoint"}`))
+	require.ErrorContains(t, err, "failed to parse hooks")
+
+	var hook Hook
+	err = json.Unmarshal([]byte(`{"name": "checkpoint", "sql": "CHECKPOINT", "timeout": "soon"}`), &hook)
+	require.ErrorContains(t, err, `invalid timeout of hook "checkpoint"`)
+}
+
+func Test_Hook_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    Hook
+		wantErr string
+	}{
+		{"SQL", Hook{Name: "h", SQL: "CHECKPOINT"}, ""},
+		{"Exec", Hook{Name: "h", Exec: []string{"true"}, OnFailure: OnFailureContinue}, ""},
+		{"NoAction", Hook{Name: "h"}, "must have either sql or exec"},
+		{"BothActions", Hook{Name: "h", SQL: "CHECKPOINT", Exec: []string{"true"}}, "must have either sql or exec"},
+		{"UnknownOnFailure", Hook{Name: "h", SQL: "CHECKPOINT", OnFailure: "retry"}, "unknown onFailure"},
+		{"NegativeTimeout", Hook{Name: "h", SQL: "CHECKPOINT", Timeout: -time.Second}, "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hook.Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_Hooks_Run(t *testing.T) {
+	ctx := context.Background()
+	failed := []string{}
+	hooks := Hooks{Notify: func(hook Hook, err error) {
+		failed = append(failed, hook.Name)
+	}}
+
+	err := hooks.run(ctx, HookList{
+		{Name: "ignored", Exec: []string{"false"}, OnFailure: OnFailureContinue},
+		{Name: "env", Exec: []string{"sh", "-c", `test "$PGDATABASE" = mydb`}},
+	}, nil, []string{"PGDATABASE=mydb"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ignored"}, failed)
+
+	err = hooks.run(ctx, HookList{
+		{Name: "abort", Exec: []string{"sh", "-c", "echo broken; exit 1"}},
+		{Name: "skipped", Exec: []string{"false"}, OnFailure: OnFailureContinue},
+	}, nil, nil)
+	require.ErrorContains(t, err, `hook "abort" failed`)
+	require.ErrorContains(t, err, "broken")
+	assert.Equal(t, []string{"ignored"}, failed)
+}
+
+func Test_Hook_Run_Timeout(t *testing.T) {
+	hook := Hook{Name: "slow", Exec: []string{"sleep", "10"}, Timeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	err := hook.run(context.Background(), nil, nil)
+	require.ErrorContains(t, err, `hook "slow" failed`)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
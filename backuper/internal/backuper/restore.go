@@ -0,0 +1,57 @@
+package backuper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+)
+
+// Restore applies backup in format at path to dbName, e.g. to try a backup
+// out locally. Plain scripts are applied with psql of client and stop on the
+// first error, archives are restored with pg_restore of client dropping
+// existing objects first. Directory output is expected as uploaded, a tar
+// archive of the directory.
+//
+// Unlike restorer it neither creates the database nor checks it is empty.
+func Restore(ctx context.Context, client pgclient.Client, dbHost, dbPort, dbUser, dbPassword, dbName, format, path string) error {
+	if format == FormatDirectory {
+		dir := path + ".dir"
+		defer os.RemoveAll(dir)
+		err := extractDirectory(path, dir)
+		if err != nil {
+			return err
+		}
+		path = dir
+	}
+
+	program := "pg_restore"
+	if format == FormatPlain {
+		program = "psql"
+	}
+	cmd := exec.CommandContext(ctx, client.Path(program), restoreArgs(dbHost, dbPort, dbUser, dbName, format, path)...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", dbPassword))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return pgoutput.NewCommandError(program, err, output)
+	}
+	return nil
+}
+
+// restoreArgs returns arguments of psql applying plain script at path
+// or of pg_restore restoring archive at path.
+func restoreArgs(dbHost, dbPort, dbUser, dbName, format, path string) []string {
+	args := []string{
+		"-h", dbHost,
+		"-p", dbPort,
+		"-U", dbUser,
+		"-d", dbName,
+	}
+	if format == FormatPlain {
+		return append(args, "--no-psqlrc", "-v", "ON_ERROR_STOP=1", "-f", path)
+	}
+	return append(args, "--no-owner", "--clean", "--if-exists", "--exit-on-error", path)
+}
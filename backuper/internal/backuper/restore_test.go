@@ -0,0 +1,56 @@
+package backuper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+)
+
+func Test_RestoreArgs(t *testing.T) {
+	assert.Equal(t, []string{"-h", "host", "-p", "5432", "-U", "user", "-d", "db", "--no-psqlrc", "-v", "ON_ERROR_STOP=1", "-f", "backup.sql"},
+		restoreArgs("host", "5432", "user", "db", FormatPlain, "backup.sql"))
+	assert.Equal(t, []string{"-h", "host", "-p", "5432", "-U", "user", "-d", "db", "--no-owner", "--clean", "--if-exists", "--exit-on-error", "backup.dump"},
+		restoreArgs("host", "5432", "user", "db", FormatCustom, "backup.dump"))
+}
+
+func Test_Restore(t *testing.T) {
+	binDir := t.TempDir()
+	calls := filepath.Join(t.TempDir(), "calls")
+	for _, program := range []string{"psql", "pg_restore"} {
+		script := "#!/bin/sh\necho \"" + program + " $PGPASSWORD $*\" >> " + calls + "\n[ -e \"$(eval echo \\${$#})\" ] || { echo '" + program + ": error: missing input'; exit 1; }\n"
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, program), []byte(script), 0o755))
+	}
+	client := pgclient.Client{Major: 16, BinDir: binDir}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "backup.sql")
+	require.NoError(t, os.WriteFile(script, []byte("SELECT 1;"), 0o600))
+	dumpDir := filepath.Join(dir, "dump")
+	require.NoError(t, os.Mkdir(dumpDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dumpDir, "toc.dat"), []byte("toc"), 0o644))
+	archive := filepath.Join(dir, "backup.dir.tar")
+	require.NoError(t, archiveDirectory(dumpDir, archive))
+
+	require.NoError(t, Restore(context.Background(), client, "host", "5432", "user", "secret", "db", FormatPlain, script))
+	require.NoError(t, Restore(context.Background(), client, "host", "5432", "user", "secret", "db", FormatDirectory, archive))
+	err := Restore(context.Background(), client, "host", "5432", "user", "secret", "db", FormatCustom, filepath.Join(dir, "missing.dump"))
+	var cmdErr *pgoutput.CommandError
+	require.ErrorAs(t, err, &cmdErr)
+	assert.Equal(t, "pg_restore", cmdErr.Program)
+
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "psql secret "))
+	assert.True(t, strings.HasSuffix(lines[1], " "+archive+".dir"))
+	assert.NoDirExists(t, archive+".dir")
+}
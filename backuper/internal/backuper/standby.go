@@ -0,0 +1,71 @@
+package backuper
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+)
+
+// A StandbyOptions controls backups taken from a hot standby.
+// Options have no effect if the server is not in recovery.
+type StandbyOptions struct {
+	MaxLag      time.Duration // Fail if replay lags behind primary more, zero disables the check
+	PauseReplay bool          // Pause WAL replay while pg_dump runs
+}
+
+// A StandbyState describes replay position of a standby a backup was taken from.
+// It is recorded in manifest as is.
+type StandbyState = manifest.Standby
+
+// standbyState returns replay position of db or nil if it is not in recovery.
+// Lag is zero if all received WAL is replayed, so that an idle primary
+// does not look lagging.
+func standbyState(ctx context.Context, db *sql.DB) (*StandbyState, error) {
+	var inRecovery bool
+	err := db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery)
+	if err != nil {
+		return nil, err
+	}
+	if !inRecovery {
+		return nil, nil
+	}
+
+	var (
+		state           StandbyState
+		replayTimestamp sql.NullTime
+		lagSeconds      float64
+	)
+	err = db.QueryRowContext(ctx, `SELECT pg_last_wal_replay_lsn()::text, pg_last_xact_replay_timestamp(),
+		CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`,
+	).Scan(&state.ReplayLSN, &replayTimestamp, &lagSeconds)
+	if err != nil {
+		return nil, err
+	}
+	state.ReplayTimestamp = replayTimestamp.Time.UTC()
+	state.Lag = time.Duration(lagSeconds * float64(time.Second))
+	return &state, nil
+}
+
+// checkLag returns error if lag of state exceeds MaxLag.
+func (o StandbyOptions) checkLag(state *StandbyState) error {
+	if state == nil || o.MaxLag <= 0 || state.Lag <= o.MaxLag {
+		return nil
+	}
+	return buildBackupError("Replication lag %s exceeds maximum %s", state.Lag.Round(time.Millisecond), o.MaxLag)
+}
+
+// pauseReplay pauses WAL replay of db and returns function resuming it.
+func pauseReplay(ctx context.Context, db *sql.DB) (func() error, error) {
+	_, err := db.ExecContext(ctx, "SELECT pg_wal_replay_pause()")
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		// Replay is resumed even if the backup was cancelled.
+		_, err := db.ExecContext(context.WithoutCancel(ctx), "SELECT pg_wal_replay_resume()")
+		return err
+	}, nil
+}
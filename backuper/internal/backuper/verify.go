@@ -0,0 +1,71 @@
+package backuper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+)
+
+// plainTrailer ends plain scripts written completely by pg_dump.
+const plainTrailer = "-- PostgreSQL database dump complete"
+
+// Verify reads back backup in format at path to check it is complete.
+// Archives are listed with pg_restore of client, plain scripts are checked
+// for the trailer pg_dump writes last. Directory output is either the
+// directory itself or, as uploaded, a tar archive of it.
+func Verify(ctx context.Context, client pgclient.Client, format, path string) error {
+	if format == FormatPlain {
+		return verifyPlain(path)
+	}
+	if format == FormatDirectory {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat backup: %v", err)
+		}
+		if info.Mode().IsRegular() {
+			dir := path + ".dir"
+			defer os.RemoveAll(dir)
+			err = extractDirectory(path, dir)
+			if err != nil {
+				return err
+			}
+			path = dir
+		}
+	}
+	cmd := exec.CommandContext(ctx, client.Path("pg_restore"), "--list", path)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to list archive: %v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// verifyPlain checks that plain script at path ends with plainTrailer.
+func verifyPlain(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open script: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat script: %v", err)
+	}
+
+	// Trailer is followed only by a few blank lines.
+	tailSize := min(info.Size(), int64(len(plainTrailer)+64))
+	tail := make([]byte, tailSize)
+	_, err = file.ReadAt(tail, info.Size()-tailSize)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read script: %v", err)
+	}
+	if !bytes.Contains(tail, []byte(plainTrailer)) {
+		return fmt.Errorf("script is truncated")
+	}
+	return nil
+}
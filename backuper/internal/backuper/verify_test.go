@@ -0,0 +1,58 @@
+package backuper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+)
+
+func Test_VerifyPlain(t *testing.T) {
+	dir := t.TempDir()
+	complete := filepath.Join(dir, "complete.sql")
+	require.NoError(t, os.WriteFile(complete, []byte("CREATE TABLE t ();\n\n--\n"+plainTrailer+"\n--\n\n"), 0o600))
+	truncated := filepath.Join(dir, "truncated.sql")
+	require.NoError(t, os.WriteFile(truncated, []byte("CREATE TABLE t ();\nCOPY t"), 0o600))
+
+	assert.NoError(t, Verify(context.Background(), pgclient.Client{}, FormatPlain, complete))
+	assert.ErrorContains(t, Verify(context.Background(), pgclient.Client{}, FormatPlain, truncated), "script is truncated")
+	assert.ErrorContains(t, Verify(context.Background(), pgclient.Client{}, FormatPlain, filepath.Join(dir, "missing")), "failed to open script")
+}
+
+func Test_VerifyArchive(t *testing.T) {
+	binDir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = --list ] && grep -q PGDMP \"$2\" || { echo 'pg_restore: error: input file does not appear to be a valid archive'; exit 1; }\n"
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "pg_restore"), []byte(script), 0o755))
+	client := pgclient.Client{Major: 16, BinDir: binDir}
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.dump")
+	require.NoError(t, os.WriteFile(valid, []byte("PGDMP"), 0o600))
+	invalid := filepath.Join(dir, "invalid.dump")
+	require.NoError(t, os.WriteFile(invalid, []byte("garbage"), 0o600))
+
+	assert.NoError(t, Verify(context.Background(), client, FormatCustom, valid))
+	assert.ErrorContains(t, Verify(context.Background(), client, FormatCustom, invalid), "does not appear to be a valid archive")
+}
+
+func Test_VerifyDirectoryArchive(t *testing.T) {
+	binDir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = --list ] && [ -f \"$2/toc.dat\" ] || { echo 'pg_restore: error: directory does not appear to be a valid archive'; exit 1; }\n"
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "pg_restore"), []byte(script), 0o755))
+	client := pgclient.Client{Major: 16, BinDir: binDir}
+
+	dumpDir := filepath.Join(t.TempDir(), "dump")
+	require.NoError(t, os.Mkdir(dumpDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dumpDir, "toc.dat"), []byte("toc"), 0o644))
+	archive := filepath.Join(t.TempDir(), "backup.dir.tar")
+	require.NoError(t, archiveDirectory(dumpDir, archive))
+
+	assert.NoError(t, Verify(context.Background(), client, FormatDirectory, dumpDir))
+	assert.NoError(t, Verify(context.Background(), client, FormatDirectory, archive))
+	assert.NoDirExists(t, archive+".dir")
+}
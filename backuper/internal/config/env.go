@@ -2,9 +2,17 @@
 package config
 
 import (
+	"cmp"
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v11"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/backuper"
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
 )
 
 // A Config stores configuraton.
@@ -16,12 +24,97 @@ type Config struct {
 	DbName       string `env:"DB_NAME,required,notEmpty"`
 	CoreAddr     string `env:"CORE_ADDR,required,notEmpty"` // Uri of an Kubernetes Operator core
 	S3Endpoint   string `env:"S3_ENDPOINT,required,notEmpty"`
-	S3AccessKey  string `env:"S3_ACCESS_KEY,required,notEmpty,unset"`
-	S3SecretKey  string `env:"S3_SECRET_KEY,required,notEmpty,unset"`
+	S3AccessKey  string `env:"S3_ACCESS_KEY,unset"` // Default AWS credential chain is used if empty
+	S3SecretKey  string `env:"S3_SECRET_KEY,unset"`
 	S3BucketName string `env:"S3_BUCKET_NAME,required,notEmpty"`
 
 	MaxBackupCount int  `env:"MAX_BACKUP_COUNT"`
 	Secure         bool `env:"SECURE" envDefault:"false"` // TLS/SSL Encryption
+
+	// Comma-separated pg_dump patterns limiting backup scope.
+	BackupSchemas          []string `env:"BACKUP_SCHEMAS"`
+	BackupExcludeSchemas   []string `env:"BACKUP_EXCLUDE_SCHEMAS"`
+	BackupTables           []string `env:"BACKUP_TABLES"`
+	BackupExcludeTables    []string `env:"BACKUP_EXCLUDE_TABLES"`
+	BackupExcludeTableData []string `env:"BACKUP_EXCLUDE_TABLE_DATA"`
+
+	// Output format of pg_dump: plain, custom, tar or directory.
+	BackupFormat string `env:"BACKUP_FORMAT" envDefault:"custom"`
+	// Read back backup after dump and fail if it is incomplete.
+	VerifyBackup bool `env:"VERIFY_BACKUP" envDefault:"true"`
+
+	// Comma-separated tags backup can be restored by, e.g. pre-migration-v42.
+	BackupTags []string `env:"BACKUP_TAGS"`
+	BackupPin  bool     `env:"BACKUP_PIN" envDefault:"false"` // Pinned backups are never deleted by retention
+
+	// Timeouts and isolation of pg_dump. Zero durations keep defaults of pg_dump and the server.
+	PgDumpLockWaitTimeout          time.Duration `env:"PG_DUMP_LOCK_WAIT_TIMEOUT"`
+	PgDumpStatementTimeout         time.Duration `env:"PG_DUMP_STATEMENT_TIMEOUT"`
+	PgDumpIdleInTransactionTimeout time.Duration `env:"PG_DUMP_IDLE_IN_TRANSACTION_TIMEOUT"`
+	PgDumpSerializableDeferrable   bool          `env:"PG_DUMP_SERIALIZABLE_DEFERRABLE" envDefault:"false"`
+
+	// Hot standby backup is taken from instead of DbHost, e.g. to offload dumps from primary.
+	// StandbyPort defaults to DbPort. Credentials and database are shared with DbHost.
+	StandbyHost string `env:"STANDBY_HOST"`
+	StandbyPort string `env:"STANDBY_PORT"`
+	// Checked whenever backed up database is in recovery.
+	StandbyMaxLag      time.Duration `env:"STANDBY_MAX_LAG"` // Zero disables the check
+	StandbyPauseReplay bool          `env:"STANDBY_PAUSE_REPLAY" envDefault:"false"`
+
+	// Comma-separated glob patterns of directories with installed client tools.
+	// pg_dump matching version of the server is chosen among them, pg_dump in PATH is used if none is found.
+	PgClientDirs []string `env:"PG_CLIENT_DIRS" envDefault:"/usr/lib/postgresql/*/bin,/usr/libexec/postgresql*"`
+
+	// Retries of connecting to database, uploads and reporting to core.
+	// Delay between attempts doubles from RetryInitialBackoff up to RetryMaxBackoff.
+	RetryAttempts       int           `env:"RETRY_ATTEMPTS" envDefault:"3"` // 1 disables retries
+	RetryInitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF" envDefault:"1s"`
+	RetryMaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF" envDefault:"30s"`
+	RetryJitter         float64       `env:"RETRY_JITTER" envDefault:"0.2"` // Fraction of delay randomized
+
+	// JSON arrays of hooks run around dump, e.g. [{"name": "checkpoint", "sql": "CHECKPOINT"}].
+	PreBackupHooks  backuper.HookList `env:"PRE_BACKUP_HOOKS"`
+	PostBackupHooks backuper.HookList `env:"POST_BACKUP_HOOKS"`
+
+	// Prometheus Pushgateway receiving detailed backup metrics. Pushing is disabled if empty.
+	PushgatewayURL string `env:"PUSHGATEWAY_URL"`
+	PushgatewayJob string `env:"PUSHGATEWAY_JOB" envDefault:"oiler_backuper"`
+
+	// OTLP/gRPC endpoint traces are exported to. Tracing is disabled if empty.
+	OtlpEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// W3C trace context of scheduler request which created CronJob.
+	TraceParent string `env:"TRACEPARENT"`
+	TraceState  string `env:"TRACESTATE"`
+
+	S3Region             string `env:"S3_REGION" envDefault:"us-east-1"`
+	S3ForcePathStyle     bool   `env:"S3_FORCE_PATH_STYLE" envDefault:"true"`
+	S3CAFile             string `env:"S3_CA_FILE"` // PEM-encoded CA bundle
+	S3InsecureSkipVerify bool   `env:"S3_INSECURE_SKIP_VERIFY" envDefault:"false"`
+	S3StorageClass       string `env:"S3_STORAGE_CLASS"`
+	S3SSE                string `env:"S3_SSE"` // Server-side encryption: AES256 or aws:kms
+	S3SSEKMSKeyID        string `env:"S3_SSE_KMS_KEY_ID"`
+
+	S3RoleARN              string `env:"S3_ROLE_ARN"` // Role assumed with web identity if static keys are not set
+	S3WebIdentityTokenFile string `env:"S3_WEB_IDENTITY_TOKEN_FILE"`
+	S3RoleSessionName      string `env:"S3_ROLE_SESSION_NAME" envDefault:"oiler-backuper"`
+
+	// Secondary s3-compatible storage. Replication is disabled unless ReplicaS3Endpoint is set.
+	ReplicaS3Endpoint     string `env:"REPLICA_S3_ENDPOINT"`
+	ReplicaS3AccessKey    string `env:"REPLICA_S3_ACCESS_KEY,unset"`
+	ReplicaS3SecretKey    string `env:"REPLICA_S3_SECRET_KEY,unset"`
+	ReplicaS3BucketName   string `env:"REPLICA_S3_BUCKET_NAME"`
+	ReplicaS3Region       string `env:"REPLICA_S3_REGION" envDefault:"us-east-1"`
+	ReplicaMaxBackupCount int    `env:"REPLICA_MAX_BACKUP_COUNT"`
+	ReplicaSecure         bool   `env:"REPLICA_SECURE" envDefault:"false"` // TLS/SSL Encryption
+	ReplicaS3CAFile       string `env:"REPLICA_S3_CA_FILE"`                // PEM-encoded CA bundle
+	ReplicaSSEKMSKeyID    string `env:"REPLICA_SSE_KMS_KEY_ID"`            // KMS key of the replica, its default key if empty
+
+	// Options of the secondary storage falling back to the primary's ones if unset.
+	ReplicaS3ForcePathStyle       *bool  `env:"REPLICA_S3_FORCE_PATH_STYLE"`
+	ReplicaS3InsecureSkipVerify   *bool  `env:"REPLICA_S3_INSECURE_SKIP_VERIFY"`
+	ReplicaS3RoleARN              string `env:"REPLICA_S3_ROLE_ARN"`
+	ReplicaS3WebIdentityTokenFile string `env:"REPLICA_S3_WEB_IDENTITY_TOKEN_FILE"`
+	ReplicaS3RoleSessionName      string `env:"REPLICA_S3_ROLE_SESSION_NAME"`
 }
 
 // GetConfig reads environment variables, validates them and return Config object or
@@ -32,14 +125,267 @@ func GetConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	err = cfg.validate()
+	if err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
 
+// validate checks dependencies between optional variables.
+func (c Config) validate() error {
+	switch c.S3SSE {
+	case "", "AES256", "aws:kms":
+	default:
+		return fmt.Errorf("S3_SSE must be either AES256 or aws:kms, got %q", c.S3SSE)
+	}
+	if c.S3SSEKMSKeyID != "" && c.S3SSE != "aws:kms" {
+		return fmt.Errorf("S3_SSE_KMS_KEY_ID requires S3_SSE to be aws:kms")
+	}
+
+	if (c.S3AccessKey == "") != (c.S3SecretKey == "") {
+		return fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY must be set together")
+	}
+	if c.S3RoleARN != "" && c.S3WebIdentityTokenFile == "" {
+		return fmt.Errorf("S3_WEB_IDENTITY_TOKEN_FILE is required when S3_ROLE_ARN is set")
+	}
+
+	err := backuper.ValidateFormat(c.BackupFormat)
+	if err != nil {
+		return err
+	}
+	err = manifest.ValidateTags(c.BackupTags)
+	if err != nil {
+		return fmt.Errorf("BACKUP_TAGS: %v", err)
+	}
+	for name, timeout := range map[string]time.Duration{
+		"PG_DUMP_LOCK_WAIT_TIMEOUT":           c.PgDumpLockWaitTimeout,
+		"PG_DUMP_STATEMENT_TIMEOUT":           c.PgDumpStatementTimeout,
+		"PG_DUMP_IDLE_IN_TRANSACTION_TIMEOUT": c.PgDumpIdleInTransactionTimeout,
+		"STANDBY_MAX_LAG":                     c.StandbyMaxLag,
+	} {
+		if timeout < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", name, timeout)
+		}
+	}
+
+	err = c.RetryPolicy().Validate()
+	if err != nil {
+		return err
+	}
+	err = c.BackupHooks().Validate()
+	if err != nil {
+		return err
+	}
+
+	if c.ReplicationEnabled() {
+		if c.ReplicaS3BucketName == "" {
+			return fmt.Errorf("REPLICA_S3_BUCKET_NAME is required when REPLICA_S3_ENDPOINT is set")
+		}
+		if (c.ReplicaS3AccessKey == "") != (c.ReplicaS3SecretKey == "") {
+			return fmt.Errorf("REPLICA_S3_ACCESS_KEY and REPLICA_S3_SECRET_KEY must be set together")
+		}
+		if c.ReplicaSSEKMSKeyID != "" && c.S3SSE != "aws:kms" {
+			return fmt.Errorf("REPLICA_SSE_KMS_KEY_ID requires S3_SSE to be aws:kms")
+		}
+		replica := c.ReplicaStorageConfig()
+		if replica.RoleARN != "" && replica.WebIdentityTokenFile == "" {
+			return fmt.Errorf("REPLICA_S3_WEB_IDENTITY_TOKEN_FILE is required when REPLICA_S3_ROLE_ARN is set")
+		}
+	}
+
+	return nil
+}
+
+// StorageConfig returns parameters to connect to the primary storage.
+func (c Config) StorageConfig() s3client.Config {
+	return s3client.Config{
+		Endpoint:             c.S3Endpoint,
+		AccessKey:            c.S3AccessKey,
+		SecretKey:            c.S3SecretKey,
+		RoleARN:              c.S3RoleARN,
+		WebIdentityTokenFile: c.S3WebIdentityTokenFile,
+		RoleSessionName:      c.S3RoleSessionName,
+		Region:               c.S3Region,
+		ForcePathStyle:       c.S3ForcePathStyle,
+		CAFile:               c.S3CAFile,
+		InsecureSkipVerify:   c.S3InsecureSkipVerify,
+		Secure:               c.Secure,
+	}
+}
+
+// ReplicaStorageConfig returns parameters to connect to the secondary storage.
+// Addressing, certificate verification and role options fall back to the
+// primary storage ones if unset, CA bundle does not.
+// Role is assumed only if replica keys are not set.
+func (c Config) ReplicaStorageConfig() s3client.Config {
+	cc := s3client.Config{
+		Endpoint:             c.ReplicaS3Endpoint,
+		AccessKey:            c.ReplicaS3AccessKey,
+		SecretKey:            c.ReplicaS3SecretKey,
+		RoleARN:              cmp.Or(c.ReplicaS3RoleARN, c.S3RoleARN),
+		WebIdentityTokenFile: cmp.Or(c.ReplicaS3WebIdentityTokenFile, c.S3WebIdentityTokenFile),
+		RoleSessionName:      cmp.Or(c.ReplicaS3RoleSessionName, c.S3RoleSessionName),
+		Region:               c.ReplicaS3Region,
+		ForcePathStyle:       c.S3ForcePathStyle,
+		CAFile:               c.ReplicaS3CAFile,
+		InsecureSkipVerify:   c.S3InsecureSkipVerify,
+		Secure:               c.ReplicaSecure,
+	}
+	if c.ReplicaS3ForcePathStyle != nil {
+		cc.ForcePathStyle = *c.ReplicaS3ForcePathStyle
+	}
+	if c.ReplicaS3InsecureSkipVerify != nil {
+		cc.InsecureSkipVerify = *c.ReplicaS3InsecureSkipVerify
+	}
+	return cc
+}
+
+// UploadOptions returns options applied to uploaded backups.
+func (c Config) UploadOptions() storage.UploadOptions {
+	return storage.UploadOptions{
+		StorageClass: c.S3StorageClass,
+		SSE:          c.S3SSE,
+		SSEKMSKeyID:  c.S3SSEKMSKeyID,
+		Retry:        c.RetryPolicy(),
+	}
+}
+
+// ReplicaUploadOptions returns options applied to backups uploaded to the
+// secondary storage. KMS keys are not shared between storages, so the key
+// of the primary one is never used.
+func (c Config) ReplicaUploadOptions() storage.UploadOptions {
+	opts := c.UploadOptions()
+	opts.SSEKMSKeyID = c.ReplicaSSEKMSKeyID
+	return opts
+}
+
+// RetryPolicy returns policy of retrying operations failed with transient errors.
+func (c Config) RetryPolicy() retry.Policy {
+	return retry.Policy{
+		Attempts:       c.RetryAttempts,
+		InitialBackoff: c.RetryInitialBackoff,
+		MaxBackoff:     c.RetryMaxBackoff,
+		Jitter:         c.RetryJitter,
+	}
+}
+
+// BackupScope returns objects included in backup.
+func (c Config) BackupScope() backuper.Scope {
+	return backuper.Scope{
+		Schemas:          c.BackupSchemas,
+		ExcludeSchemas:   c.BackupExcludeSchemas,
+		Tables:           c.BackupTables,
+		ExcludeTables:    c.BackupExcludeTables,
+		ExcludeTableData: c.BackupExcludeTableData,
+	}
+}
+
+// DumpOptions returns output format, timeouts and isolation of pg_dump
+// and whether backup is verified after dump.
+func (c Config) DumpOptions() backuper.DumpOptions {
+	return backuper.DumpOptions{
+		Format:                   c.BackupFormat,
+		LockWaitTimeout:          c.PgDumpLockWaitTimeout,
+		StatementTimeout:         c.PgDumpStatementTimeout,
+		IdleInTransactionTimeout: c.PgDumpIdleInTransactionTimeout,
+		SerializableDeferrable:   c.PgDumpSerializableDeferrable,
+		Verify:                   c.VerifyBackup,
+	}
+}
+
+// StandbyOptions returns options of backups taken from a hot standby.
+func (c Config) StandbyOptions() backuper.StandbyOptions {
+	return backuper.StandbyOptions{
+		MaxLag:      c.StandbyMaxLag,
+		PauseReplay: c.StandbyPauseReplay,
+	}
+}
+
+// DumpHost returns host and port backup is taken from: the standby if set, DbHost otherwise.
+func (c Config) DumpHost() (string, string) {
+	if c.StandbyHost == "" {
+		return c.DbHost, c.DbPort
+	}
+	if c.StandbyPort == "" {
+		return c.StandbyHost, c.DbPort
+	}
+	return c.StandbyHost, c.StandbyPort
+}
+
+// BackupHooks returns hooks run around dump.
+func (c Config) BackupHooks() backuper.Hooks {
+	return backuper.Hooks{
+		Pre:  c.PreBackupHooks,
+		Post: c.PostBackupHooks,
+	}
+}
+
+// MetricsPushEnabled reports whether backup metrics should be pushed to Pushgateway.
+func (c Config) MetricsPushEnabled() bool {
+	return c.PushgatewayURL != ""
+}
+
+// ReplicationEnabled reports whether backups should be copied to a secondary storage.
+func (c Config) ReplicationEnabled() bool {
+	return c.ReplicaS3Endpoint != ""
+}
+
 func (c Config) String() string {
+	replica := c.ReplicaStorageConfig()
 	return fmt.Sprintf("{DbHost: %s, DbPort: %s, DbUser: %s, DbPassword: <unset>, DbName: %s, "+
 		"CoreAddr: %s, S3Endpoint: %s, S3AccessKey: <unset>, S3SecretKey: <unset>, S3BucketName: %s, "+
-		"MaxBackupCount: %d, Secure: %t}",
+		"MaxBackupCount: %d, Secure: %t, "+
+		"BackupSchemas: %v, BackupExcludeSchemas: %v, BackupTables: %v, BackupExcludeTables: %v, "+
+		"BackupExcludeTableData: %v, "+
+		"BackupFormat: %s, VerifyBackup: %t, BackupTags: %v, BackupPin: %t, "+
+		"PgDumpLockWaitTimeout: %s, PgDumpStatementTimeout: %s, PgDumpIdleInTransactionTimeout: %s, "+
+		"PgDumpSerializableDeferrable: %t, "+
+		"StandbyHost: %s, StandbyPort: %s, StandbyMaxLag: %s, StandbyPauseReplay: %t, "+
+		"PgClientDirs: %v, "+
+		"RetryAttempts: %d, RetryInitialBackoff: %s, RetryMaxBackoff: %s, RetryJitter: %v, "+
+		"PreBackupHooks: %v, PostBackupHooks: %v, "+
+		"PushgatewayURL: %s, PushgatewayJob: %s, "+
+		"OtlpEndpoint: %s, TraceParent: %s, TraceState: %s, "+
+		"S3Region: %s, S3ForcePathStyle: %t, S3CAFile: %s, S3InsecureSkipVerify: %t, "+
+		"S3StorageClass: %s, S3SSE: %s, S3SSEKMSKeyID: %s, "+
+		"S3RoleARN: %s, S3WebIdentityTokenFile: %s, S3RoleSessionName: %s, "+
+		"ReplicaS3Endpoint: %s, ReplicaS3AccessKey: <unset>, ReplicaS3SecretKey: <unset>, ReplicaS3BucketName: %s, "+
+		"ReplicaS3Region: %s, ReplicaMaxBackupCount: %d, ReplicaSecure: %t, "+
+		"ReplicaS3CAFile: %s, ReplicaSSEKMSKeyID: %s, "+
+		"ReplicaS3ForcePathStyle: %t, ReplicaS3InsecureSkipVerify: %t, "+
+		"ReplicaS3RoleARN: %s, ReplicaS3WebIdentityTokenFile: %s, ReplicaS3RoleSessionName: %s}",
 		c.DbHost, c.DbPort, c.DbUser, c.DbName,
 		c.CoreAddr, c.S3Endpoint, c.S3BucketName,
-		c.MaxBackupCount, c.Secure)
+		c.MaxBackupCount, c.Secure,
+		c.BackupSchemas, c.BackupExcludeSchemas, c.BackupTables, c.BackupExcludeTables,
+		c.BackupExcludeTableData,
+		c.BackupFormat, c.VerifyBackup, c.BackupTags, c.BackupPin,
+		c.PgDumpLockWaitTimeout, c.PgDumpStatementTimeout, c.PgDumpIdleInTransactionTimeout,
+		c.PgDumpSerializableDeferrable,
+		c.StandbyHost, c.StandbyPort, c.StandbyMaxLag, c.StandbyPauseReplay,
+		c.PgClientDirs,
+		c.RetryAttempts, c.RetryInitialBackoff, c.RetryMaxBackoff, c.RetryJitter,
+		hookNames(c.PreBackupHooks), hookNames(c.PostBackupHooks),
+		c.PushgatewayURL, c.PushgatewayJob,
+		c.OtlpEndpoint, c.TraceParent, c.TraceState,
+		c.S3Region, c.S3ForcePathStyle, c.S3CAFile, c.S3InsecureSkipVerify,
+		c.S3StorageClass, c.S3SSE, c.S3SSEKMSKeyID,
+		c.S3RoleARN, c.S3WebIdentityTokenFile, c.S3RoleSessionName,
+		c.ReplicaS3Endpoint, c.ReplicaS3BucketName,
+		c.ReplicaS3Region, c.ReplicaMaxBackupCount, c.ReplicaSecure,
+		c.ReplicaS3CAFile, c.ReplicaSSEKMSKeyID,
+		replica.ForcePathStyle, replica.InsecureSkipVerify,
+		replica.RoleARN, replica.WebIdentityTokenFile, replica.RoleSessionName)
+}
+
+// hookNames returns names of hooks. Statements and commands are not printed
+// as they may contain credentials.
+func hookNames(hooks backuper.HookList) []string {
+	names := make([]string, 0, len(hooks))
+	for _, hook := range hooks {
+		names = append(names, hook.Name)
+	}
+	return names
 }
@@ -3,9 +3,15 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/backuper"
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
 )
 
 func Test_GetConfig_Success(t *testing.T) {
@@ -38,6 +44,22 @@ func Test_GetConfig_Success(t *testing.T) {
 		S3BucketName:   "backup-bucket",
 		MaxBackupCount: 5,
 		Secure:         true,
+
+		BackupFormat: "custom",
+		VerifyBackup: true,
+		PgClientDirs: []string{"/usr/lib/postgresql/*/bin", "/usr/libexec/postgresql*"},
+
+		RetryAttempts:       3,
+		RetryInitialBackoff: time.Second,
+		RetryMaxBackoff:     30 * time.Second,
+		RetryJitter:         0.2,
+
+		PushgatewayJob: "oiler_backuper",
+
+		S3Region:          "us-east-1",
+		S3ForcePathStyle:  true,
+		S3RoleSessionName: "oiler-backuper",
+		ReplicaS3Region:   "us-east-1",
 	}
 
 	assert.Equal(t, expected, cfg)
@@ -95,6 +117,8 @@ func Test_GetConfig_DefaultValues(t *testing.T) {
 
 	assert.Equal(t, 0, cfg.MaxBackupCount)
 	assert.False(t, cfg.Secure)
+	assert.False(t, cfg.ReplicationEnabled())
+	assert.False(t, cfg.MetricsPushEnabled())
 }
 
 func Test_String(t *testing.T) {
@@ -116,7 +140,604 @@ func Test_String(t *testing.T) {
 
 	expected := "{DbHost: localhost, DbPort: 5432, DbUser: user, DbPassword: <unset>, " +
 		"DbName: mydb, CoreAddr: http://core:8080, S3Endpoint: s3.example.com, S3AccessKey: <unset>, " +
-		"S3SecretKey: <unset>, S3BucketName: backup-bucket, MaxBackupCount: 5, Secure: true}"
+		"S3SecretKey: <unset>, S3BucketName: backup-bucket, MaxBackupCount: 5, Secure: true, " +
+		"BackupSchemas: [], BackupExcludeSchemas: [], BackupTables: [], BackupExcludeTables: [], " +
+		"BackupExcludeTableData: [], " +
+		"BackupFormat: custom, VerifyBackup: true, BackupTags: [], BackupPin: false, " +
+		"PgDumpLockWaitTimeout: 0s, PgDumpStatementTimeout: 0s, PgDumpIdleInTransactionTimeout: 0s, " +
+		"PgDumpSerializableDeferrable: false, " +
+		"StandbyHost: , StandbyPort: , StandbyMaxLag: 0s, StandbyPauseReplay: false, " +
+		"PgClientDirs: [/usr/lib/postgresql/*/bin /usr/libexec/postgresql*], " +
+		"RetryAttempts: 3, RetryInitialBackoff: 1s, RetryMaxBackoff: 30s, RetryJitter: 0.2, " +
+		"PreBackupHooks: [], PostBackupHooks: [], " +
+		"PushgatewayURL: , PushgatewayJob: oiler_backuper, " +
+		"OtlpEndpoint: , TraceParent: , TraceState: , " +
+		"S3Region: us-east-1, S3ForcePathStyle: true, S3CAFile: , S3InsecureSkipVerify: false, " +
+		"S3StorageClass: , S3SSE: , S3SSEKMSKeyID: , " +
+		"S3RoleARN: , S3WebIdentityTokenFile: , S3RoleSessionName: oiler-backuper, " +
+		"ReplicaS3Endpoint: , ReplicaS3AccessKey: <unset>, ReplicaS3SecretKey: <unset>, ReplicaS3BucketName: , " +
+		"ReplicaS3Region: us-east-1, ReplicaMaxBackupCount: 0, ReplicaSecure: false, " +
+		"ReplicaS3CAFile: , ReplicaSSEKMSKeyID: , " +
+		"ReplicaS3ForcePathStyle: true, ReplicaS3InsecureSkipVerify: false, " +
+		"ReplicaS3RoleARN: , ReplicaS3WebIdentityTokenFile: , ReplicaS3RoleSessionName: oiler-backuper}"
 	assert.Equal(t, expected, cfg.String())
 
 }
+
+func Test_GetConfig_Replica(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_ACCESS_KEY", "replica_access_key")
+	t.Setenv("REPLICA_S3_SECRET_KEY", "replica_secret_key")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+	t.Setenv("REPLICA_MAX_BACKUP_COUNT", "10")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.True(t, cfg.ReplicationEnabled())
+	assert.Equal(t, "dr.example.com", cfg.ReplicaS3Endpoint)
+	assert.Equal(t, "replica_access_key", cfg.ReplicaS3AccessKey)
+	assert.Equal(t, "replica_secret_key", cfg.ReplicaS3SecretKey)
+	assert.Equal(t, "dr-bucket", cfg.ReplicaS3BucketName)
+	assert.Equal(t, 10, cfg.ReplicaMaxBackupCount)
+	assert.False(t, cfg.ReplicaSecure)
+	assert.Equal(t, "dr.example.com", cfg.ReplicaStorageConfig().Endpoint)
+	assert.Equal(t, "dr-bucket", cfg.ReplicaS3BucketName)
+}
+
+func Test_GetConfig_ReplicaMissingBucket(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_ACCESS_KEY", "replica_access_key")
+	t.Setenv("REPLICA_S3_SECRET_KEY", "replica_secret_key")
+
+	_, err := GetConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REPLICA_S3_BUCKET_NAME")
+}
+
+func Test_GetConfig_S3Options(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "https://s3.eu-central-1.amazonaws.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("SECURE", "true")
+	t.Setenv("S3_REGION", "eu-central-1")
+	t.Setenv("S3_FORCE_PATH_STYLE", "false")
+	t.Setenv("S3_CA_FILE", "/etc/ssl/minio/ca.pem")
+	t.Setenv("S3_INSECURE_SKIP_VERIFY", "true")
+	t.Setenv("S3_STORAGE_CLASS", "STANDARD_IA")
+	t.Setenv("S3_SSE", "aws:kms")
+	t.Setenv("S3_SSE_KMS_KEY_ID", "key-id")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, s3client.Config{
+		Endpoint:           "https://s3.eu-central-1.amazonaws.com",
+		AccessKey:          "access_key",
+		SecretKey:          "secret_key",
+		RoleSessionName:    "oiler-backuper",
+		Region:             "eu-central-1",
+		ForcePathStyle:     false,
+		CAFile:             "/etc/ssl/minio/ca.pem",
+		InsecureSkipVerify: true,
+		Secure:             true,
+	}, cfg.StorageConfig())
+	assert.Equal(t, storage.UploadOptions{
+		StorageClass: "STANDARD_IA",
+		SSE:          "aws:kms",
+		SSEKMSKeyID:  "key-id",
+		Retry: retry.Policy{
+			Attempts:       3,
+			InitialBackoff: time.Second,
+			MaxBackoff:     30 * time.Second,
+			Jitter:         0.2,
+		},
+	}, cfg.UploadOptions())
+}
+
+func Test_GetConfig_InvalidSSE(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("S3_SSE", "rot13")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "S3_SSE")
+}
+
+func Test_GetConfig_KMSKeyWithoutKMS(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("S3_SSE", "AES256")
+	t.Setenv("S3_SSE_KMS_KEY_ID", "key-id")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "S3_SSE_KMS_KEY_ID")
+}
+
+func Test_GetConfig_WebIdentity(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("S3_ROLE_ARN", "arn:aws:iam::123456789012:role/backuper")
+	t.Setenv("S3_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	t.Setenv("S3_ROLE_SESSION_NAME", "nightly")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	cc := cfg.StorageConfig()
+	assert.Empty(t, cc.AccessKey)
+	assert.Empty(t, cc.SecretKey)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/backuper", cc.RoleARN)
+	assert.Equal(t, "/var/run/secrets/eks.amazonaws.com/serviceaccount/token", cc.WebIdentityTokenFile)
+	assert.Equal(t, "nightly", cc.RoleSessionName)
+}
+
+func Test_GetConfig_RoleWithoutToken(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("S3_ROLE_ARN", "arn:aws:iam::123456789012:role/backuper")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "S3_WEB_IDENTITY_TOKEN_FILE")
+}
+
+func Test_GetConfig_PartialStaticKeys(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "S3_ACCESS_KEY and S3_SECRET_KEY")
+}
+
+func Test_GetConfig_BackupScope(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_SCHEMAS", "tenant_a,tenant_b")
+	t.Setenv("BACKUP_EXCLUDE_TABLES", "public.cache_*")
+	t.Setenv("BACKUP_EXCLUDE_TABLE_DATA", "public.audit_log")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, backuper.Scope{
+		Schemas:          []string{"tenant_a", "tenant_b"},
+		ExcludeTables:    []string{"public.cache_*"},
+		ExcludeTableData: []string{"public.audit_log"},
+	}, cfg.BackupScope())
+}
+
+func Test_GetConfig_Retry(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("RETRY_ATTEMPTS", "5")
+	t.Setenv("RETRY_INITIAL_BACKOFF", "2s")
+	t.Setenv("RETRY_MAX_BACKOFF", "1m")
+	t.Setenv("RETRY_JITTER", "0")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, retry.Policy{Attempts: 5, InitialBackoff: 2 * time.Second, MaxBackoff: time.Minute}, cfg.RetryPolicy())
+}
+
+func Test_GetConfig_InvalidRetry(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("RETRY_INITIAL_BACKOFF", "1m")
+	t.Setenv("RETRY_MAX_BACKOFF", "1s")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "exceeds maximum")
+}
+
+func Test_GetConfig_Hooks(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("PRE_BACKUP_HOOKS", `[{"name": "checkpoint", "sql": "CHECKPOINT", "timeout": "30s"}]`)
+	t.Setenv("POST_BACKUP_HOOKS", `[{"name": "notify", "exec": ["curl", "-X", "POST", "http://hook"], "onFailure": "continue"}]`)
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, backuper.Hooks{
+		Pre:  backuper.HookList{{Name: "checkpoint", SQL: "CHECKPOINT", Timeout: 30 * time.Second}},
+		Post: backuper.HookList{{Name: "notify", Exec: []string{"curl", "-X", "POST", "http://hook"}, OnFailure: backuper.OnFailureContinue}},
+	}, cfg.BackupHooks())
+	assert.Contains(t, cfg.String(), "PreBackupHooks: [checkpoint], PostBackupHooks: [notify]")
+}
+
+func Test_GetConfig_InvalidHooks(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("PRE_BACKUP_HOOKS", `[{"name": "both", "sql": "CHECKPOINT", "exec": ["true"]}]`)
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "must have either sql or exec")
+}
+
+func Test_GetConfig_DumpOptions(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("PG_DUMP_LOCK_WAIT_TIMEOUT", "30s")
+	t.Setenv("PG_DUMP_STATEMENT_TIMEOUT", "2h")
+	t.Setenv("PG_DUMP_IDLE_IN_TRANSACTION_TIMEOUT", "10m")
+	t.Setenv("PG_DUMP_SERIALIZABLE_DEFERRABLE", "true")
+	t.Setenv("BACKUP_FORMAT", "directory")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, backuper.DumpOptions{
+		Format:                   backuper.FormatDirectory,
+		LockWaitTimeout:          30 * time.Second,
+		StatementTimeout:         2 * time.Hour,
+		IdleInTransactionTimeout: 10 * time.Minute,
+		SerializableDeferrable:   true,
+		Verify:                   true,
+	}, cfg.DumpOptions())
+}
+
+func Test_GetConfig_NegativeDumpTimeout(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("PG_DUMP_LOCK_WAIT_TIMEOUT", "-1s")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "PG_DUMP_LOCK_WAIT_TIMEOUT must not be negative")
+}
+
+func Test_GetConfig_InvalidFormat(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_FORMAT", "zip")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, `unknown backup format "zip"`)
+}
+
+func Test_GetConfig_Tags(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_TAGS", "pre-migration-v42,release-1.2")
+	t.Setenv("BACKUP_PIN", "true")
+	t.Setenv("VERIFY_BACKUP", "false")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pre-migration-v42", "release-1.2"}, cfg.BackupTags)
+	assert.True(t, cfg.BackupPin)
+	assert.False(t, cfg.DumpOptions().Verify)
+
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("BACKUP_TAGS", "latest")
+	_, err = GetConfig()
+	require.ErrorContains(t, err, `BACKUP_TAGS: tag "latest" is reserved`)
+}
+
+func Test_GetConfig_Standby(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	host, port := cfg.DumpHost()
+	assert.Equal(t, "localhost", host)
+	assert.Equal(t, "5432", port)
+
+	t.Setenv("STANDBY_HOST", "replica")
+	t.Setenv("STANDBY_MAX_LAG", "5m")
+	t.Setenv("STANDBY_PAUSE_REPLAY", "true")
+	t.Setenv("DB_PASSWORD", "pass")
+	cfg, err = GetConfig()
+	require.NoError(t, err)
+	host, port = cfg.DumpHost()
+	assert.Equal(t, "replica", host)
+	assert.Equal(t, "5432", port)
+	assert.Equal(t, backuper.StandbyOptions{MaxLag: 5 * time.Minute, PauseReplay: true}, cfg.StandbyOptions())
+
+	t.Setenv("STANDBY_PORT", "5433")
+	t.Setenv("DB_PASSWORD", "pass")
+	cfg, err = GetConfig()
+	require.NoError(t, err)
+	_, port = cfg.DumpHost()
+	assert.Equal(t, "5433", port)
+}
+
+func Test_GetConfig_Pushgateway(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("PUSHGATEWAY_URL", "http://pushgateway:9091")
+	t.Setenv("PUSHGATEWAY_JOB", "backups")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.True(t, cfg.MetricsPushEnabled())
+	assert.Equal(t, "http://pushgateway:9091", cfg.PushgatewayURL)
+	assert.Equal(t, "backups", cfg.PushgatewayJob)
+}
+
+func Test_GetConfig_Tracing(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://otel-collector:4317")
+	t.Setenv("TRACEPARENT", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "http://otel-collector:4317", cfg.OtlpEndpoint)
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", cfg.TraceParent)
+}
+
+func Test_GetConfig_ReplicaEncryption(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("S3_CA_FILE", "/etc/ssl/minio/ca.pem")
+	t.Setenv("S3_SSE", "aws:kms")
+	t.Setenv("S3_SSE_KMS_KEY_ID", "key-id")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+	t.Setenv("REPLICA_S3_CA_FILE", "/etc/ssl/dr/ca.pem")
+	t.Setenv("REPLICA_SSE_KMS_KEY_ID", "replica-key-id")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, "/etc/ssl/dr/ca.pem", cfg.ReplicaStorageConfig().CAFile)
+	assert.Equal(t, "key-id", cfg.UploadOptions().SSEKMSKeyID)
+	assert.Equal(t, "aws:kms", cfg.ReplicaUploadOptions().SSE)
+	assert.Equal(t, "replica-key-id", cfg.ReplicaUploadOptions().SSEKMSKeyID)
+
+	t.Setenv("DB_PASSWORD", "pass") // unset by the previous GetConfig
+	t.Setenv("REPLICA_S3_CA_FILE", "")
+	t.Setenv("REPLICA_SSE_KMS_KEY_ID", "")
+	cfg, err = GetConfig()
+	require.NoError(t, err)
+
+	assert.Empty(t, cfg.ReplicaStorageConfig().CAFile)
+	assert.Empty(t, cfg.ReplicaUploadOptions().SSEKMSKeyID)
+}
+
+func Test_GetConfig_ReplicaConnection(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("S3_FORCE_PATH_STYLE", "false")
+	t.Setenv("S3_INSECURE_SKIP_VERIFY", "true")
+	t.Setenv("S3_ROLE_ARN", "arn:aws:iam::123456789012:role/backuper")
+	t.Setenv("S3_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/token")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	replica := cfg.ReplicaStorageConfig()
+	assert.False(t, replica.ForcePathStyle)
+	assert.True(t, replica.InsecureSkipVerify)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/backuper", replica.RoleARN)
+	assert.Equal(t, "/var/run/secrets/token", replica.WebIdentityTokenFile)
+	assert.Equal(t, "oiler-backuper", replica.RoleSessionName)
+
+	t.Setenv("DB_PASSWORD", "pass") // unset by the previous GetConfig
+	t.Setenv("REPLICA_S3_FORCE_PATH_STYLE", "true")
+	t.Setenv("REPLICA_S3_INSECURE_SKIP_VERIFY", "false")
+	t.Setenv("REPLICA_S3_ROLE_ARN", "arn:aws:iam::210987654321:role/replica")
+	t.Setenv("REPLICA_S3_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/dr-token")
+	t.Setenv("REPLICA_S3_ROLE_SESSION_NAME", "oiler-replica")
+	cfg, err = GetConfig()
+	require.NoError(t, err)
+
+	replica = cfg.ReplicaStorageConfig()
+	assert.True(t, replica.ForcePathStyle)
+	assert.False(t, replica.InsecureSkipVerify)
+	assert.Equal(t, "arn:aws:iam::210987654321:role/replica", replica.RoleARN)
+	assert.Equal(t, "/var/run/secrets/dr-token", replica.WebIdentityTokenFile)
+	assert.Equal(t, "oiler-replica", replica.RoleSessionName)
+	assert.False(t, cfg.StorageConfig().ForcePathStyle)
+}
+
+func Test_GetConfig_ReplicaRoleWithoutToken(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+	t.Setenv("REPLICA_S3_ROLE_ARN", "arn:aws:iam::210987654321:role/replica")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "REPLICA_S3_WEB_IDENTITY_TOKEN_FILE")
+}
+
+func Test_GetConfig_ReplicaKMSKeyWithoutKMS(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+	t.Setenv("REPLICA_SSE_KMS_KEY_ID", "replica-key-id")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "REPLICA_SSE_KMS_KEY_ID")
+}
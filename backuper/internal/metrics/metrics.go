@@ -0,0 +1,185 @@
+// Package metrics describes a finished backup and pushes it to Prometheus
+// Pushgateway, as backuper Jobs do not live long enough to be scraped.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// namespace prefixes names of all metrics.
+const namespace = "oiler_backup"
+
+// Phases of backup reported in Backup.Phases.
+const (
+	PhaseConnect = "connect"
+	PhaseDump    = "dump"
+	PhaseUpload  = "upload"
+	PhasePrune   = "prune"
+)
+
+// A Backup stores measurements of a single backup run.
+type Backup struct {
+	Success       bool
+	Duration      time.Duration
+	Phases        map[string]time.Duration // Duration of each completed phase
+	BackupBytes   int64                    // Size of uploaded artifact
+	DatabaseBytes int64                    // Size of database when backup started
+	Pruned        int                      // Number of outdated backups deleted
+	FailureClass  string                   // Why backup failed, e.g. auth_failed
+}
+
+// CompressionRatio returns ratio of database size to artifact size or 0 if
+// any of them is unknown.
+func (b Backup) CompressionRatio() float64 {
+	if b.BackupBytes <= 0 || b.DatabaseBytes <= 0 {
+		return 0
+	}
+	return float64(b.DatabaseBytes) / float64(b.BackupBytes)
+}
+
+// KeysAndValues returns measurements as pairs suitable for structured logging.
+func (b Backup) KeysAndValues() []any {
+	kv := []any{
+		"success", b.Success,
+		"duration", b.Duration,
+		"backupBytes", b.BackupBytes,
+		"databaseBytes", b.DatabaseBytes,
+		"compressionRatio", b.CompressionRatio(),
+		"pruned", b.Pruned,
+	}
+	if b.FailureClass != "" {
+		kv = append(kv, "failureClass", b.FailureClass)
+	}
+	for _, phase := range []string{PhaseConnect, PhaseDump, PhaseUpload, PhasePrune} {
+		if d, ok := b.Phases[phase]; ok {
+			kv = append(kv, phase+"Duration", d)
+		}
+	}
+	return kv
+}
+
+// A Pusher pushes Backup to Pushgateway grouped by backed up database.
+type Pusher struct {
+	url      string
+	job      string
+	grouping map[string]string
+}
+
+// NewPusher is a constructor for Pusher.
+// Metrics are pushed to url under job and grouped by database and host.
+func NewPusher(url, job, dbHost, dbName string) Pusher {
+	return Pusher{
+		url: url,
+		job: job,
+		grouping: map[string]string{
+			"database": dbName,
+			"host":     dbHost,
+		},
+	}
+}
+
+// Push replaces metrics of the previous run with metrics of backup.
+// Timestamp of the last successful backup is pushed only on success, so
+// that it survives pushes of failed runs.
+func (p Pusher) Push(ctx context.Context, backup Backup) error {
+	pusher := push.New(p.url, p.job)
+	for name, value := range p.grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	for _, collector := range collectors(backup) {
+		pusher = pusher.Collector(collector)
+	}
+	err := pusher.AddContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %v", p.url, err)
+	}
+	return nil
+}
+
+// collectors returns collectors holding measurements of backup.
+func collectors(backup Backup) []prometheus.Collector {
+	success := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "success",
+		Help:      "Whether the last backup succeeded.",
+	})
+	if backup.Success {
+		success.Set(1)
+	}
+	lastRun := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Time the last backup finished.",
+	})
+	lastRun.SetToCurrentTime()
+	duration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "duration_seconds",
+		Help:      "Duration of the last backup.",
+	})
+	duration.Set(backup.Duration.Seconds())
+	phases := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of phases of the last backup, by phase.",
+	}, []string{"phase"})
+	for phase, d := range backup.Phases {
+		phases.WithLabelValues(phase).Set(d.Seconds())
+	}
+	// Pushed on every run, so that class of a failure is replaced after success.
+	failure := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "failure_class",
+		Help:      "Class of the last backup failure, e.g. auth_failed or disk_full; none after success.",
+	}, []string{"class"})
+	if backup.Success {
+		failure.WithLabelValues("none").Set(0)
+	} else {
+		class := backup.FailureClass
+		if class == "" {
+			class = "unknown"
+		}
+		failure.WithLabelValues(class).Set(1)
+	}
+	result := []prometheus.Collector{success, lastRun, duration, phases, failure}
+	if !backup.Success {
+		return result
+	}
+
+	lastSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time the last successful backup finished.",
+	})
+	lastSuccess.SetToCurrentTime()
+	size := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "size_bytes",
+		Help:      "Size of the last backup artifact.",
+	})
+	size.Set(float64(backup.BackupBytes))
+	databaseSize := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_size_bytes",
+		Help:      "Size of the database at time of the last backup.",
+	})
+	databaseSize.Set(float64(backup.DatabaseBytes))
+	ratio := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "compression_ratio",
+		Help:      "Ratio of database size to size of the last backup artifact.",
+	})
+	ratio.Set(backup.CompressionRatio())
+	pruned := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pruned_objects",
+		Help:      "Number of outdated backups deleted by the last backup.",
+	})
+	pruned.Set(float64(backup.Pruned))
+	return append(result, lastSuccess, size, databaseSize, ratio, pruned)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup_CompressionRatio(t *testing.T) {
+	assert.Equal(t, 4.0, Backup{BackupBytes: 25, DatabaseBytes: 100}.CompressionRatio())
+	assert.Zero(t, Backup{DatabaseBytes: 100}.CompressionRatio())
+	assert.Zero(t, Backup{BackupBytes: 25}.CompressionRatio())
+}
+
+func TestPusher_Push(t *testing.T) {
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pusher := NewPusher(server.URL, "oiler_backuper", "postgres", "shop")
+	err := pusher.Push(context.Background(), Backup{
+		Success:       true,
+		Duration:      3 * time.Second,
+		Phases:        map[string]time.Duration{PhaseDump: 2 * time.Second},
+		BackupBytes:   25,
+		DatabaseBytes: 100,
+		Pruned:        2,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, method)
+	assert.Contains(t, path, "/job/oiler_backuper")
+	assert.Contains(t, path, "/database/shop")
+	assert.Contains(t, path, "/host/postgres")
+	assert.Contains(t, body, "oiler_backup_compression_ratio")
+	assert.Contains(t, body, "oiler_backup_last_success_timestamp_seconds")
+	assert.Contains(t, body, "oiler_backup_pruned_objects")
+}
+
+func TestPusher_PushFailure(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := NewPusher(server.URL, "oiler_backuper", "postgres", "shop").Push(context.Background(), Backup{FailureClass: "auth_failed"})
+	require.NoError(t, err)
+
+	assert.Contains(t, body, "oiler_backup_success")
+	assert.Contains(t, body, "oiler_backup_failure_class")
+	assert.Contains(t, body, "auth_failed")
+	assert.NotContains(t, body, "oiler_backup_last_success_timestamp_seconds")
+}
+
+func TestPusher_PushError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := NewPusher(server.URL, "oiler_backuper", "postgres", "shop").Push(context.Background(), Backup{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+)
+
+// A S3Cleaner deletes files from s3-bucket according to specified policy.
+type S3Cleaner struct {
+	client IS3Client
+}
+
+// NewS3Cleaner is a constructor for S3Cleaner.
+//
+// It configures and instantiates s3-client according to cc.
+func NewS3Cleaner(ctx context.Context, cc s3client.Config) (S3Cleaner, error) { // coverage-ignore
+	client, err := s3client.New(ctx, cc)
+	if err != nil {
+		return S3Cleaner{}, err
+	}
+	return S3Cleaner{
+		client: client,
+	}, nil
+}
+
+// Clean deletes oldest files to match maxBackupCount and returns number of deleted backups.
+// Manifests are not counted and are deleted together with their backups.
+// Backups pinned by their manifests are neither counted nor deleted.
+// Pre-restore snapshots are not counted either and are deleted once they are
+// older than the oldest retained backup.
+// backupDir might be either with or without trailing slash.
+func (c S3Cleaner) Clean(ctx context.Context, bucketName, backupDir string, maxBackupCount int) (int, error) {
+	listed, err := listObjects(ctx, c.client, bucketName, backupDir)
+	if err != nil {
+		return 0, err
+	}
+
+	objects := []types.Object{}
+	manifests := map[string]bool{}
+	for _, obj := range listed {
+		if manifest.IsManifestKey(*obj.Key) {
+			manifests[*obj.Key] = true
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	if len(objects) <= maxBackupCount {
+		return 0, nil
+	}
+	// Manifests are read only when some backups are to be deleted.
+	backups, snapshots, err := c.unpinned(ctx, bucketName, objects, manifests)
+	if err != nil {
+		return 0, err
+	}
+	if len(backups) <= maxBackupCount {
+		return 0, nil
+	}
+
+	sortOldestFirst(backups)
+	retained := backups[len(backups)-maxBackupCount:]
+	toDelete := slices.Clone(backups[:len(backups)-maxBackupCount])
+	for _, obj := range snapshots {
+		if len(retained) == 0 || obj.LastModified.Before(*retained[0].LastModified) {
+			toDelete = append(toDelete, obj)
+		}
+	}
+	sortOldestFirst(toDelete)
+
+	deleteObjects := []types.ObjectIdentifier{}
+	for _, obj := range toDelete {
+		deleteObjects = append(deleteObjects, types.ObjectIdentifier{Key: obj.Key})
+		manifestKey := manifest.KeyFor(*obj.Key)
+		if manifests[manifestKey] {
+			deleteObjects = append(deleteObjects, types.ObjectIdentifier{Key: aws.String(manifestKey)})
+		}
+	}
+
+	_, err = c.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucketName),
+		Delete: &types.Delete{
+			Objects: deleteObjects,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failure during objects deletion: %+v", err)
+	}
+
+	return len(toDelete), nil
+}
+
+// unpinned returns objects which are not pinned by their manifests, split into
+// backups and pre-restore snapshots. Backups without manifest are never pinned.
+func (c S3Cleaner) unpinned(ctx context.Context, bucketName string, objects []types.Object, manifests map[string]bool) (backups, snapshots []types.Object, err error) {
+	for _, obj := range objects {
+		manifestKey := manifest.KeyFor(*obj.Key)
+		if !manifests[manifestKey] {
+			backups = append(backups, obj)
+			continue
+		}
+		m, err := getManifest(ctx, c.client, bucketName, manifestKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case m.Pinned:
+		case m.HasTag(manifest.TagPreRestore):
+			snapshots = append(snapshots, obj)
+		default:
+			backups = append(backups, obj)
+		}
+	}
+	return backups, snapshots, nil
+}
+
+// sortOldestFirst sorts objects by time of upload, oldest first.
+func sortOldestFirst(objects []types.Object) {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].LastModified.Before(*objects[j].LastModified)
+	})
+}
+
+// getManifest returns manifest stored under manifestKey.
+func getManifest(ctx context.Context, client IS3Client, bucketName, manifestKey string) (manifest.Manifest, error) {
+	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(manifestKey),
+	})
+	if err != nil {
+		return manifest.Manifest{}, fmt.Errorf("failed to get manifest %s: %+v", manifestKey, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return manifest.Manifest{}, fmt.Errorf("failed to read manifest %s: %+v", manifestKey, err)
+	}
+	return manifest.Parse(data)
+}
+
+// listObjects returns all objects stored in backupDir.
+func listObjects(ctx context.Context, client IS3Client, bucketName, backupDir string) ([]types.Object, error) {
+	objects := []types.Object{}
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(ensureTrailingSlash(backupDir)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %+v", err)
+		}
+		objects = append(objects, page.Contents...)
+	}
+
+	return objects, nil
+}
+
+// ensureTrailingSlash adds trailing slash to s if it is not added yet.
+func ensureTrailingSlash(s string) string {
+	if !strings.HasSuffix(s, "/") {
+		s = fmt.Sprint(s, "/")
+	}
+	return s
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Clean_NoCleanupNeeded(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	objects := []types.Object{
+		{Key: aws.String("db/file1"), LastModified: aws.Time(time.Now())},
+		{Key: aws.String("db/file2"), LastModified: aws.Time(time.Now())},
+	}
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: objects}, nil)
+
+	pruned, err := cleaner.Clean(context.Background(), "bucket", "db", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+	mockClient.AssertNotCalled(t, "DeleteObjects")
+}
+
+func Test_Clean_DeleteOldBackups(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	now := time.Now()
+	mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return input.ContinuationToken == nil && *input.Prefix == "db/"
+	})).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/file3"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/file1"), LastModified: aws.Time(now.Add(-4 * time.Hour))},
+		},
+		IsTruncated:           aws.Bool(true),
+		NextContinuationToken: aws.String("next"),
+	}, nil)
+	mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return input.ContinuationToken != nil && *input.ContinuationToken == "next"
+	})).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/file2"), LastModified: aws.Time(now.Add(-3 * time.Hour))},
+			{Key: aws.String("db/file4"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+		},
+	}, nil)
+	mockClient.On("DeleteObjects", mock.Anything, &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{Key: aws.String("db/file1")},
+				{Key: aws.String("db/file2")},
+			},
+		},
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	pruned, err := cleaner.Clean(context.Background(), "bucket", "db", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+	mockClient.AssertExpectations(t)
+}
+
+func Test_Clean_DeletesManifests(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	now := time.Now()
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/file1"), LastModified: aws.Time(now.Add(-3 * time.Hour))},
+			{Key: aws.String("db/file1.manifest.json"), LastModified: aws.Time(now.Add(-3 * time.Hour))},
+			{Key: aws.String("db/file2"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/file3"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+			{Key: aws.String("db/file3.manifest.json"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+		},
+	}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.Anything).Return(manifestObject(`{"backupKey": "db/file1"}`), nil).Once()
+	mockClient.On("GetObject", mock.Anything, mock.Anything).Return(manifestObject(`{"backupKey": "db/file3"}`), nil).Once()
+	mockClient.On("DeleteObjects", mock.Anything, &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{Key: aws.String("db/file1")},
+				{Key: aws.String("db/file1.manifest.json")},
+				{Key: aws.String("db/file2")},
+			},
+		},
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	pruned, err := cleaner.Clean(context.Background(), "bucket", "db", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+	mockClient.AssertExpectations(t)
+}
+
+// manifestObject returns response of GetObject with manifest encoded as JSON.
+func manifestObject(data string) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(data))}
+}
+
+func Test_Clean_KeepsPinned(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	now := time.Now()
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/file1"), LastModified: aws.Time(now.Add(-4 * time.Hour))},
+			{Key: aws.String("db/file1.manifest.json"), LastModified: aws.Time(now.Add(-4 * time.Hour))},
+			{Key: aws.String("db/file2"), LastModified: aws.Time(now.Add(-3 * time.Hour))},
+			{Key: aws.String("db/file3"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/file3.manifest.json"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/file4"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+		},
+	}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Key == "db/file1.manifest.json"
+	})).Return(manifestObject(`{"backupKey": "db/file1", "pinned": true}`), nil)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Key == "db/file3.manifest.json"
+	})).Return(manifestObject(`{"backupKey": "db/file3"}`), nil)
+	mockClient.On("DeleteObjects", mock.Anything, &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{Key: aws.String("db/file2")},
+			},
+		},
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	pruned, err := cleaner.Clean(context.Background(), "bucket", "db", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	mockClient.AssertExpectations(t)
+}
+
+func Test_Clean_SkipsSnapshots(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	now := time.Now()
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/file1"), LastModified: aws.Time(now.Add(-5 * time.Hour))},
+			{Key: aws.String("db/snapshot1"), LastModified: aws.Time(now.Add(-4 * time.Hour))},
+			{Key: aws.String("db/snapshot1.manifest.json"), LastModified: aws.Time(now.Add(-4 * time.Hour))},
+			{Key: aws.String("db/file2"), LastModified: aws.Time(now.Add(-3 * time.Hour))},
+			{Key: aws.String("db/snapshot2"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/snapshot2.manifest.json"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/file3"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+		},
+	}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Key == "db/snapshot1.manifest.json"
+	})).Return(manifestObject(`{"backupKey": "db/snapshot1", "tags": ["pre-restore"]}`), nil)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Key == "db/snapshot2.manifest.json"
+	})).Return(manifestObject(`{"backupKey": "db/snapshot2", "tags": ["pre-restore"]}`), nil)
+	// Snapshots do not count, so that two backups are kept, and the snapshot
+	// older than both of them is deleted with the oldest backup.
+	mockClient.On("DeleteObjects", mock.Anything, &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{Key: aws.String("db/file1")},
+				{Key: aws.String("db/snapshot1")},
+				{Key: aws.String("db/snapshot1.manifest.json")},
+			},
+		},
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	pruned, err := cleaner.Clean(context.Background(), "bucket", "db", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+	mockClient.AssertExpectations(t)
+}
+
+func Test_Clean_ManifestError(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/file1"), LastModified: aws.Time(time.Now().Add(-time.Hour))},
+			{Key: aws.String("db/file1.manifest.json"), LastModified: aws.Time(time.Now().Add(-time.Hour))},
+			{Key: aws.String("db/file2"), LastModified: aws.Time(time.Now())},
+		},
+	}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), fmt.Errorf("get error"))
+
+	_, err := cleaner.Clean(context.Background(), "bucket", "db", 1)
+	require.ErrorContains(t, err, "failed to get manifest db/file1.manifest.json")
+	mockClient.AssertNotCalled(t, "DeleteObjects")
+}
+
+func Test_Clean_ListError(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).
+		Return((*s3.ListObjectsV2Output)(nil), fmt.Errorf("list error"))
+
+	_, err := cleaner.Clean(context.Background(), "bucket", "db/", 2)
+	require.ErrorContains(t, err, "failed to list objects")
+}
+
+func Test_Clean_DeleteError(t *testing.T) {
+	mockClient := new(MockS3Client)
+	cleaner := S3Cleaner{client: mockClient}
+
+	objects := []types.Object{
+		{Key: aws.String("db/file1"), LastModified: aws.Time(time.Now().Add(-time.Hour))},
+		{Key: aws.String("db/file2"), LastModified: aws.Time(time.Now().Add(-2 * time.Hour))},
+	}
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: objects}, nil)
+	mockClient.On("DeleteObjects", mock.Anything, mock.Anything).
+		Return((*s3.DeleteObjectsOutput)(nil), fmt.Errorf("delete error"))
+
+	_, err := cleaner.Clean(context.Background(), "bucket", "db/", 1)
+	require.ErrorContains(t, err, "failure during objects deletion")
+}
@@ -0,0 +1,5 @@
+// Package storage provides methods to work with s3-compatible storage.
+//
+// Unlike s3base it allows to configure region, addressing style, TLS and
+// server-side encryption of uploaded objects.
+package storage
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// An IS3Client provides functionality to work with s3-compatible storage.
+//
+// See https://pkg.go.dev/github.com/aws/aws-sdk-go-v2 for more information.
+type IS3Client interface {
+	manager.UploadAPIClient
+	// ListObjectsV2 returns list of objects in a specified bucket.
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	// GetObject retrieves a single object, e.g. manifest of a backup.
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	// DeleteObjects deletes specified files.
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// An IS3Uploader provides functionality to Upload data to s3-compatible storage.
+type IS3Uploader interface {
+	// Upload uploads a single file.
+	Upload(ctx context.Context, bucketName, objectKey string, fileContent io.Reader) error
+}
+
+// An IS3Cleaner provides functionality to delete data from s3-compatible storage.
+type IS3Cleaner interface {
+	// Clean deletes files according to maxBackupCount and returns number of deleted backups.
+	Clean(ctx context.Context, bucketName, backupDir string, maxBackupCount int) (int, error)
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+)
+
+// A Backup is a backup stored in s3-compatible storage.
+type Backup struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	Manifest     *manifest.Manifest // nil for backups uploaded without one
+}
+
+// A S3Reader provides methods to inspect and download stored backups.
+type S3Reader struct {
+	client IS3Client
+}
+
+// NewS3Reader is a constructor for S3Reader.
+//
+// It configures and instantiates s3-client according to cc.
+func NewS3Reader(ctx context.Context, cc s3client.Config) (S3Reader, error) { // coverage-ignore
+	client, err := s3client.New(ctx, cc)
+	if err != nil {
+		return S3Reader{}, err
+	}
+	return S3Reader{
+		client: client,
+	}, nil
+}
+
+// List returns backups stored in backupDir with their manifests, newest first.
+// backupDir might be either with or without trailing slash.
+func (r S3Reader) List(ctx context.Context, bucketName, backupDir string) ([]Backup, error) {
+	listed, err := listObjects(ctx, r.client, bucketName, backupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	manifests := map[string]bool{}
+	for _, obj := range listed {
+		if manifest.IsManifestKey(*obj.Key) {
+			manifests[*obj.Key] = true
+			continue
+		}
+		backups = append(backups, Backup{
+			Key:          *obj.Key,
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+	for i, backup := range backups {
+		manifestKey := manifest.KeyFor(backup.Key)
+		if !manifests[manifestKey] {
+			continue
+		}
+		m, err := getManifest(ctx, r.client, bucketName, manifestKey)
+		if err != nil {
+			return nil, err
+		}
+		backups[i].Manifest = &m
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[j].LastModified.Before(backups[i].LastModified)
+	})
+	return backups, nil
+}
+
+// Download writes backup stored under backupKey to w.
+func (r S3Reader) Download(ctx context.Context, bucketName, backupKey string, w io.Writer) error {
+	resp, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(backupKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get backup %s: %+v", backupKey, err)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download backup %s: %+v", backupKey, err)
+	}
+	return nil
+}
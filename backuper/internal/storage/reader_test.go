@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_List(t *testing.T) {
+	mockClient := new(MockS3Client)
+	reader := S3Reader{client: mockClient}
+
+	now := time.Now()
+	mockClient.On("ListObjectsV2", mock.Anything, mock.MatchedBy(func(input *s3.ListObjectsV2Input) bool {
+		return *input.Bucket == "bucket" && *input.Prefix == "db/"
+	})).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/file1"), Size: aws.Int64(10), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/file2"), Size: aws.Int64(20), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+			{Key: aws.String("db/file2.manifest.json"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+		},
+	}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Key == "db/file2.manifest.json"
+	})).Return(manifestObject(`{"backupKey": "db/file2", "tags": ["nightly"], "pinned": true}`), nil)
+
+	backups, err := reader.List(context.Background(), "bucket", "db")
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, "db/file2", backups[0].Key)
+	assert.Equal(t, int64(20), backups[0].Size)
+	require.NotNil(t, backups[0].Manifest)
+	assert.Equal(t, []string{"nightly"}, backups[0].Manifest.Tags)
+	assert.True(t, backups[0].Manifest.Pinned)
+	assert.Equal(t, "db/file1", backups[1].Key)
+	assert.Nil(t, backups[1].Manifest)
+}
+
+func Test_List_Error(t *testing.T) {
+	mockClient := new(MockS3Client)
+	reader := S3Reader{client: mockClient}
+
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return((*s3.ListObjectsV2Output)(nil), fmt.Errorf("access denied"))
+
+	_, err := reader.List(context.Background(), "bucket", "db")
+	assert.ErrorContains(t, err, "access denied")
+}
+
+func Test_Download(t *testing.T) {
+	mockClient := new(MockS3Client)
+	reader := S3Reader{client: mockClient}
+
+	mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("db/file1"),
+	}).Return(manifestObject("backup"), nil).Once()
+	mockClient.On("GetObject", mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), fmt.Errorf("no such key"))
+
+	var buf bytes.Buffer
+	require.NoError(t, reader.Download(context.Background(), "bucket", "db/file1", &buf))
+	assert.Equal(t, "backup", buf.String())
+	assert.ErrorContains(t, reader.Download(context.Background(), "bucket", "db/missing", &buf), "failed to get backup db/missing")
+}
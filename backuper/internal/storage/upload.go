@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+)
+
+// An UploadOptions describes how uploaded objects are stored.
+// Empty values leave the bucket defaults in place.
+type UploadOptions struct {
+	StorageClass string // e.g. STANDARD_IA
+	SSE          string // Server-side encryption algorithm: AES256 or aws:kms
+	SSEKMSKeyID  string // KMS key used when SSE is aws:kms
+
+	Retry retry.Policy // Retries of uploads failed with transient errors
+}
+
+// A S3Uploader provides methods to upload file to s3-compatible storage.
+type S3Uploader struct {
+	client IS3Client
+	opts   UploadOptions
+}
+
+// NewS3Uploader is a constructor for S3Uploader.
+//
+// It configures and instantiates s3-client according to cc.
+// opts are applied to each uploaded object.
+func NewS3Uploader(ctx context.Context, cc s3client.Config, opts UploadOptions) (S3Uploader, error) { // coverage-ignore
+	client, err := s3client.New(ctx, cc)
+	if err != nil {
+		return S3Uploader{}, err
+	}
+
+	return S3Uploader{
+		client: client,
+		opts:   opts,
+	}, nil
+}
+
+// Upload uploads a single file to storage.
+// Uploads of content which is not seekable, e.g. a pipe, are not retried.
+func (u S3Uploader) Upload(ctx context.Context, bucketName, objectKey string, fileContent io.Reader) error {
+	policy := u.opts.Retry
+	seeker, seekable := fileContent.(io.Seeker)
+	if !seekable {
+		policy.Attempts = 1
+	}
+
+	uploader := manager.NewUploader(u.client)
+	return retry.Do(ctx, policy, retry.IsTransient, func(ctx context.Context) error {
+		if seekable {
+			_, err := seeker.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := uploader.Upload(ctx, u.putObjectInput(bucketName, objectKey, fileContent))
+		return err
+	})
+}
+
+// putObjectInput builds upload request applying UploadOptions.
+func (u S3Uploader) putObjectInput(bucketName, objectKey string, fileContent io.Reader) *s3.PutObjectInput {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+		Body:   fileContent,
+	}
+	if u.opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(u.opts.StorageClass)
+	}
+	if u.opts.SSE != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(u.opts.SSE)
+	}
+	if u.opts.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(u.opts.SSEKMSKeyID)
+	}
+
+	return input
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+)
+
+func Test_PutObjectInput_Defaults(t *testing.T) {
+	u := S3Uploader{}
+	input := u.putObjectInput("bucket", "db/backup.sql", strings.NewReader("content"))
+
+	assert.Equal(t, "bucket", *input.Bucket)
+	assert.Equal(t, "db/backup.sql", *input.Key)
+	assert.Empty(t, input.StorageClass)
+	assert.Empty(t, input.ServerSideEncryption)
+	assert.Nil(t, input.SSEKMSKeyId)
+}
+
+func Test_PutObjectInput_Options(t *testing.T) {
+	u := S3Uploader{opts: UploadOptions{
+		StorageClass: "STANDARD_IA",
+		SSE:          "aws:kms",
+		SSEKMSKeyID:  "key-id",
+	}}
+	input := u.putObjectInput("bucket", "db/backup.sql", strings.NewReader("content"))
+
+	assert.Equal(t, types.StorageClassStandardIa, input.StorageClass)
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+	assert.Equal(t, "key-id", *input.SSEKMSKeyId)
+}
+
+func Test_Upload(t *testing.T) {
+	mockClient := new(MockS3Client)
+	u := S3Uploader{client: mockClient, opts: UploadOptions{StorageClass: "STANDARD_IA"}}
+
+	mockClient.On("PutObject", mock.Anything, mock.MatchedBy(func(input *s3.PutObjectInput) bool {
+		return *input.Key == "db/backup.sql" && input.StorageClass == types.StorageClassStandardIa
+	})).Return(&s3.PutObjectOutput{}, nil)
+
+	err := u.Upload(context.Background(), "bucket", "db/backup.sql", strings.NewReader("content"))
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func Test_Upload_Error(t *testing.T) {
+	mockClient := new(MockS3Client)
+	u := S3Uploader{client: mockClient}
+
+	mockClient.On("PutObject", mock.Anything, mock.Anything).Return(&s3.PutObjectOutput{}, fmt.Errorf("aws error"))
+
+	err := u.Upload(context.Background(), "bucket", "db/backup.sql", strings.NewReader("content"))
+	require.ErrorContains(t, err, "aws error")
+}
+
+func Test_Upload_RetriesTransient(t *testing.T) {
+	mockClient := new(MockS3Client)
+	u := S3Uploader{client: mockClient, opts: UploadOptions{Retry: retry.Policy{Attempts: 2}}}
+
+	mockClient.On("PutObject", mock.Anything, mock.Anything).
+		Return((*s3.PutObjectOutput)(nil), &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}).Once()
+	mockClient.On("PutObject", mock.Anything, mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	err := u.Upload(context.Background(), "bucket", "db/backup.sql", strings.NewReader("content"))
+	require.NoError(t, err)
+	mockClient.AssertNumberOfCalls(t, "PutObject", 2)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/tracing"
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+)
+
+// A S3UploadCleaner provides methods to clean the storage after
+// uploading a file.
+type S3UploadCleaner struct {
+	u IS3Uploader
+	c IS3Cleaner
+}
+
+// NewS3UploadCleaner is a constructor for S3UploadCleaner.
+//
+// It configures and instantiates s3-client according to cc.
+// opts are applied to each uploaded object.
+func NewS3UploadCleaner(ctx context.Context, cc s3client.Config, opts UploadOptions) (S3UploadCleaner, error) { // coverage-ignore
+	client, err := s3client.New(ctx, cc)
+	if err != nil {
+		return S3UploadCleaner{}, fmt.Errorf("failed to initialize s3-client: %+v", err)
+	}
+
+	return S3UploadCleaner{
+		u: S3Uploader{client: client, opts: opts},
+		c: S3Cleaner{client: client},
+	}, nil
+}
+
+// Upload uploads a file without cleaning storage.
+func (uc S3UploadCleaner) Upload(ctx context.Context, bucketName, fileName string, fileContent io.Reader) error {
+	return uc.u.Upload(ctx, bucketName, fileName, fileContent)
+}
+
+// An UploadStats describes a finished CleanAndUpload.
+type UploadStats struct {
+	Upload time.Duration // Time spent uploading file and its manifest
+	Prune  time.Duration // Time spent cleaning storage
+	Pruned int           // Number of deleted backups
+}
+
+// CleanAndUpload uploads a file with its manifest and then cleans storage.
+// The manifest is uploaded before cleaning, so that the new backup is
+// counted according to it, e.g. not counted if pinned. Storage is not
+// cleaned if either upload fails. Manifest is not uploaded if it is nil.
+// Refer to [S3Uploader] and [S3Cleaner] for more information
+func (uc S3UploadCleaner) CleanAndUpload(ctx context.Context, bucketName, backupDir string, maxBackupCount int, fileName string, fileContent io.Reader, manifestContent []byte) (UploadStats, error) {
+	stats := UploadStats{}
+	start := time.Now()
+	uploadCtx, span := tracing.Start(ctx, "upload", trace.WithAttributes(attribute.String("s3.key", fileName)))
+	err := uc.u.Upload(uploadCtx, bucketName, fileName, fileContent)
+	if err != nil {
+		err = fmt.Errorf("failed to upload object to S3: %+v", err)
+	} else if manifestContent != nil {
+		err = uc.u.Upload(uploadCtx, bucketName, manifest.KeyFor(fileName), bytes.NewReader(manifestContent))
+		if err != nil {
+			err = fmt.Errorf("failed to upload manifest to S3: %+v", err)
+		}
+	}
+	tracing.End(span, err)
+	stats.Upload = time.Since(start)
+	if err != nil {
+		return stats, err
+	}
+
+	start = time.Now()
+	pruneCtx, span := tracing.Start(ctx, "prune")
+	stats.Pruned, err = uc.c.Clean(pruneCtx, bucketName, backupDir, maxBackupCount)
+	span.SetAttributes(attribute.Int("oiler.pruned", stats.Pruned))
+	tracing.End(span, err)
+	stats.Prune = time.Since(start)
+	if err != nil {
+		return stats, fmt.Errorf("failed to clean S3: %+v", err)
+	}
+
+	return stats, nil
+}
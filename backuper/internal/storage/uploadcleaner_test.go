@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CleanAndUpload_Success(t *testing.T) {
+	mockUploader := new(MockS3Uploader)
+	mockCleaner := new(MockS3Cleaner)
+	uploadCleaner := S3UploadCleaner{u: mockUploader, c: mockCleaner}
+
+	fileContent := strings.NewReader("some content")
+	mockUploader.On("Upload", mock.Anything, "bucket", "db/backup.sql", fileContent).Return(nil)
+	mockUploader.On("Upload", mock.Anything, "bucket", "db/backup.sql.manifest.json", mock.Anything).Return(nil)
+	mockCleaner.On("Clean", mock.Anything, "bucket", "db", 5).Return(3, nil)
+
+	stats, err := uploadCleaner.CleanAndUpload(context.Background(), "bucket", "db", 5, "db/backup.sql", fileContent, []byte("{}"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Pruned)
+	mockUploader.AssertExpectations(t)
+	mockCleaner.AssertExpectations(t)
+}
+
+func Test_CleanAndUpload_UploadError(t *testing.T) {
+	mockUploader := new(MockS3Uploader)
+	mockCleaner := new(MockS3Cleaner)
+	uploadCleaner := S3UploadCleaner{u: mockUploader, c: mockCleaner}
+
+	mockUploader.On("Upload", mock.Anything, "bucket", "db/backup.sql", nil).Return(fmt.Errorf("upload failed"))
+
+	_, err := uploadCleaner.CleanAndUpload(context.Background(), "bucket", "db", 5, "db/backup.sql", nil, []byte("{}"))
+	require.ErrorContains(t, err, "failed to upload object to S3")
+	mockCleaner.AssertNotCalled(t, "Clean")
+}
+
+func Test_CleanAndUpload_CleanError(t *testing.T) {
+	mockUploader := new(MockS3Uploader)
+	mockCleaner := new(MockS3Cleaner)
+	uploadCleaner := S3UploadCleaner{u: mockUploader, c: mockCleaner}
+
+	fileContent := strings.NewReader("some content")
+	mockUploader.On("Upload", mock.Anything, "bucket", "db/backup.sql", fileContent).Return(nil)
+	mockCleaner.On("Clean", mock.Anything, "bucket", "db", 5).Return(0, fmt.Errorf("clean error"))
+
+	_, err := uploadCleaner.CleanAndUpload(context.Background(), "bucket", "db", 5, "db/backup.sql", fileContent, nil)
+	require.ErrorContains(t, err, "failed to clean S3")
+	mockUploader.AssertNumberOfCalls(t, "Upload", 1)
+}
+
+func Test_CleanAndUpload_ManifestUploadError(t *testing.T) {
+	mockUploader := new(MockS3Uploader)
+	mockCleaner := new(MockS3Cleaner)
+	uploadCleaner := S3UploadCleaner{u: mockUploader, c: mockCleaner}
+
+	fileContent := strings.NewReader("some content")
+	mockUploader.On("Upload", mock.Anything, "bucket", "db/backup.sql", fileContent).Return(nil)
+	mockUploader.On("Upload", mock.Anything, "bucket", "db/backup.sql.manifest.json", mock.Anything).Return(fmt.Errorf("upload failed"))
+
+	_, err := uploadCleaner.CleanAndUpload(context.Background(), "bucket", "db", 5, "db/backup.sql", fileContent, []byte("{}"))
+	require.ErrorContains(t, err, "failed to upload manifest to S3")
+	mockCleaner.AssertNotCalled(t, "Clean")
+}
+
+func Test_UploadCleaner_Upload(t *testing.T) {
+	mockUploader := new(MockS3Uploader)
+	mockCleaner := new(MockS3Cleaner)
+	uploadCleaner := S3UploadCleaner{u: mockUploader, c: mockCleaner}
+
+	fileContent := strings.NewReader("{}")
+	mockUploader.On("Upload", mock.Anything, "bucket", "db/backup.sql.manifest.json", fileContent).Return(nil)
+
+	err := uploadCleaner.Upload(context.Background(), "bucket", "db/backup.sql.manifest.json", fileContent)
+	require.NoError(t, err)
+	mockUploader.AssertExpectations(t)
+	mockCleaner.AssertNotCalled(t, "Clean")
+}
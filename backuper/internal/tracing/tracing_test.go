@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs tracer provider recording ended spans for the duration of t.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func Test_Setup_Disabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func Test_StartRun_LinksScheduler(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx, run := StartRun(context.Background(), "backup", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "")
+	_, dump := Start(ctx, "pg_dump")
+	End(dump, errors.New("failed"))
+	End(run, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "pg_dump", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+
+	assert.Equal(t, "backup", spans[1].Name())
+	assert.NotEqual(t, "0af7651916cd43dd8448eb211c80319c", spans[1].SpanContext().TraceID().String())
+	require.Len(t, spans[1].Links(), 1)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[1].Links()[0].SpanContext.TraceID().String())
+}
+
+func Test_StartRun_WithoutScheduler(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, run := StartRun(context.Background(), "backup", "", "")
+	End(run, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Empty(t, spans[0].Links())
+}
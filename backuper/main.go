@@ -4,22 +4,30 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"github.com/oiler-backup/postgres-adapter/backuper/internal/backuper"
 	"github.com/oiler-backup/postgres-adapter/backuper/internal/config"
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/metrics"
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/backuper/internal/tracing"
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+	"github.com/oiler-backup/postgres-adapter/common/retry"
 
 	_ "github.com/lib/pq"
 	loggerbase "github.com/oiler-backup/base/logger"
 	metricsbase "github.com/oiler-backup/base/metrics"
-	s3base "github.com/oiler-backup/base/s3"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 const (
-	S3REGION    = "us-east-1" // Fictious
 	BACKUP_PATH = "/tmp/backup.sql"
 )
 
@@ -28,6 +36,13 @@ var (
 	metricsReporter metricsbase.MetricsReporter
 	ctx             context.Context
 	backupName      string
+	replicaName     string
+	retryPolicy     retry.Policy // Retries of transient failures, zero until configured
+	metricsPusher   *metrics.Pusher
+	runSpan         trace.Span                  // Root span of backup run
+	shutdownTracing func(context.Context) error // Flushes spans before exit
+	backupMetrics   = metrics.Backup{Phases: map[string]time.Duration{}}
+	start           time.Time
 )
 
 func main() {
@@ -45,44 +60,227 @@ func main() {
 	if err != nil {
 		panic(fmt.Sprintf("Failed to configurate: %v", err))
 	}
-	backupName = fmt.Sprintf("%s:%s/%s", cfg.DbHost, cfg.DbPort, cfg.DbName)
-	backuper := backuper.NewBackuper(cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbPassword, cfg.DbName, BACKUP_PATH)
-	s3UploaderCleaner, err := s3base.NewS3UploadCleaner(ctx, cfg.S3Endpoint, cfg.S3AccessKey, cfg.S3SecretKey, S3REGION, cfg.Secure)
+	shutdownTracing, err = tracing.Setup(ctx, cfg.OtlpEndpoint)
 	if err != nil {
-		mustProccessErrors("Failed to initialize s3Uploader: %+v", err)
+		panic(fmt.Sprintf("Failed to set up tracing: %v", err))
 	}
+	ctx, runSpan = tracing.StartRun(ctx, "backup", cfg.TraceParent, cfg.TraceState)
+
+	backupName = fmt.Sprintf("%s:%s/%s", cfg.DbHost, cfg.DbPort, cfg.DbName)
+	replicaName = fmt.Sprintf("%s-replica", backupName)
+	retryPolicy = cfg.RetryPolicy()
+	retryPolicy.Notify = logRetry
 
-	// Backward metrics reporter
+	// Backward metrics reporter, set up first so that failures below are reported to core
 	metricsReporter = metricsbase.NewMetricsReporter(cfg.CoreAddr, false)
+	if cfg.MetricsPushEnabled() {
+		pusher := metrics.NewPusher(cfg.PushgatewayURL, cfg.PushgatewayJob, cfg.DbHost, cfg.DbName)
+		metricsPusher = &pusher
+	}
 
-	start := time.Now()
-	err = backuper.Backup(ctx, cfg.Secure)
+	start = time.Now()
+	hooks := cfg.BackupHooks()
+	hooks.Notify = logHookFailure
+	clients, err := pgclient.Find(ctx, cfg.PgClientDirs)
+	if err != nil {
+		mustProccessErrors("Failed to find client tools: %+v", err)
+	}
+	dumpHost, dumpPort := cfg.DumpHost()
+	backupExtension := backuper.Extension(cfg.BackupFormat)
+	backuper := backuper.NewBackuper(dumpHost, dumpPort, cfg.DbUser, cfg.DbPassword, cfg.DbName, BACKUP_PATH, backuper.Options{
+		Scope:   cfg.BackupScope(),
+		Dump:    cfg.DumpOptions(),
+		Standby: cfg.StandbyOptions(),
+		Retry:   retryPolicy,
+		Hooks:   hooks,
+		Clients: clients,
+	})
+	s3UploaderCleaner, err := storage.NewS3UploadCleaner(ctx, cfg.StorageConfig(), withRetry(cfg.UploadOptions()))
+	if err != nil {
+		mustProccessErrors("Failed to initialize s3Uploader: %+v", err)
+	}
+
+	stats, err := backuper.Backup(ctx, cfg.Secure)
+	backupMetrics.Phases[metrics.PhaseConnect] = stats.Connect
+	backupMetrics.Phases[metrics.PhaseDump] = stats.Dump
+	backupMetrics.DatabaseBytes = stats.DatabaseSize
 	if err != nil {
 		mustProccessErrors("Failed to perform backup", err)
 	}
+	logger.Infow("Backup dumped", "host", dumpHost, "serverVersion", stats.ServerMajor, "pgDumpVersion", stats.ClientMajor,
+		"verified", stats.Verified)
+	if stats.Standby != nil {
+		logger.Infow("Backup taken from standby", "replayLsn", stats.Standby.ReplayLSN,
+			"replayTimestamp", stats.Standby.ReplayTimestamp, "lag", stats.Standby.Lag)
+	}
+	if stats.SerializableDeferrableDropped {
+		logger.Warnw("PG_DUMP_SERIALIZABLE_DEFERRABLE ignored, database is in recovery", "host", dumpHost)
+	}
 
-	dateNow := time.Now().Format("2006-01-02-15-04-05")
+	createdAt := time.Now()
+	dateNow := createdAt.Format("2006-01-02-15-04-05")
 	backupFile, err := os.Open(BACKUP_PATH)
 	if err != nil {
 		mustProccessErrors("Failed to open backupFile: %+v", err)
 	}
 	defer backupFile.Close()
-	err = s3UploaderCleaner.CleanAndUpload(ctx, cfg.S3BucketName, cfg.DbName, cfg.MaxBackupCount, fmt.Sprintf("%s/%s-backup.sql", cfg.DbName, dateNow), backupFile)
+	backupKey := fmt.Sprintf("%s/%s-backup%s", cfg.DbName, dateNow, backupExtension)
+	newManifest := manifest.New(cfg.DbName, backupKey, cfg.BackupFormat, createdAt)
+	newManifest.Scope = manifest.Scope(cfg.BackupScope())
+	newManifest.Standby = stats.Standby
+	newManifest.Tags = cfg.BackupTags
+	newManifest.Pinned = cfg.BackupPin
+	newManifest.Verified = stats.Verified
+	checkedManifest, err := newManifest.WithChecksum(backupFile)
+	if err != nil {
+		mustProccessErrors("Failed to build manifest: %+v", err)
+	}
+	_, err = backupFile.Seek(0, io.SeekStart)
+	if err != nil {
+		mustProccessErrors("Failed to rewind backupFile: %+v", err)
+	}
+	backupManifest, err := checkedManifest.Marshal()
+	if err != nil {
+		mustProccessErrors("Failed to build manifest: %+v", err)
+	}
+	uploadStats, err := s3UploaderCleaner.CleanAndUpload(ctx, cfg.S3BucketName, cfg.DbName, cfg.MaxBackupCount, backupKey, backupFile, backupManifest)
+	backupMetrics.Phases[metrics.PhasePrune] = uploadStats.Prune
+	backupMetrics.Phases[metrics.PhaseUpload] = uploadStats.Upload
+	backupMetrics.Pruned = uploadStats.Pruned
 	if err != nil {
 		mustProccessErrors("Failed to upload backup to S3: %+v", err)
 	}
 
 	timeElapsed := time.Since(start)
-	err = metricsReporter.ReportStatus(ctx, backupName, true, int64(timeElapsed.Milliseconds()))
+	backupMetrics.Success = true
+	backupMetrics.BackupBytes = checkedManifest.Size
+	pushMetrics()
+	err = reportStatus(backupName, true, int64(timeElapsed.Milliseconds()))
 	if err != nil {
 		logger.Fatalf("Failed to report successful status %w\n", err)
 	}
-	logger.Infof("Backup successfully loaded to S3")
+	logger.Infow("Backup successfully loaded to S3", backupMetrics.KeysAndValues()...)
+
+	if cfg.ReplicationEnabled() {
+		replicate(cfg, backupKey, backupFile, backupManifest)
+	}
+	endTrace(nil)
+}
+
+// replicate copies uploaded backup and its manifest to the secondary storage.
+// Failures are reported under replicaName and never fail the backup itself.
+func replicate(cfg config.Config, backupKey string, backupFile io.ReadSeeker, backupManifest []byte) {
+	start := time.Now()
+	err := func() error {
+		replicaUploaderCleaner, err := storage.NewS3UploadCleaner(ctx, cfg.ReplicaStorageConfig(), withRetry(cfg.ReplicaUploadOptions()))
+		if err != nil {
+			return fmt.Errorf("failed to initialize replica s3Uploader: %+v", err)
+		}
+		_, err = backupFile.Seek(0, io.SeekStart)
+		if err != nil {
+			return fmt.Errorf("failed to rewind backupFile: %+v", err)
+		}
+		_, err = replicaUploaderCleaner.CleanAndUpload(ctx, cfg.ReplicaS3BucketName, cfg.DbName, cfg.ReplicaMaxBackupCount, backupKey, backupFile, backupManifest)
+		return err
+	}()
+	if err != nil {
+		logger.Errorw("Failed to replicate backup", "error", err)
+		err = reportStatus(replicaName, false, -1)
+		if err != nil {
+			logger.Errorw("Failed to report replication status", "error", err)
+		}
+		return
+	}
+
+	timeElapsed := time.Since(start)
+	err = reportStatus(replicaName, true, int64(timeElapsed.Milliseconds()))
+	if err != nil {
+		logger.Errorw("Failed to report replication status", "error", err)
+	}
+	logger.Infof("Backup successfully replicated to secondary S3")
+}
+
+// withRetry returns upload options opts with retries logged.
+func withRetry(opts storage.UploadOptions) storage.UploadOptions {
+	opts.Retry = retryPolicy
+	return opts
+}
+
+// logRetry logs an operation failed with transient error before it is retried.
+func logRetry(err error, attempt int, delay time.Duration) {
+	logger.Warnw("Operation failed, retrying", "error", err, "attempt", attempt, "delay", delay)
+}
+
+// logHookFailure logs failure of a hook which does not abort backup.
+func logHookFailure(hook backuper.Hook, err error) {
+	logger.Warnw("Hook failed, continuing", "hook", hook.Name, "error", err)
+}
+
+// pushMetrics logs measurements of backup and pushes them to Pushgateway if enabled.
+// Failed push is logged and never fails the backup itself.
+func pushMetrics() {
+	backupMetrics.Duration = time.Since(start)
+	if metricsPusher == nil {
+		return
+	}
+	err := metricsPusher.Push(ctx, backupMetrics)
+	if err != nil {
+		logger.Errorw("Failed to push metrics", "error", err)
+	}
+}
+
+// endTrace ends root span of backup run with err and flushes spans.
+func endTrace(err error) {
+	tracing.End(runSpan, err)
+	err = shutdownTracing(context.Background())
+	if err != nil {
+		logger.Errorw("Failed to flush traces", "error", err)
+	}
+}
+
+// logOutput logs parsed output of failed pg_dump, one entry per message.
+func logOutput(err error) {
+	var cmdErr *pgoutput.CommandError
+	if !errors.As(err, &cmdErr) {
+		return
+	}
+	for _, message := range cmdErr.Output {
+		keysAndValues := []any{"program", message.Program, "severity", message.Severity}
+		if message.Code != "" {
+			keysAndValues = append(keysAndValues, "code", message.Code)
+		}
+		if message.Object != "" {
+			keysAndValues = append(keysAndValues, "object", message.Object)
+		}
+		if message.Class != "" {
+			keysAndValues = append(keysAndValues, "class", message.Class)
+		}
+		switch message.Severity {
+		case pgoutput.SeverityError:
+			logger.Errorw(message.Text, keysAndValues...)
+		case pgoutput.SeverityWarning:
+			logger.Warnw(message.Text, keysAndValues...)
+		default:
+			logger.Infow(message.Text, keysAndValues...)
+		}
+	}
+}
+
+// reportStatus reports status of metricName to core retrying transient failures.
+func reportStatus(metricName string, success bool, timeElapsed int64) error {
+	return retry.Do(ctx, retryPolicy, retry.IsTransient, func(ctx context.Context) error {
+		return metricsReporter.ReportStatus(ctx, metricName, success, timeElapsed)
+	})
 }
 
 func mustProccessErrors(msg string, err error, keysAndValues ...any) {
-	logger.Errorw(msg, "error", err, keysAndValues)
-	err = metricsReporter.ReportStatus(ctx, backupName, false, -1)
+	class := pgoutput.Classify(err)
+	logOutput(err)
+	logger.Errorw(msg, "error", err, "failureClass", class, keysAndValues)
+	backupMetrics.FailureClass = string(class)
+	pushMetrics()
+	endTrace(err)
+	err = reportStatus(backupName, false, -1)
 	if err != nil {
 		logger.Fatalf("Failed to report metric %w\n", err)
 	}
@@ -0,0 +1,146 @@
+// Package manifest describes metadata stored in s3-compatible storage
+// next to each backup.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Suffix is appended to a backup key to get key of its manifest.
+const Suffix = ".manifest.json"
+
+// Version is a version of manifest format.
+const Version = 1
+
+// Revisions which select backups by their manifests and cannot be used as tags.
+const (
+	Latest         = "latest"          // The newest backup
+	LatestVerified = "latest-verified" // The newest backup read back after dump
+)
+
+// TagPreRestore marks snapshots of target database taken by restorer before
+// restoring a backup.
+const TagPreRestore = "pre-restore"
+
+// tagPattern matches valid tags, e.g. pre-migration-v42.
+var tagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]*$`)
+
+// ValidateTags returns error if any of tags is malformed or reserved.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q: must start with a letter and contain only letters, digits, '.', '_' and '-'", tag)
+		}
+		if slices.Contains([]string{Latest, LatestVerified, TagPreRestore}, tag) {
+			return fmt.Errorf("tag %q is reserved", tag)
+		}
+	}
+	return nil
+}
+
+// A Scope lists pg_dump patterns backup was limited to.
+type Scope struct {
+	Schemas          []string `json:"schemas,omitempty"`
+	ExcludeSchemas   []string `json:"excludeSchemas,omitempty"`
+	Tables           []string `json:"tables,omitempty"`
+	ExcludeTables    []string `json:"excludeTables,omitempty"`
+	ExcludeTableData []string `json:"excludeTableData,omitempty"`
+}
+
+// IsPartial reports whether some objects of the database are missing in backup.
+func (s Scope) IsPartial() bool {
+	return len(s.Schemas) > 0 || len(s.ExcludeSchemas) > 0 ||
+		len(s.Tables) > 0 || len(s.ExcludeTables) > 0 || len(s.ExcludeTableData) > 0
+}
+
+// A Standby is a replay position of the hot standby backup was taken from.
+type Standby struct {
+	ReplayLSN       string        `json:"replayLsn"`
+	ReplayTimestamp time.Time     `json:"replayTimestamp,omitzero"` // Commit time of the last replayed transaction
+	Lag             time.Duration `json:"lag"`                      // Replication lag when backup started
+}
+
+// A Manifest describes a single backup.
+type Manifest struct {
+	Version   int       `json:"version"`
+	Database  string    `json:"database"`
+	BackupKey string    `json:"backupKey"`
+	CreatedAt time.Time `json:"createdAt"`
+	Format    string    `json:"format"` // pg_dump output format
+	Scope     Scope     `json:"scope"`  // Empty scope means the whole database
+	Size      int64     `json:"size,omitempty"`
+	SHA256    string    `json:"sha256,omitempty"` // Hex-encoded checksum of the backup, missing in older manifests
+
+	Standby *Standby `json:"standby,omitempty"` // Replay position if backup was taken from a standby
+
+	Tags     []string `json:"tags,omitempty"`     // User-supplied labels backup can be restored by, e.g. pre-migration-v42
+	Pinned   bool     `json:"pinned,omitempty"`   // Pinned backups are never deleted by retention
+	Verified bool     `json:"verified,omitempty"` // Backup was read back successfully after dump
+}
+
+// New is a constructor for Manifest of a whole database backup in format
+// stored under backupKey.
+func New(database, backupKey, format string, createdAt time.Time) Manifest {
+	return Manifest{
+		Version:   Version,
+		Database:  database,
+		BackupKey: backupKey,
+		CreatedAt: createdAt.UTC(),
+		Format:    format,
+	}
+}
+
+// WithChecksum returns copy of manifest with size and checksum of backup read from r.
+func (m Manifest) WithChecksum(r io.Reader) (Manifest, error) {
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to compute checksum: %v", err)
+	}
+	m.Size = size
+	m.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return m, nil
+}
+
+// HasTag reports whether backup is tagged with tag.
+func (m Manifest) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// Parse decodes manifest from JSON.
+func Parse(data []byte) (Manifest, error) {
+	var m Manifest
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	return m, nil
+}
+
+// Key returns key of the manifest in storage.
+func (m Manifest) Key() string {
+	return KeyFor(m.BackupKey)
+}
+
+// Marshal encodes manifest to JSON.
+func (m Manifest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// KeyFor returns key of the manifest describing backup stored under backupKey.
+func KeyFor(backupKey string) string {
+	return backupKey + Suffix
+}
+
+// IsManifestKey reports whether key belongs to a manifest rather than a backup.
+func IsManifestKey(key string) bool {
+	return strings.HasSuffix(key, Suffix)
+}
@@ -0,0 +1,142 @@
+package manifest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_New(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+
+	m := New("mydb", "mydb/2024-05-01-13-00-00-backup.dump", "custom", createdAt)
+
+	assert.Equal(t, Version, m.Version)
+	assert.Equal(t, "custom", m.Format)
+	assert.Equal(t, time.UTC, m.CreatedAt.Location())
+	assert.Equal(t, "mydb/2024-05-01-13-00-00-backup.dump.manifest.json", m.Key())
+	assert.False(t, m.Scope.IsPartial())
+}
+
+func Test_Marshal(t *testing.T) {
+	m := New("mydb", "mydb/backup.sql", "plain", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	m.Scope = Scope{
+		Schemas:       []string{"tenant_*"},
+		ExcludeTables: []string{"public.cache"},
+	}
+
+	data, err := m.Marshal()
+	require.NoError(t, err)
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "mydb/backup.sql", decoded["backupKey"])
+	assert.Equal(t, "plain", decoded["format"])
+	assert.Equal(t, "2024-05-01T10:00:00Z", decoded["createdAt"])
+	assert.Equal(t, map[string]any{
+		"schemas":       []any{"tenant_*"},
+		"excludeTables": []any{"public.cache"},
+	}, decoded["scope"])
+}
+
+func Test_WithChecksum(t *testing.T) {
+	m, err := New("mydb", "mydb/backup.sql", "plain", time.Now()).WithChecksum(strings.NewReader("dump"))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), m.Size)
+	assert.Equal(t, "b6ca0868bca6a2926b70aa1a71592038d9030fe26d4214edcfbd6cf41f2f4654", m.SHA256)
+}
+
+func Test_KeyFor(t *testing.T) {
+	assert.Equal(t, "mydb/backup.sql.manifest.json", KeyFor("mydb/backup.sql"))
+	assert.True(t, IsManifestKey(KeyFor("mydb/backup.sql")))
+	assert.False(t, IsManifestKey("mydb/backup.sql"))
+}
+
+func Test_MarshalStandby(t *testing.T) {
+	m := New("mydb", "mydb/backup.sql", "plain", time.Now())
+	m.Standby = &Standby{
+		ReplayLSN:       "0/3000148",
+		ReplayTimestamp: time.Date(2024, 5, 1, 9, 59, 58, 0, time.UTC),
+		Lag:             2 * time.Second,
+	}
+
+	data, err := m.Marshal()
+	require.NoError(t, err)
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, map[string]any{
+		"replayLsn":       "0/3000148",
+		"replayTimestamp": "2024-05-01T09:59:58Z",
+		"lag":             float64(2 * time.Second),
+	}, decoded["standby"])
+
+	m.Standby = nil
+	data, err = m.Marshal()
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "standby")
+}
+
+func Test_Parse(t *testing.T) {
+	m, err := Parse([]byte(`{
+		"version": 1,
+		"database": "mydb",
+		"backupKey": "mydb/backup.sql",
+		"createdAt": "2024-05-01T10:00:00Z",
+		"format": "custom",
+		"scope": {"excludeTableData": ["public.audit_log"]},
+		"tags": ["pre-migration-v42"],
+		"pinned": true
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, Manifest{
+		Version:   1,
+		Database:  "mydb",
+		BackupKey: "mydb/backup.sql",
+		CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Format:    "custom",
+		Scope:     Scope{ExcludeTableData: []string{"public.audit_log"}},
+		Tags:      []string{"pre-migration-v42"},
+		Pinned:    true,
+	}, m)
+	assert.True(t, m.Scope.IsPartial())
+	assert.True(t, m.HasTag("pre-migration-v42"))
+
+	_, err = Parse([]byte("{"))
+	assert.ErrorContains(t, err, "failed to parse manifest")
+}
+
+func Test_Marshal_Parse(t *testing.T) {
+	m := New("mydb", "mydb/2024-05-01-10-00-00-backup.dump", "custom", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	m.Tags = []string{TagPreRestore}
+	m, err := m.WithChecksum(strings.NewReader("PGDMP"))
+	require.NoError(t, err)
+	assert.Equal(t, "b5a26a21290c39819235a235b8ed66b3bd98ed90c8316c8949bfbb7419cac878", m.SHA256)
+
+	data, err := m.Marshal()
+	require.NoError(t, err)
+
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, m, parsed)
+}
+
+func Test_Scope_IsPartial(t *testing.T) {
+	assert.False(t, Scope{}.IsPartial())
+	assert.True(t, Scope{Schemas: []string{"tenant_a"}}.IsPartial())
+}
+
+func Test_ValidateTags(t *testing.T) {
+	assert.NoError(t, ValidateTags(nil))
+	assert.NoError(t, ValidateTags([]string{"pre-migration-v42", "release_1.2"}))
+	assert.ErrorContains(t, ValidateTags([]string{"ok", "-bad"}), `invalid tag "-bad"`)
+	assert.ErrorContains(t, ValidateTags([]string{"with space"}), `invalid tag "with space"`)
+	assert.ErrorContains(t, ValidateTags([]string{LatestVerified}), `tag "latest-verified" is reserved`)
+	assert.ErrorContains(t, ValidateTags([]string{TagPreRestore}), `tag "pre-restore" is reserved`)
+}
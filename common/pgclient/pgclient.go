@@ -0,0 +1,106 @@
+// Package pgclient finds installed versions of PostgreSQL client tools and
+// selects one compatible with a server, as used by backuper and restorer.
+package pgclient
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Client is an installed version of PostgreSQL client tools.
+type Client struct {
+	Major  int    // Major version, e.g. 16
+	BinDir string // Directory with pg_dump, empty if pg_dump is found in PATH
+}
+
+// Path returns path of program of the client, e.g. pg_dump or pg_restore.
+func (c Client) Path(program string) string {
+	if c.BinDir == "" {
+		return program
+	}
+	return filepath.Join(c.BinDir, program)
+}
+
+// clientVersion matches output of `pg_dump --version`, e.g. "pg_dump (PostgreSQL) 16.2".
+var clientVersion = regexp.MustCompile(`\(PostgreSQL\) (\d+)`)
+
+// Find returns client tools installed in directories matching glob
+// patterns, e.g. /usr/lib/postgresql/*/bin, sorted by major version.
+// pg_dump in PATH is used if none of directories contains one.
+// Version of every pg_dump is obtained by running it with --version.
+func Find(ctx context.Context, patterns []string) ([]Client, error) {
+	clients := []Client{}
+	for _, pattern := range patterns {
+		dirs, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client directory pattern %q: %v", pattern, err)
+		}
+		for _, dir := range dirs {
+			client, err := probeClient(ctx, dir)
+			if err != nil {
+				continue
+			}
+			clients = append(clients, client)
+		}
+	}
+	if len(clients) == 0 {
+		client, err := probeClient(ctx, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find pg_dump: %v", err)
+		}
+		clients = append(clients, client)
+	}
+
+	slices.SortFunc(clients, func(a, b Client) int { return a.Major - b.Major })
+	return clients, nil
+}
+
+// probeClient returns client of pg_dump in binDir.
+func probeClient(ctx context.Context, binDir string) (Client, error) {
+	client := Client{BinDir: binDir}
+	output, err := exec.CommandContext(ctx, client.Path("pg_dump"), "--version").Output()
+	if err != nil {
+		return Client{}, err
+	}
+	match := clientVersion.FindSubmatch(output)
+	if match == nil {
+		return Client{}, fmt.Errorf("unexpected pg_dump version %q", strings.TrimSpace(string(output)))
+	}
+	client.Major, err = strconv.Atoi(string(match[1]))
+	if err != nil { // coverage-ignore
+		return Client{}, err
+	}
+	return client, nil
+}
+
+// ServerMajor returns major version of server_version_num, e.g. 16 of 160002
+// and 9 of 90624.
+func ServerMajor(versionNum int) int {
+	return versionNum / 10000
+}
+
+// Select returns client able to work with server of major version.
+// pg_dump refuses to dump newer servers, and archives of a newer pg_dump
+// may not be readable by older pg_restore, so client of the same major
+// version is preferred over the closest newer one. Clients must be sorted
+// by major version, as returned by Find.
+func Select(clients []Client, major int) (Client, error) {
+	for _, client := range clients {
+		if client.Major >= major {
+			return client, nil
+		}
+	}
+
+	installed := make([]string, 0, len(clients))
+	for _, client := range clients {
+		installed = append(installed, strconv.Itoa(client.Major))
+	}
+	return Client{}, fmt.Errorf("no client tools compatible with PostgreSQL %d server, version mismatch: installed versions are %s",
+		major, strings.Join(installed, ", "))
+}
@@ -0,0 +1,57 @@
+package pgclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+)
+
+// installClient creates fake pg_dump printing version under root/version/bin.
+func installClient(t *testing.T, root, version string) string {
+	dir := filepath.Join(root, version, "bin")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	script := "#!/bin/sh\necho 'pg_dump (PostgreSQL) " + version + ".1'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pg_dump"), []byte(script), 0o755))
+	return dir
+}
+
+func Test_Find(t *testing.T) {
+	root := t.TempDir()
+	dir16 := installClient(t, root, "16")
+	dir14 := installClient(t, root, "14")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "empty", "bin"), 0o755))
+
+	clients, err := Find(context.Background(), []string{filepath.Join(root, "*", "bin")})
+	require.NoError(t, err)
+	assert.Equal(t, []Client{{Major: 14, BinDir: dir14}, {Major: 16, BinDir: dir16}}, clients)
+	assert.Equal(t, filepath.Join(dir16, "pg_dump"), clients[1].Path("pg_dump"))
+
+	_, err = Find(context.Background(), []string{"["})
+	assert.ErrorContains(t, err, "invalid client directory pattern")
+}
+
+func Test_Select(t *testing.T) {
+	clients := []Client{{Major: 14}, {Major: 16}, {Major: 17}}
+
+	client, err := Select(clients, 16)
+	require.NoError(t, err)
+	assert.Equal(t, 16, client.Major)
+
+	client, err = Select(clients, 15)
+	require.NoError(t, err)
+	assert.Equal(t, 16, client.Major)
+
+	client, err = Select(clients, ServerMajor(90624))
+	require.NoError(t, err)
+	assert.Equal(t, 14, client.Major)
+
+	_, err = Select(clients, ServerMajor(180000))
+	require.ErrorContains(t, err, "installed versions are 14, 16, 17")
+	assert.Equal(t, pgoutput.ClassVersionMismatch, pgoutput.Classify(err))
+}
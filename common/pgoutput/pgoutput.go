@@ -0,0 +1,234 @@
+// Package pgoutput parses output of PostgreSQL client programs, e.g. pg_dump and
+// pg_restore, into messages and classifies their failures.
+package pgoutput
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Severities of parsed messages.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityDetail  = "detail"
+	SeverityHint    = "hint"
+	SeverityInfo    = "info"
+)
+
+// A Class describes why a program or a database call failed.
+type Class string
+
+// Classes of failures. ClassUnknown is used for failures matching no other class.
+const (
+	ClassAuthFailed       Class = "auth_failed"
+	ClassPermissionDenied Class = "permission_denied"
+	ClassVersionMismatch  Class = "version_mismatch"
+	ClassDiskFull         Class = "disk_full"
+	ClassLockTimeout      Class = "lock_timeout"
+	ClassConnectionFailed Class = "connection_failed"
+	ClassUnknown          Class = "unknown"
+)
+
+// A Message is a single message of program output.
+type Message struct {
+	Program  string // Program which printed message, e.g. pg_dump
+	Severity string
+	Text     string
+	Code     string // SQLSTATE, if printed or known for Class
+	Object   string // Database object message is about, if known
+	Class    Class  // Class of error messages, empty for others
+}
+
+// An Output is parsed output of a program.
+type Output []Message
+
+// A rule classifies messages containing any of patterns.
+type rule struct {
+	class    Class
+	code     string
+	patterns []string
+}
+
+// rules are checked in order, so that e.g. authentication failures reported as
+// failed connections are classified as ClassAuthFailed.
+var rules = []rule{
+	{ClassAuthFailed, "28P01", []string{"password authentication failed", "authentication failed"}},
+	{ClassAuthFailed, "28000", []string{"no pg_hba.conf entry"}},
+	{ClassPermissionDenied, "42501", []string{"permission denied", "must be owner of", "must be superuser"}},
+	{ClassVersionMismatch, "", []string{"version mismatch", "unsupported version"}},
+	{ClassDiskFull, "53100", []string{"no space left on device", "could not extend file", "disk full"}},
+	{ClassLockTimeout, "55P03", []string{"lock timeout", "could not obtain lock"}},
+	{ClassConnectionFailed, "08006", []string{"connection to server", "could not connect", "connection refused", "server closed the connection"}},
+}
+
+var (
+	// linePrefix matches "pg_dump: error: ", legacy "pg_dump: [archiver (db)] " and
+	// "psql:backup.sql:12: " of scripts run by psql.
+	linePrefix = regexp.MustCompile(`^(pg_\w+|psql)(?::\S+?:\d+)?: (?:\[[^\]]*\] )?(?:(error|warning|detail|hint): )?`)
+	// sqlState matches SQLSTATE printed with verbose server errors, e.g. "ERROR:  42501: ".
+	sqlState = regexp.MustCompile(`(?:ERROR|FATAL|PANIC):\s+([0-9A-Z]{5}):`)
+	// tocEntry matches "from TOC entry 215; 1259 16386 TABLE users postgres".
+	tocEntry = regexp.MustCompile(`^from TOC entry \d+; \d+ \d+ (.+) \S+$`)
+	// objectName matches objects named in server errors.
+	objectName = regexp.MustCompile(`(?:relation|table|schema|function|sequence|database|role|type|index|view) "?([^"\s]+)"?`)
+)
+
+// Parse parses output of a program line by line. Lines which do not start with
+// program name, e.g. "Command was: ...", continue the previous message.
+// Objects of "from TOC entry" lines are attached to the following message.
+func Parse(output []byte) Output {
+	messages := Output{}
+	pendingObject := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		match := linePrefix.FindStringSubmatch(line)
+		if match == nil {
+			if len(messages) > 0 {
+				messages[len(messages)-1].Text += "\n" + line
+			} else {
+				messages = append(messages, Message{Severity: SeverityInfo, Text: line})
+			}
+			continue
+		}
+
+		text := line[len(match[0]):]
+		if toc := tocEntry.FindStringSubmatch(text); toc != nil {
+			pendingObject = toc[1]
+		}
+		severity := match[2]
+		if severity == "" {
+			severity = SeverityInfo
+			if strings.Contains(text, "ERROR:") || strings.Contains(text, "FATAL:") {
+				severity = SeverityError
+			}
+		}
+		message := Message{Program: match[1], Severity: severity, Text: text}
+		if severity == SeverityError || severity == SeverityWarning {
+			message.Object = pendingObject
+			pendingObject = ""
+			if object := objectName.FindStringSubmatch(text); object != nil && message.Object == "" {
+				message.Object = object[1]
+			}
+			if code := sqlState.FindStringSubmatch(text); code != nil {
+				message.Code = code[1]
+			}
+		}
+		if severity == SeverityError {
+			message.Class, message.Code = classify(text, message.Code)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// classify returns class of error text and its SQLSTATE, keeping code if known.
+func classify(text, code string) (Class, string) {
+	lower := strings.ToLower(text)
+	for _, r := range rules {
+		for _, pattern := range r.patterns {
+			if strings.Contains(lower, pattern) {
+				if code == "" {
+					code = r.code
+				}
+				return r.class, code
+			}
+		}
+	}
+	return ClassUnknown, code
+}
+
+// Errors returns error messages of o.
+func (o Output) Errors() Output {
+	errs := Output{}
+	for _, message := range o {
+		if message.Severity == SeverityError {
+			errs = append(errs, message)
+		}
+	}
+	return errs
+}
+
+// Class returns class of the first classified error message of o or
+// ClassUnknown if there is none.
+func (o Output) Class() Class {
+	for _, message := range o.Errors() {
+		if message.Class != ClassUnknown {
+			return message.Class
+		}
+	}
+	return ClassUnknown
+}
+
+// A CommandError is a failure of a program with its parsed output.
+type CommandError struct {
+	Program string
+	Err     error
+	Output  Output
+}
+
+// NewCommandError parses output of program failed with err.
+func NewCommandError(program string, err error, output []byte) *CommandError {
+	return &CommandError{Program: program, Err: err, Output: Parse(output)}
+}
+
+// Error returns failure of the program with its first error message
+// instead of the whole output, which is available in Output.
+func (e *CommandError) Error() string {
+	errs := e.Output.Errors()
+	if len(errs) == 0 {
+		return fmt.Sprintf("failed executing %s: %v", e.Program, e.Err)
+	}
+	return fmt.Sprintf("failed executing %s: %v: %s", e.Program, e.Err, errs[0].Text)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// pqClasses maps SQLSTATE classes and codes of server errors to Class.
+var pqClasses = map[string]Class{
+	"28":    ClassAuthFailed,
+	"42501": ClassPermissionDenied,
+	"53100": ClassDiskFull,
+	"55P03": ClassLockTimeout,
+	"08":    ClassConnectionFailed,
+}
+
+// Classify returns class of err. CommandError is classified by its output and
+// errors of lib/pq by SQLSTATE. Other errors are classified by their text.
+func Classify(err error) Class {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Output.Class()
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if class, ok := pqClasses[string(pqErr.Code)]; ok {
+			return class
+		}
+		if class, ok := pqClasses[string(pqErr.Code.Class())]; ok {
+			return class
+		}
+		return ClassUnknown
+	}
+
+	if err != nil {
+		class, _ := classify(err.Error(), "")
+		return class
+	}
+	return ClassUnknown
+}
@@ -0,0 +1,84 @@
+package pgoutput
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Parse_Restore(t *testing.T) {
+	output := []byte(`pg_restore: while PROCESSING TOC:
+pg_restore: from TOC entry 215; 1259 16386 TABLE users postgres
+pg_restore: error: could not execute query: ERROR:  relation "users" already exists
+Command was: CREATE TABLE public.users (
+    id integer
+);
+pg_restore: warning: errors ignored on restore: 1
+`)
+
+	messages := Parse(output)
+	require.Len(t, messages, 4)
+	assert.Equal(t, SeverityInfo, messages[0].Severity)
+
+	assert.Equal(t, "pg_restore", messages[2].Program)
+	assert.Equal(t, SeverityError, messages[2].Severity)
+	assert.Equal(t, "TABLE users", messages[2].Object)
+	assert.Equal(t, ClassUnknown, messages[2].Class)
+	assert.Contains(t, messages[2].Text, "Command was: CREATE TABLE public.users")
+
+	assert.Equal(t, SeverityWarning, messages[3].Severity)
+	assert.Len(t, messages.Errors(), 1)
+}
+
+func Test_Parse_Classes(t *testing.T) {
+	tests := []struct {
+		line   string
+		class  Class
+		code   string
+		object string
+	}{
+		{`pg_dump: error: connection to server at "db" (10.0.0.1), port 5432 failed: FATAL:  password authentication failed for user "app"`, ClassAuthFailed, "28P01", ""},
+		{`pg_dump: error: query failed: ERROR:  permission denied for table secrets`, ClassPermissionDenied, "42501", "secrets"},
+		{`pg_dump: error: aborting because of server version mismatch`, ClassVersionMismatch, "", ""},
+		{`pg_restore: error: unsupported version (1.16) in file header`, ClassVersionMismatch, "", ""},
+		{`pg_dump: error: could not write to output file: No space left on device`, ClassDiskFull, "53100", ""},
+		{`pg_dump: error: query failed: ERROR:  canceling statement due to lock timeout`, ClassLockTimeout, "55P03", ""},
+		{`pg_dump: error: connection to server at "db" (10.0.0.1), port 5432 failed: Connection refused`, ClassConnectionFailed, "08006", ""},
+		{`pg_dump: [archiver (db)] query failed: ERROR:  42P01: relation "audit" does not exist`, ClassUnknown, "42P01", "audit"},
+		{`psql:/tmp/backup.sql:42: ERROR:  permission denied for schema billing`, ClassPermissionDenied, "42501", "billing"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.class), func(t *testing.T) {
+			messages := Parse([]byte(tt.line))
+			require.Len(t, messages, 1)
+			assert.Equal(t, SeverityError, messages[0].Severity)
+			assert.Equal(t, tt.class, messages[0].Class)
+			assert.Equal(t, tt.code, messages[0].Code)
+			assert.Equal(t, tt.object, messages[0].Object)
+			assert.Equal(t, tt.class, messages.Class())
+		})
+	}
+}
+
+func Test_CommandError(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	err := NewCommandError("pg_dump", exitErr, []byte("pg_dump: error: query failed: ERROR:  permission denied for table secrets\npg_dump: detail: Query was: LOCK TABLE public.secrets IN ACCESS SHARE MODE\n"))
+
+	assert.Equal(t, "failed executing pg_dump: exit status 1: query failed: ERROR:  permission denied for table secrets", err.Error())
+	assert.ErrorIs(t, err, exitErr)
+	assert.Equal(t, ClassPermissionDenied, Classify(fmt.Errorf("backup failed: %w", err)))
+}
+
+func Test_Classify(t *testing.T) {
+	assert.Equal(t, ClassAuthFailed, Classify(&pq.Error{Code: "28P01"}))
+	assert.Equal(t, ClassConnectionFailed, Classify(fmt.Errorf("ping: %w", &pq.Error{Code: "08001"})))
+	assert.Equal(t, ClassLockTimeout, Classify(&pq.Error{Code: "55P03"}))
+	assert.Equal(t, ClassUnknown, Classify(&pq.Error{Code: "42P01"}))
+	assert.Equal(t, ClassConnectionFailed, Classify(errors.New("dial tcp 10.0.0.1:5432: connect: connection refused")))
+	assert.Equal(t, ClassUnknown, Classify(errors.New("unexpected EOF")))
+	assert.Equal(t, ClassUnknown, Classify(nil))
+}
@@ -0,0 +1,91 @@
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// transientS3Codes lists S3 error codes returned when the service is overloaded.
+var transientS3Codes = map[string]bool{
+	"InternalError":      true,
+	"RequestTimeout":     true,
+	"ServiceUnavailable": true,
+	"SlowDown":           true,
+}
+
+// transientGrpcCodes lists gRPC codes of failures not caused by the request itself.
+var transientGrpcCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.ResourceExhausted: true,
+	codes.Aborted:           true,
+	codes.DeadlineExceeded:  true,
+}
+
+// IsTransient reports whether err is likely to go away on retry: lost or refused
+// connections, PostgreSQL starting up or out of connections, S3 5xx and throttling,
+// unavailable core. Cancelled and timed out contexts are never transient.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return isTransientPq(pqErr)
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		code := respErr.HTTPStatusCode()
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return transientS3Codes[apiErr.ErrorCode()]
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return transientGrpcCodes[s.Code()]
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// isTransientPq reports whether PostgreSQL error is caused by server state
+// rather than the query: connection exceptions, insufficient resources
+// and shutdown or startup of the server.
+func isTransientPq(err *pq.Error) bool {
+	switch err.Code.Class() {
+	case "08", "53":
+		return true
+	}
+	switch err.Code {
+	case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// Package retry runs operations prone to transient failures with exponential backoff.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// multiplier is a growth factor of delay between attempts.
+const multiplier = 2
+
+// A Policy describes how failed operations are retried.
+// Zero Policy runs operation once.
+type Policy struct {
+	Attempts       int           // Maximum number of attempts including the first one
+	InitialBackoff time.Duration // Delay before the second attempt
+	MaxBackoff     time.Duration // Upper bound of delay between attempts
+	Jitter         float64       // Fraction of delay randomized, from 0 to 1
+
+	// Notify, if set, is called before waiting for the next attempt.
+	Notify func(err error, attempt int, delay time.Duration)
+}
+
+// Validate checks that policy values are consistent.
+func (p Policy) Validate() error {
+	if p.Attempts < 1 {
+		return fmt.Errorf("retry attempts must be positive, got %d", p.Attempts)
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("retry backoff must not be negative")
+	}
+	if p.InitialBackoff > p.MaxBackoff {
+		return fmt.Errorf("initial retry backoff %s exceeds maximum %s", p.InitialBackoff, p.MaxBackoff)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1, got %v", p.Jitter)
+	}
+	return nil
+}
+
+// Do runs op until it succeeds, fails with an error retryable does not accept,
+// runs out of attempts or ctx is done. It returns the last error of op.
+func Do(ctx context.Context, p Policy, retryable func(error) bool, op func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt >= p.Attempts || ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+
+		delay := p.jitter(p.backoff(attempt), rand.Float64())
+		if p.Notify != nil {
+			p.Notify(err, attempt, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns delay after failed attempt before jitter is applied.
+func (p Policy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= multiplier
+	}
+	return min(delay, p.MaxBackoff)
+}
+
+// jitter spreads delay over [delay*(1-Jitter), delay] by rnd from [0, 1),
+// so that restarted Pods do not hit the same service at once.
+func (p Policy) jitter(delay time.Duration, rnd float64) time.Duration {
+	return delay - time.Duration(float64(delay)*p.Jitter*rnd)
+}
@@ -0,0 +1,139 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errTransient = errors.New("transient")
+
+func isTestTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func Test_Do_RetriesTransient(t *testing.T) {
+	p := Policy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	notified := []int{}
+	p.Notify = func(err error, attempt int, delay time.Duration) {
+		notified = append(notified, attempt)
+	}
+
+	calls := 0
+	err := Do(context.Background(), p, isTestTransient, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, notified)
+}
+
+func Test_Do_StopsOnPermanent(t *testing.T) {
+	p := Policy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	calls := 0
+	err := Do(context.Background(), p, isTestTransient, func(ctx context.Context) error {
+		calls++
+		return fmt.Errorf("permanent")
+	})
+	require.ErrorContains(t, err, "permanent")
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Do_ExhaustsAttempts(t *testing.T) {
+	p := Policy{Attempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	calls := 0
+	err := Do(context.Background(), p, isTestTransient, func(ctx context.Context) error {
+		calls++
+		return errTransient
+	})
+	require.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 2, calls)
+}
+
+func Test_Do_ZeroPolicy(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{}, isTestTransient, func(ctx context.Context) error {
+		calls++
+		return errTransient
+	})
+	require.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Do_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{Attempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	p.Notify = func(err error, attempt int, delay time.Duration) {
+		cancel()
+	}
+
+	calls := 0
+	err := Do(ctx, p, isTestTransient, func(ctx context.Context) error {
+		calls++
+		return errTransient
+	})
+	require.ErrorIs(t, err, errTransient)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Backoff(t *testing.T) {
+	p := Policy{Attempts: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.5}
+
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(4))
+	assert.Equal(t, 5*time.Second, p.backoff(40))
+
+	assert.Equal(t, 4*time.Second, p.jitter(4*time.Second, 0))
+	assert.Equal(t, 3*time.Second, p.jitter(4*time.Second, 0.5))
+}
+
+func Test_Policy_Validate(t *testing.T) {
+	require.NoError(t, Policy{Attempts: 1}.Validate())
+	require.ErrorContains(t, Policy{}.Validate(), "must be positive")
+	require.ErrorContains(t, Policy{Attempts: 1, InitialBackoff: time.Minute, MaxBackoff: time.Second}.Validate(), "exceeds maximum")
+	require.ErrorContains(t, Policy{Attempts: 1, Jitter: 2}.Validate(), "between 0 and 1")
+}
+
+func s3ResponseError(code int) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: code}},
+		Err:      fmt.Errorf("api error"),
+	}}
+}
+
+func Test_IsTransient(t *testing.T) {
+	assert.True(t, IsTransient(fmt.Errorf("get object: %w", s3ResponseError(http.StatusServiceUnavailable))))
+	assert.True(t, IsTransient(s3ResponseError(http.StatusTooManyRequests)))
+	assert.False(t, IsTransient(s3ResponseError(http.StatusNotFound)))
+	assert.True(t, IsTransient(&pq.Error{Code: "53300"}))
+	assert.True(t, IsTransient(&pq.Error{Code: "57P03"}))
+	assert.False(t, IsTransient(&pq.Error{Code: "28P01"}))
+	assert.True(t, IsTransient(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}))
+	assert.False(t, IsTransient(&net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.True(t, IsTransient(fmt.Errorf("read: %w", syscall.ECONNRESET)))
+	assert.True(t, IsTransient(status.Error(codes.Unavailable, "connection refused")))
+	assert.False(t, IsTransient(status.Error(codes.InvalidArgument, "bad request")))
+	assert.False(t, IsTransient(context.DeadlineExceeded))
+	assert.False(t, IsTransient(fmt.Errorf("failed")))
+}
@@ -0,0 +1,156 @@
+// Package revision selects a backup of a database by revision, as accepted by
+// restorer in BACKUP_REVISION and by pgadapter.
+package revision
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+)
+
+// Revisions selecting backups by time of creation and their manifests.
+const (
+	Latest         = manifest.Latest         // The newest backup
+	LatestVerified = manifest.LatestVerified // The newest backup verified after dump
+	// Prefix of RFC3339 time, e.g. latest-before=2025-01-01T12:00:00Z,
+	// selecting the newest backup created not later than it.
+	LatestBefore = "latest-before="
+)
+
+// timestampPattern matches timestamps backuper names backups by, e.g. 2025-01-01-00-00-00.
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}$`)
+
+// A Backup is a backup of a database listed in storage.
+type Backup struct {
+	Key          string
+	LastModified time.Time
+	HasManifest  bool
+}
+
+// A ManifestFunc returns manifest of backup stored under key.
+// It is called only for backups with manifest and only when needed.
+type ManifestFunc func(ctx context.Context, key string) (manifest.Manifest, error)
+
+// Resolve returns key of the backup selected by revision among backups of a database:
+//   - a non-negative number selects backup by index, 0 is the newest;
+//   - Latest selects the newest backup;
+//   - LatestVerified selects the newest backup verified after dump;
+//   - LatestBefore followed by RFC3339 time selects the newest backup
+//     created not later than it, by time in manifest or, for backups without
+//     one, by time of upload;
+//   - a timestamp, e.g. 2025-01-01-00-00-00, selects backup created at it;
+//   - a value containing "/" is a key of one of backups;
+//   - anything else is a tag, the newest backup tagged with it is selected.
+//
+// Pre-restore snapshots, tagged with manifest.TagPreRestore, are skipped by
+// index, Latest, LatestVerified and LatestBefore, as they are not backups
+// made by schedule. They are still selected by timestamp, key or tag.
+//
+// Backups are ordered by time of upload, so that order of backups does not matter.
+func Resolve(ctx context.Context, revision string, backups []Backup, getManifest ManifestFunc) (string, error) {
+	err := Validate(revision)
+	if err != nil {
+		return "", err
+	}
+	backups = sorted(backups)
+
+	index, err := strconv.Atoi(revision)
+	byIndex := err == nil && index >= 0
+
+	// matches reports whether backup is selected, m is nil for backups without manifest.
+	var matches func(b Backup, m *manifest.Manifest) bool
+	skipSnapshots, needsManifest := true, true
+	switch {
+	case byIndex:
+		// Called once for every backup which is not skipped.
+		matches = func(Backup, *manifest.Manifest) bool {
+			index--
+			return index < 0
+		}
+	case revision == Latest:
+		matches = func(Backup, *manifest.Manifest) bool { return true }
+	case revision == LatestVerified:
+		matches = func(_ Backup, m *manifest.Manifest) bool { return m != nil && m.Verified }
+	case strings.HasPrefix(revision, LatestBefore):
+		before, _ := parseLatestBefore(revision) // validated above
+		matches = func(b Backup, m *manifest.Manifest) bool {
+			createdAt := b.LastModified
+			if m != nil && !m.CreatedAt.IsZero() {
+				createdAt = m.CreatedAt
+			}
+			return !createdAt.After(before)
+		}
+	case timestampPattern.MatchString(revision):
+		matches = func(b Backup, _ *manifest.Manifest) bool {
+			return strings.HasPrefix(path.Base(b.Key), revision+"-backup")
+		}
+		skipSnapshots, needsManifest = false, false
+	case strings.Contains(revision, "/"):
+		matches = func(b Backup, _ *manifest.Manifest) bool { return b.Key == revision }
+		skipSnapshots, needsManifest = false, false
+	default:
+		matches = func(_ Backup, m *manifest.Manifest) bool { return m != nil && m.HasTag(revision) }
+		skipSnapshots = false
+	}
+
+	available := 0
+	for _, backup := range backups {
+		var m *manifest.Manifest
+		if needsManifest && backup.HasManifest {
+			backupManifest, err := getManifest(ctx, backup.Key)
+			if err != nil {
+				return "", err
+			}
+			m = &backupManifest
+		}
+		if skipSnapshots && m != nil && m.HasTag(manifest.TagPreRestore) {
+			continue
+		}
+		available++
+		if matches(backup, m) {
+			return backup.Key, nil
+		}
+	}
+	if byIndex {
+		return "", fmt.Errorf("revision %s is out of range, available backups: %d", revision, available)
+	}
+	return "", fmt.Errorf("no backup matches revision %q", revision)
+}
+
+// Validate returns error if revision cannot be resolved regardless of
+// backups in storage, e.g. if it is empty or time of LatestBefore is malformed.
+func Validate(revision string) error {
+	if revision == "" {
+		return fmt.Errorf("revision is required")
+	}
+	if strings.HasPrefix(revision, LatestBefore) {
+		_, err := parseLatestBefore(revision)
+		return err
+	}
+	return nil
+}
+
+// sorted returns copy of backups, newest first.
+func sorted(backups []Backup) []Backup {
+	backups = append([]Backup(nil), backups...)
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[j].LastModified.Before(backups[i].LastModified)
+	})
+	return backups
+}
+
+// parseLatestBefore returns time of LatestBefore revision.
+func parseLatestBefore(revision string) (time.Time, error) {
+	before, err := time.Parse(time.RFC3339, strings.TrimPrefix(revision, LatestBefore))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid revision %q: expected %s<RFC3339 time>: %v", revision, LatestBefore, err)
+	}
+	return before, nil
+}
@@ -0,0 +1,90 @@
+package revision
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/revision/revisiontest"
+)
+
+// stored returns revisiontest.Backups and function returning their manifests.
+func stored() ([]Backup, ManifestFunc) {
+	backups := []Backup{}
+	manifests := map[string]manifest.Manifest{}
+	for _, b := range revisiontest.Backups {
+		backups = append(backups, Backup{Key: b.Key, LastModified: b.LastModified, HasManifest: b.Manifest != nil})
+		if b.Manifest != nil {
+			manifests[b.Key] = *b.Manifest
+		}
+	}
+	return backups, func(_ context.Context, key string) (manifest.Manifest, error) {
+		return manifests[key], nil
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	backups, getManifest := stored()
+
+	for revision, expected := range revisiontest.Resolved {
+		key, err := Resolve(context.Background(), revision, backups, getManifest)
+		require.NoError(t, err, revision)
+		assert.Equal(t, expected, key, revision)
+	}
+	for revision, expected := range revisiontest.Unresolved {
+		_, err := Resolve(context.Background(), revision, backups, getManifest)
+		assert.ErrorContains(t, err, expected, revision)
+	}
+}
+
+func Test_Resolve_ManifestError(t *testing.T) {
+	backups, _ := stored()
+	failing := func(context.Context, string) (manifest.Manifest, error) {
+		return manifest.Manifest{}, fmt.Errorf("access denied")
+	}
+
+	_, err := Resolve(context.Background(), LatestVerified, backups, failing)
+	assert.ErrorContains(t, err, "access denied")
+
+	// Manifests are not read if revision does not depend on them.
+	key, err := Resolve(context.Background(), "2025-01-04-00-00-00", backups, failing)
+	require.NoError(t, err)
+	assert.Equal(t, "db/2025-01-04-00-00-00-backup.dump", key)
+}
+
+func Test_Resolve_SkipsSnapshot(t *testing.T) {
+	backups := []Backup{
+		{Key: "db/2025-01-01-00-00-00-backup.dump", LastModified: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Key: "db/2025-01-02-00-00-00-backup.dump", LastModified: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), HasManifest: true},
+	}
+	read := []string{}
+	getManifest := func(_ context.Context, key string) (manifest.Manifest, error) {
+		read = append(read, key)
+		return manifest.Manifest{Tags: []string{manifest.TagPreRestore}}, nil
+	}
+
+	// A snapshot uploaded after the backup does not replace it as the latest.
+	key, err := Resolve(context.Background(), Latest, backups, getManifest)
+	require.NoError(t, err)
+	assert.Equal(t, "db/2025-01-01-00-00-00-backup.dump", key)
+	key, err = Resolve(context.Background(), "0", backups, getManifest)
+	require.NoError(t, err)
+	assert.Equal(t, "db/2025-01-01-00-00-00-backup.dump", key)
+	assert.Equal(t, []string{"db/2025-01-02-00-00-00-backup.dump", "db/2025-01-02-00-00-00-backup.dump"}, read)
+
+	_, err = Resolve(context.Background(), "1", backups, getManifest)
+	assert.ErrorContains(t, err, "revision 1 is out of range, available backups: 1")
+}
+
+func Test_Validate(t *testing.T) {
+	for _, revision := range []string{"0", Latest, LatestVerified, LatestBefore + "2025-01-01T00:00:00Z", "nightly", "db/backup.dump"} {
+		assert.NoError(t, Validate(revision), revision)
+	}
+	assert.ErrorContains(t, Validate(""), "revision is required")
+	assert.ErrorContains(t, Validate(LatestBefore+"yesterday"), `invalid revision "latest-before=yesterday"`)
+}
@@ -0,0 +1,87 @@
+// Package revisiontest provides backups and revisions every caller of
+// revision.Resolve is tested against, so that they resolve revisions alike.
+package revisiontest
+
+import (
+	"time"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+)
+
+// A Stored is a backup stored in a bucket with its manifest.
+type Stored struct {
+	Key          string
+	LastModified time.Time
+	Manifest     *manifest.Manifest // nil for backups without one
+}
+
+// Database is the database Backups belong to.
+const Database = "db"
+
+// Backups are stored backups of Database, oldest first.
+// The newest one is a pre-restore snapshot, the one before it has no manifest.
+var Backups = []Stored{
+	{
+		Key:          "db/2025-01-01-00-00-00-backup.dump",
+		LastModified: time.Date(2025, 1, 1, 0, 1, 0, 0, time.UTC),
+		Manifest: &manifest.Manifest{
+			CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			Tags:      []string{"pre-migration"},
+			Verified:  true,
+		},
+	},
+	{
+		Key:          "db/2025-01-02-00-00-00-backup.sql",
+		LastModified: time.Date(2025, 1, 2, 0, 1, 0, 0, time.UTC),
+		Manifest: &manifest.Manifest{
+			CreatedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+			Tags:      []string{"pre-migration", "nightly"},
+		},
+	},
+	{
+		Key:          "db/2025-01-03-00-00-00-backup.dump",
+		LastModified: time.Date(2025, 1, 3, 0, 1, 0, 0, time.UTC),
+	},
+	{
+		Key:          "db/2025-01-04-00-00-00-backup.dump",
+		LastModified: time.Date(2025, 1, 4, 0, 1, 0, 0, time.UTC),
+		Manifest: &manifest.Manifest{
+			CreatedAt: time.Date(2025, 1, 4, 0, 0, 0, 0, time.UTC),
+			Tags:      []string{manifest.TagPreRestore},
+		},
+	},
+}
+
+// Resolved maps revisions to keys of Backups they select.
+var Resolved = map[string]string{
+	"0":                                  "db/2025-01-03-00-00-00-backup.dump",
+	"2":                                  "db/2025-01-01-00-00-00-backup.dump",
+	"latest":                             "db/2025-01-03-00-00-00-backup.dump",
+	"latest-verified":                    "db/2025-01-01-00-00-00-backup.dump",
+	"pre-migration":                      "db/2025-01-02-00-00-00-backup.sql",
+	"nightly":                            "db/2025-01-02-00-00-00-backup.sql",
+	"2025-01-02-00-00-00":                "db/2025-01-02-00-00-00-backup.sql",
+	"db/2025-01-01-00-00-00-backup.dump": "db/2025-01-01-00-00-00-backup.dump",
+	// Times in manifests are used, upload time otherwise.
+	"latest-before=2025-01-02T00:00:30Z":      "db/2025-01-02-00-00-00-backup.sql",
+	"latest-before=2025-01-03T00:00:30Z":      "db/2025-01-02-00-00-00-backup.sql",
+	"latest-before=2025-01-03T00:01:00Z":      "db/2025-01-03-00-00-00-backup.dump",
+	"latest-before=2025-01-01T03:00:00+03:00": "db/2025-01-01-00-00-00-backup.dump",
+	// Snapshots are skipped unless selected explicitly.
+	"latest-before=2025-01-05T00:00:00Z": "db/2025-01-03-00-00-00-backup.dump",
+	"pre-restore":                        "db/2025-01-04-00-00-00-backup.dump",
+	"2025-01-04-00-00-00":                "db/2025-01-04-00-00-00-backup.dump",
+	"db/2025-01-04-00-00-00-backup.dump": "db/2025-01-04-00-00-00-backup.dump",
+}
+
+// Unresolved maps revisions selecting none of Backups to their errors.
+var Unresolved = map[string]string{
+	"":                                      "revision is required",
+	"3":                                     "revision 3 is out of range, available backups: 3",
+	"unknown-tag":                           `no backup matches revision "unknown-tag"`,
+	"2024-12-31-00-00-00":                   `no backup matches revision "2024-12-31-00-00-00"`,
+	"db/missing-backup.dump":                `no backup matches revision "db/missing-backup.dump"`,
+	"other/2025-01-01-00-00-00-backup.dump": `no backup matches revision "other/2025-01-01-00-00-00-backup.dump"`,
+	"latest-before=2024-12-31T00:00:00Z":    `no backup matches revision "latest-before=2024-12-31T00:00:00Z"`,
+	"latest-before=2025-01-01":              `invalid revision "latest-before=2025-01-01": expected latest-before=<RFC3339 time>`,
+}
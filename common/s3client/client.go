@@ -0,0 +1,111 @@
+// Package s3client connects to s3-compatible storage.
+//
+// Unlike s3base it allows to configure region, addressing style, TLS and
+// credentials obtained with web identity.
+package s3client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// A Config stores parameters to connect to s3-compatible storage.
+//
+// Credentials are resolved in the following order: static AccessKey and SecretKey,
+// AssumeRoleWithWebIdentity with RoleARN and WebIdentityTokenFile,
+// default AWS credential chain (environment, IRSA, instance profile etc.).
+type Config struct {
+	Endpoint             string // s3-api endpoint, e.g. https://example.com:443
+	AccessKey            string
+	SecretKey            string
+	RoleARN              string // IAM role assumed with web identity token
+	WebIdentityTokenFile string // Path to web identity token, e.g. projected service account token
+	RoleSessionName      string
+	Region               string // must match your aws-region or might be fictious for other solutions
+	ForcePathStyle       bool   // Path-style addressing, required by most self-hosted solutions
+	CAFile               string // PEM-encoded CA bundle to verify server certificate
+	InsecureSkipVerify   bool   // Disables server certificate verification
+	Secure               bool   // TLS/SSL Encryption
+}
+
+// New configures and instantiates s3-client according to cc.
+func New(ctx context.Context, cc Config) (*s3.Client, error) {
+	tlsConfig, err := buildTLSConfig(cc)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.TLSClientConfig = tlsConfig
+	})
+
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(cc.Region),
+		config.WithHTTPClient(httpClient),
+	}
+	if cc.AccessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cc.AccessKey, cc.SecretKey, ""),
+		))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cc.AccessKey == "" && cc.RoleARN != "" {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+			sts.NewFromConfig(cfg),
+			cc.RoleARN,
+			stscreds.IdentityTokenFile(cc.WebIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = cc.RoleSessionName
+			},
+		))
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.UsePathStyle = cc.ForcePathStyle
+		o.BaseEndpoint = aws.String(cc.Endpoint)
+	})
+
+	return client, nil
+}
+
+// buildTLSConfig returns TLS configuration trusting system roots and CAFile if specified.
+// Certificate verification is skipped when InsecureSkipVerify is set or
+// encryption is not requested.
+func buildTLSConfig(cc Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cc.InsecureSkipVerify || !cc.Secure,
+	}
+	if cc.CAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(cc.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil { // coverage-ignore
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", cc.CAFile)
+	}
+	tlsConfig.RootCAs = pool
+
+	return tlsConfig, nil
+}
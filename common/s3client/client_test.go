@@ -0,0 +1,112 @@
+package s3client
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BuildTLSConfig_Insecure(t *testing.T) {
+	tlsConfig, err := buildTLSConfig(Config{Secure: false})
+	require.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+
+	tlsConfig, err = buildTLSConfig(Config{Secure: true, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+}
+
+func Test_BuildTLSConfig_Secure(t *testing.T) {
+	tlsConfig, err := buildTLSConfig(Config{Secure: true})
+	require.NoError(t, err)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.RootCAs)
+}
+
+func Test_BuildTLSConfig_CAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0600))
+
+	tlsConfig, err := buildTLSConfig(Config{Secure: true, CAFile: caFile})
+	require.NoError(t, err)
+	require.NotNil(t, tlsConfig.RootCAs)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+}
+
+func Test_BuildTLSConfig_MissingCAFile(t *testing.T) {
+	_, err := buildTLSConfig(Config{Secure: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	require.ErrorContains(t, err, "failed to read CA file")
+}
+
+func Test_BuildTLSConfig_InvalidCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+
+	_, err := buildTLSConfig(Config{Secure: true, CAFile: caFile})
+	require.ErrorContains(t, err, "no certificates found")
+}
+
+func Test_New(t *testing.T) {
+	client, err := New(context.Background(), Config{
+		Endpoint:       "https://s3.example.com",
+		AccessKey:      "key",
+		SecretKey:      "secret",
+		Region:         "eu-central-1",
+		ForcePathStyle: true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "eu-central-1", client.Options().Region)
+	assert.True(t, client.Options().UsePathStyle)
+	assert.Equal(t, "https://s3.example.com", *client.Options().BaseEndpoint)
+}
+
+func Test_New_StaticCredentials(t *testing.T) {
+	client, err := New(context.Background(), Config{
+		Endpoint:  "https://s3.example.com",
+		AccessKey: "key",
+		SecretKey: "secret",
+		RoleARN:   "arn:aws:iam::123456789012:role/adapter",
+	})
+	require.NoError(t, err)
+
+	creds, err := client.Options().Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "key", creds.AccessKeyID)
+	assert.Equal(t, "secret", creds.SecretAccessKey)
+}
+
+func Test_New_WebIdentity(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("jwt"), 0600))
+
+	client, err := New(context.Background(), Config{
+		Endpoint:             "https://s3.example.com",
+		Region:               "eu-central-1",
+		RoleARN:              "arn:aws:iam::123456789012:role/adapter",
+		WebIdentityTokenFile: tokenFile,
+		RoleSessionName:      "session",
+	})
+	require.NoError(t, err)
+
+	cache, ok := client.Options().Credentials.(*aws.CredentialsCache)
+	require.True(t, ok)
+	assert.True(t, cache.IsCredentialsProvider(&stscreds.WebIdentityRoleProvider{}))
+}
@@ -2,9 +2,17 @@
 package config
 
 import (
+	"cmp"
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v11"
+
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/common/revision"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/restorer"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/storage"
 )
 
 // A Config stores configuraton.
@@ -16,12 +24,88 @@ type Config struct {
 	DbName       string `env:"DB_NAME,required,notEmpty"`
 	CoreAddr     string `env:"CORE_ADDR,required,notEmpty"` // Uri of an Kubernetes Operator core
 	S3Endpoint   string `env:"S3_ENDPOINT,required,notEmpty"`
-	S3AccessKey  string `env:"S3_ACCESS_KEY,required,notEmpty,unset"`
-	S3SecretKey  string `env:"S3_SECRET_KEY,required,notEmpty,unset"`
+	S3AccessKey  string `env:"S3_ACCESS_KEY,unset"` // Default AWS credential chain is used if empty
+	S3SecretKey  string `env:"S3_SECRET_KEY,unset"`
 	S3BucketName string `env:"S3_BUCKET_NAME,required,notEmpty"`
 
-	BackupRevision string `env:"BACKUP_REVISION,required,notEmpty"`
-	Secure         bool   `env:"SECURE" envDefault:"false"` // TLS/SSL Encryption
+	BackupRevision string `env:"BACKUP_REVISION,required,notEmpty"` // See revision.Resolve for accepted values
+	Secure         bool   `env:"SECURE" envDefault:"false"`         // TLS/SSL Encryption
+
+	ScratchDir     string `env:"SCRATCH_DIR" envDefault:"/tmp"` // Directory for downloaded backup and snapshot
+	VerifyChecksum bool   `env:"VERIFY_CHECKSUM" envDefault:"true"`
+
+	SourceDbName   string `env:"SOURCE_DB_NAME"` // Name of the backed up database, DbName is used if empty
+	CreateDatabase bool   `env:"CREATE_DATABASE" envDefault:"false"`
+	AllowOverwrite bool   `env:"ALLOW_OVERWRITE" envDefault:"false"` // Allow restoring onto a non-empty database
+
+	RestoreMode         string        `env:"RESTORE_MODE" envDefault:"plain"`         // plain, single-transaction or swap
+	PreRestoreRetention time.Duration `env:"PRE_RESTORE_RETENTION" envDefault:"72h"`  // Period databases replaced in swap mode are kept for
+	PreRestoreSnapshot  bool          `env:"PRE_RESTORE_SNAPSHOT" envDefault:"false"` // Upload dump of target database before restoring
+
+	// Timeouts of the whole restore and its phases. Zero disables timeout.
+	RestoreTimeout   time.Duration `env:"RESTORE_TIMEOUT" envDefault:"0"`
+	DownloadTimeout  time.Duration `env:"DOWNLOAD_TIMEOUT" envDefault:"0"`
+	PgRestoreTimeout time.Duration `env:"PG_RESTORE_TIMEOUT" envDefault:"0"`
+
+	// Retries of connecting to database, S3 requests and reporting to core.
+	// Delay between attempts doubles from RetryInitialBackoff up to RetryMaxBackoff.
+	RetryAttempts       int           `env:"RETRY_ATTEMPTS" envDefault:"3"` // 1 disables retries
+	RetryInitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF" envDefault:"1s"`
+	RetryMaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF" envDefault:"30s"`
+	RetryJitter         float64       `env:"RETRY_JITTER" envDefault:"0.2"` // Fraction of delay randomized
+
+	// Comma-separated filters of restored objects.
+	RestoreSchemas        []string `env:"RESTORE_SCHEMAS"`
+	RestoreExcludeSchemas []string `env:"RESTORE_EXCLUDE_SCHEMAS"`
+	RestoreTables         []string `env:"RESTORE_TABLES"` // Table or schema.table names
+	RestoreExcludeTables  []string `env:"RESTORE_EXCLUDE_TABLES"`
+	RestoreSections       []string `env:"RESTORE_SECTIONS"` // pre-data, data or post-data
+	DataOnly              bool     `env:"DATA_ONLY" envDefault:"false"`
+	SchemaOnly            bool     `env:"SCHEMA_ONLY" envDefault:"false"`
+
+	// Comma-separated glob patterns of directories with installed client tools.
+	// pg_restore, psql and pg_dump matching version of the server are chosen
+	// among them, tools in PATH are used if none is found.
+	PgClientDirs []string `env:"PG_CLIENT_DIRS" envDefault:"/usr/lib/postgresql/*/bin,/usr/libexec/postgresql*"`
+
+	// Steps run on DbName after backup is applied.
+	PostRestoreOwner          string   `env:"POST_RESTORE_OWNER"`                   // Role restored objects are re-assigned to
+	PostRestoreGrants         []string `env:"POST_RESTORE_GRANTS" envSeparator:";"` // Semicolon-separated GRANT templates
+	PostRestoreResetSequences bool     `env:"POST_RESTORE_RESET_SEQUENCES" envDefault:"false"`
+	PostRestoreSQLDir         string   `env:"POST_RESTORE_SQL_DIR"` // Directory with *.sql files, e.g. a mounted ConfigMap
+	PostRestoreAnalyze        string   `env:"POST_RESTORE_ANALYZE"` // analyze or vacuum-analyze
+
+	// OTLP/gRPC endpoint traces are exported to. Tracing is disabled if empty.
+	OtlpEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	// W3C trace context of scheduler request which created Job.
+	TraceParent string `env:"TRACEPARENT"`
+	TraceState  string `env:"TRACESTATE"`
+
+	S3Region             string `env:"S3_REGION" envDefault:"us-east-1"`
+	S3ForcePathStyle     bool   `env:"S3_FORCE_PATH_STYLE" envDefault:"true"`
+	S3CAFile             string `env:"S3_CA_FILE"` // PEM-encoded CA bundle
+	S3InsecureSkipVerify bool   `env:"S3_INSECURE_SKIP_VERIFY" envDefault:"false"`
+
+	S3RoleARN              string `env:"S3_ROLE_ARN"` // Role assumed with web identity if static keys are not set
+	S3WebIdentityTokenFile string `env:"S3_WEB_IDENTITY_TOKEN_FILE"`
+	S3RoleSessionName      string `env:"S3_ROLE_SESSION_NAME" envDefault:"oiler-restorer"`
+
+	// Secondary s3-compatible storage used when the primary one is unreachable.
+	// Fallback is disabled unless ReplicaS3Endpoint is set.
+	ReplicaS3Endpoint   string `env:"REPLICA_S3_ENDPOINT"`
+	ReplicaS3AccessKey  string `env:"REPLICA_S3_ACCESS_KEY,unset"`
+	ReplicaS3SecretKey  string `env:"REPLICA_S3_SECRET_KEY,unset"`
+	ReplicaS3BucketName string `env:"REPLICA_S3_BUCKET_NAME"`
+	ReplicaS3Region     string `env:"REPLICA_S3_REGION" envDefault:"us-east-1"`
+	ReplicaSecure       bool   `env:"REPLICA_SECURE" envDefault:"false"` // TLS/SSL Encryption
+	ReplicaS3CAFile     string `env:"REPLICA_S3_CA_FILE"`                // PEM-encoded CA bundle
+
+	// Options of the secondary storage falling back to the primary's ones if unset.
+	ReplicaS3ForcePathStyle       *bool  `env:"REPLICA_S3_FORCE_PATH_STYLE"`
+	ReplicaS3InsecureSkipVerify   *bool  `env:"REPLICA_S3_INSECURE_SKIP_VERIFY"`
+	ReplicaS3RoleARN              string `env:"REPLICA_S3_ROLE_ARN"`
+	ReplicaS3WebIdentityTokenFile string `env:"REPLICA_S3_WEB_IDENTITY_TOKEN_FILE"`
+	ReplicaS3RoleSessionName      string `env:"REPLICA_S3_ROLE_SESSION_NAME"`
 }
 
 // GetConfig reads environment variables, validates them and return Config object or
@@ -32,15 +116,201 @@ func GetConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	err = cfg.validate()
+	if err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
 
+// validate checks dependencies between optional variables.
+func (c Config) validate() error {
+	if (c.S3AccessKey == "") != (c.S3SecretKey == "") {
+		return fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY must be set together")
+	}
+	if c.S3RoleARN != "" && c.S3WebIdentityTokenFile == "" {
+		return fmt.Errorf("S3_WEB_IDENTITY_TOKEN_FILE is required when S3_ROLE_ARN is set")
+	}
+
+	err := revision.Validate(c.BackupRevision)
+	if err != nil {
+		return fmt.Errorf("BACKUP_REVISION: %v", err)
+	}
+
+	err = c.RestoreOptions().Validate()
+	if err != nil {
+		return err
+	}
+	err = c.RetryPolicy().Validate()
+	if err != nil {
+		return err
+	}
+	if c.RestoreTimeout < 0 || c.DownloadTimeout < 0 || c.PgRestoreTimeout < 0 {
+		return fmt.Errorf("RESTORE_TIMEOUT, DOWNLOAD_TIMEOUT and PG_RESTORE_TIMEOUT must not be negative")
+	}
+
+	if c.FallbackEnabled() {
+		if c.ReplicaS3BucketName == "" {
+			return fmt.Errorf("REPLICA_S3_BUCKET_NAME is required when REPLICA_S3_ENDPOINT is set")
+		}
+		if (c.ReplicaS3AccessKey == "") != (c.ReplicaS3SecretKey == "") {
+			return fmt.Errorf("REPLICA_S3_ACCESS_KEY and REPLICA_S3_SECRET_KEY must be set together")
+		}
+		replica := c.ReplicaStorageConfig()
+		if replica.RoleARN != "" && replica.WebIdentityTokenFile == "" {
+			return fmt.Errorf("REPLICA_S3_WEB_IDENTITY_TOKEN_FILE is required when REPLICA_S3_ROLE_ARN is set")
+		}
+	}
+
+	return nil
+}
+
+// SourceDatabase returns name of the backed up database.
+// It is used as a prefix of backups in storage.
+func (c Config) SourceDatabase() string {
+	if c.SourceDbName != "" {
+		return c.SourceDbName
+	}
+	return c.DbName
+}
+
+// RestoreOptions returns options describing how backup is applied to DbName.
+func (c Config) RestoreOptions() restorer.Options {
+	return restorer.Options{
+		CreateDatabase:      c.CreateDatabase,
+		AllowOverwrite:      c.AllowOverwrite,
+		Mode:                c.RestoreMode,
+		PreRestoreRetention: c.PreRestoreRetention,
+		Schemas:             c.RestoreSchemas,
+		ExcludeSchemas:      c.RestoreExcludeSchemas,
+		Tables:              c.RestoreTables,
+		ExcludeTables:       c.RestoreExcludeTables,
+		DataOnly:            c.DataOnly,
+		SchemaOnly:          c.SchemaOnly,
+		Sections:            c.RestoreSections,
+		PostRestore: restorer.PostRestoreOptions{
+			Owner:          c.PostRestoreOwner,
+			Grants:         c.PostRestoreGrants,
+			ResetSequences: c.PostRestoreResetSequences,
+			SQLDir:         c.PostRestoreSQLDir,
+			Analyze:        c.PostRestoreAnalyze,
+		},
+		Retry: c.RetryPolicy(),
+	}
+}
+
+// RetryPolicy returns policy of retrying operations failed with transient errors.
+func (c Config) RetryPolicy() retry.Policy {
+	return retry.Policy{
+		Attempts:       c.RetryAttempts,
+		InitialBackoff: c.RetryInitialBackoff,
+		MaxBackoff:     c.RetryMaxBackoff,
+		Jitter:         c.RetryJitter,
+	}
+}
+
+// DownloadOptions returns options describing how downloaded backups are checked.
+func (c Config) DownloadOptions() storage.DownloadOptions {
+	return storage.DownloadOptions{
+		VerifyChecksum: c.VerifyChecksum,
+		Retry:          c.RetryPolicy(),
+	}
+}
+
+// UploadOptions returns options describing how pre-restore snapshots are uploaded.
+func (c Config) UploadOptions() storage.UploadOptions {
+	return storage.UploadOptions{
+		Retry: c.RetryPolicy(),
+	}
+}
+
+// StorageConfig returns parameters to connect to the primary storage.
+func (c Config) StorageConfig() s3client.Config {
+	return s3client.Config{
+		Endpoint:             c.S3Endpoint,
+		AccessKey:            c.S3AccessKey,
+		SecretKey:            c.S3SecretKey,
+		RoleARN:              c.S3RoleARN,
+		WebIdentityTokenFile: c.S3WebIdentityTokenFile,
+		RoleSessionName:      c.S3RoleSessionName,
+		Region:               c.S3Region,
+		ForcePathStyle:       c.S3ForcePathStyle,
+		CAFile:               c.S3CAFile,
+		InsecureSkipVerify:   c.S3InsecureSkipVerify,
+		Secure:               c.Secure,
+	}
+}
+
+// ReplicaStorageConfig returns parameters to connect to the secondary storage.
+// Addressing, certificate verification and role options fall back to the
+// primary storage ones if unset, CA bundle does not.
+// Role is assumed only if replica keys are not set.
+func (c Config) ReplicaStorageConfig() s3client.Config {
+	cc := s3client.Config{
+		Endpoint:             c.ReplicaS3Endpoint,
+		AccessKey:            c.ReplicaS3AccessKey,
+		SecretKey:            c.ReplicaS3SecretKey,
+		RoleARN:              cmp.Or(c.ReplicaS3RoleARN, c.S3RoleARN),
+		WebIdentityTokenFile: cmp.Or(c.ReplicaS3WebIdentityTokenFile, c.S3WebIdentityTokenFile),
+		RoleSessionName:      cmp.Or(c.ReplicaS3RoleSessionName, c.S3RoleSessionName),
+		Region:               c.ReplicaS3Region,
+		ForcePathStyle:       c.S3ForcePathStyle,
+		CAFile:               c.ReplicaS3CAFile,
+		InsecureSkipVerify:   c.S3InsecureSkipVerify,
+		Secure:               c.ReplicaSecure,
+	}
+	if c.ReplicaS3ForcePathStyle != nil {
+		cc.ForcePathStyle = *c.ReplicaS3ForcePathStyle
+	}
+	if c.ReplicaS3InsecureSkipVerify != nil {
+		cc.InsecureSkipVerify = *c.ReplicaS3InsecureSkipVerify
+	}
+	return cc
+}
+
+// FallbackEnabled reports whether backup might be downloaded from a secondary storage.
+func (c Config) FallbackEnabled() bool {
+	return c.ReplicaS3Endpoint != ""
+}
+
 // String return config values as string.
 func (c Config) String() string {
+	replica := c.ReplicaStorageConfig()
 	return fmt.Sprintf("{DbHost: %s, DbPort: %s, DbUser: %s, DbPassword: <unset>, DbName: %s, "+
 		"CoreAddr: %s, S3Endpoint: %s, S3AccessKey: <unset>, S3SecretKey: <unset>, S3BucketName: %s, "+
-		"backupRevision: %s, Secure: %t}",
+		"backupRevision: %s, Secure: %t, ScratchDir: %s, VerifyChecksum: %t, "+
+		"SourceDbName: %s, CreateDatabase: %t, AllowOverwrite: %t, "+
+		"RestoreMode: %s, PreRestoreRetention: %s, PreRestoreSnapshot: %t, "+
+		"RestoreTimeout: %s, DownloadTimeout: %s, PgRestoreTimeout: %s, "+
+		"RetryAttempts: %d, RetryInitialBackoff: %s, RetryMaxBackoff: %s, RetryJitter: %v, "+
+		"RestoreSchemas: %v, RestoreExcludeSchemas: %v, RestoreTables: %v, RestoreExcludeTables: %v, "+
+		"RestoreSections: %v, DataOnly: %t, SchemaOnly: %t, PgClientDirs: %v, "+
+		"PostRestoreOwner: %s, PostRestoreGrants: %v, PostRestoreResetSequences: %t, "+
+		"PostRestoreSQLDir: %s, PostRestoreAnalyze: %s, "+
+		"OtlpEndpoint: %s, TraceParent: %s, TraceState: %s, "+
+		"S3Region: %s, S3ForcePathStyle: %t, S3CAFile: %s, S3InsecureSkipVerify: %t, "+
+		"S3RoleARN: %s, S3WebIdentityTokenFile: %s, S3RoleSessionName: %s, "+
+		"ReplicaS3Endpoint: %s, ReplicaS3AccessKey: <unset>, ReplicaS3SecretKey: <unset>, ReplicaS3BucketName: %s, "+
+		"ReplicaS3Region: %s, ReplicaSecure: %t, ReplicaS3CAFile: %s, "+
+		"ReplicaS3ForcePathStyle: %t, ReplicaS3InsecureSkipVerify: %t, "+
+		"ReplicaS3RoleARN: %s, ReplicaS3WebIdentityTokenFile: %s, ReplicaS3RoleSessionName: %s}",
 		c.DbHost, c.DbPort, c.DbUser, c.DbName,
 		c.CoreAddr, c.S3Endpoint, c.S3BucketName,
-		c.BackupRevision, c.Secure)
+		c.BackupRevision, c.Secure, c.ScratchDir, c.VerifyChecksum,
+		c.SourceDbName, c.CreateDatabase, c.AllowOverwrite,
+		c.RestoreMode, c.PreRestoreRetention, c.PreRestoreSnapshot,
+		c.RestoreTimeout, c.DownloadTimeout, c.PgRestoreTimeout,
+		c.RetryAttempts, c.RetryInitialBackoff, c.RetryMaxBackoff, c.RetryJitter,
+		c.RestoreSchemas, c.RestoreExcludeSchemas, c.RestoreTables, c.RestoreExcludeTables,
+		c.RestoreSections, c.DataOnly, c.SchemaOnly, c.PgClientDirs,
+		c.PostRestoreOwner, c.PostRestoreGrants, c.PostRestoreResetSequences,
+		c.PostRestoreSQLDir, c.PostRestoreAnalyze,
+		c.OtlpEndpoint, c.TraceParent, c.TraceState,
+		c.S3Region, c.S3ForcePathStyle, c.S3CAFile, c.S3InsecureSkipVerify,
+		c.S3RoleARN, c.S3WebIdentityTokenFile, c.S3RoleSessionName,
+		c.ReplicaS3Endpoint, c.ReplicaS3BucketName,
+		c.ReplicaS3Region, c.ReplicaSecure, c.ReplicaS3CAFile,
+		replica.ForcePathStyle, replica.InsecureSkipVerify,
+		replica.RoleARN, replica.WebIdentityTokenFile, replica.RoleSessionName)
 }
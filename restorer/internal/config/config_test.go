@@ -3,11 +3,24 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/restorer"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/storage"
 )
 
+var defaultRetryPolicy = retry.Policy{
+	Attempts:       3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
 func Test_GetConfig_Success(t *testing.T) {
 	t.Setenv("DB_HOST", "localhost")
 	t.Setenv("DB_PORT", "5432")
@@ -38,6 +51,23 @@ func Test_GetConfig_Success(t *testing.T) {
 		S3BucketName:   "backup-bucket",
 		BackupRevision: "5",
 		Secure:         true,
+		ScratchDir:     "/tmp",
+		VerifyChecksum: true,
+
+		RestoreMode:         "plain",
+		PreRestoreRetention: 72 * time.Hour,
+
+		RetryAttempts:       3,
+		RetryInitialBackoff: time.Second,
+		RetryMaxBackoff:     30 * time.Second,
+		RetryJitter:         0.2,
+
+		PgClientDirs: []string{"/usr/lib/postgresql/*/bin", "/usr/libexec/postgresql*"},
+
+		S3Region:          "us-east-1",
+		S3ForcePathStyle:  true,
+		S3RoleSessionName: "oiler-restorer",
+		ReplicaS3Region:   "us-east-1",
 	}
 
 	assert.Equal(t, expected, cfg)
@@ -61,6 +91,43 @@ func Test_GetConfig_MissingRequiredField(t *testing.T) {
 	assert.Contains(t, err.Error(), "DB_HOST")
 }
 
+func Test_GetConfig_Revision(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "BACKUP_REVISION")
+
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("BACKUP_REVISION", "")
+	_, err = GetConfig()
+	require.ErrorContains(t, err, "BACKUP_REVISION")
+
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("BACKUP_REVISION", "latest")
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "latest", cfg.BackupRevision)
+
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("BACKUP_REVISION", "latest-before=2025-01-01T12:00:00Z")
+	cfg, err = GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "latest-before=2025-01-01T12:00:00Z", cfg.BackupRevision)
+
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("BACKUP_REVISION", "latest-before=yesterday")
+	_, err = GetConfig()
+	require.ErrorContains(t, err, `BACKUP_REVISION: invalid revision "latest-before=yesterday"`)
+}
+
 func Test_GetConfig_EmptyValue(t *testing.T) {
 	t.Setenv("DB_HOST", "")
 	t.Setenv("DB_PORT", "5432")
@@ -98,6 +165,13 @@ func Test_GetConfig_DefaultValues(t *testing.T) {
 
 	assert.Equal(t, false, cfg.Secure)
 	assert.False(t, cfg.Secure)
+	assert.False(t, cfg.FallbackEnabled())
+	assert.Equal(t, "mydb", cfg.SourceDatabase())
+	assert.Equal(t, restorer.Options{
+		Mode:                restorer.ModePlain,
+		PreRestoreRetention: 72 * time.Hour,
+		Retry:               defaultRetryPolicy,
+	}, cfg.RestoreOptions())
 }
 
 func Test_String(t *testing.T) {
@@ -119,7 +193,468 @@ func Test_String(t *testing.T) {
 
 	expected := "{DbHost: localhost, DbPort: 5432, DbUser: user, DbPassword: <unset>, " +
 		"DbName: mydb, CoreAddr: http://core:8080, S3Endpoint: s3.example.com, S3AccessKey: <unset>, " +
-		"S3SecretKey: <unset>, S3BucketName: backup-bucket, backupRevision: 5, Secure: true}"
+		"S3SecretKey: <unset>, S3BucketName: backup-bucket, backupRevision: 5, Secure: true, " +
+		"ScratchDir: /tmp, VerifyChecksum: true, " +
+		"SourceDbName: , CreateDatabase: false, AllowOverwrite: false, " +
+		"RestoreMode: plain, PreRestoreRetention: 72h0m0s, PreRestoreSnapshot: false, " +
+		"RestoreTimeout: 0s, DownloadTimeout: 0s, PgRestoreTimeout: 0s, " +
+		"RetryAttempts: 3, RetryInitialBackoff: 1s, RetryMaxBackoff: 30s, RetryJitter: 0.2, " +
+		"RestoreSchemas: [], RestoreExcludeSchemas: [], RestoreTables: [], RestoreExcludeTables: [], " +
+		"RestoreSections: [], DataOnly: false, SchemaOnly: false, " +
+		"PgClientDirs: [/usr/lib/postgresql/*/bin /usr/libexec/postgresql*], " +
+		"PostRestoreOwner: , PostRestoreGrants: [], PostRestoreResetSequences: false, " +
+		"PostRestoreSQLDir: , PostRestoreAnalyze: , " +
+		"OtlpEndpoint: , TraceParent: , TraceState: , " +
+		"S3Region: us-east-1, S3ForcePathStyle: true, S3CAFile: , S3InsecureSkipVerify: false, " +
+		"S3RoleARN: , S3WebIdentityTokenFile: , S3RoleSessionName: oiler-restorer, " +
+		"ReplicaS3Endpoint: , ReplicaS3AccessKey: <unset>, ReplicaS3SecretKey: <unset>, ReplicaS3BucketName: , " +
+		"ReplicaS3Region: us-east-1, ReplicaSecure: false, ReplicaS3CAFile: , " +
+		"ReplicaS3ForcePathStyle: true, ReplicaS3InsecureSkipVerify: false, " +
+		"ReplicaS3RoleARN: , ReplicaS3WebIdentityTokenFile: , ReplicaS3RoleSessionName: oiler-restorer}"
 	assert.Equal(t, expected, cfg.String())
 
 }
+
+func Test_GetConfig_Replica(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "5")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_ACCESS_KEY", "replica_access_key")
+	t.Setenv("REPLICA_S3_SECRET_KEY", "replica_secret_key")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+	t.Setenv("REPLICA_SECURE", "true")
+	t.Setenv("REPLICA_S3_REGION", "eu-west-1")
+	t.Setenv("REPLICA_S3_CA_FILE", "/etc/ssl/dr/ca.pem")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.True(t, cfg.FallbackEnabled())
+	assert.Equal(t, "dr.example.com", cfg.ReplicaS3Endpoint)
+	assert.Equal(t, "replica_access_key", cfg.ReplicaS3AccessKey)
+	assert.Equal(t, "replica_secret_key", cfg.ReplicaS3SecretKey)
+	assert.Equal(t, "dr-bucket", cfg.ReplicaS3BucketName)
+	assert.True(t, cfg.ReplicaSecure)
+	assert.Equal(t, "eu-west-1", cfg.ReplicaStorageConfig().Region)
+	assert.Equal(t, "/etc/ssl/dr/ca.pem", cfg.ReplicaStorageConfig().CAFile)
+}
+
+func Test_GetConfig_ReplicaConnection(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("S3_FORCE_PATH_STYLE", "false")
+	t.Setenv("S3_INSECURE_SKIP_VERIFY", "true")
+	t.Setenv("S3_ROLE_ARN", "arn:aws:iam::123456789012:role/restorer")
+	t.Setenv("S3_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/token")
+	t.Setenv("BACKUP_REVISION", "5")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	replica := cfg.ReplicaStorageConfig()
+	assert.False(t, replica.ForcePathStyle)
+	assert.True(t, replica.InsecureSkipVerify)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/restorer", replica.RoleARN)
+	assert.Equal(t, "/var/run/secrets/token", replica.WebIdentityTokenFile)
+	assert.Equal(t, "oiler-restorer", replica.RoleSessionName)
+
+	t.Setenv("DB_PASSWORD", "pass") // unset by the previous GetConfig
+	t.Setenv("REPLICA_S3_FORCE_PATH_STYLE", "true")
+	t.Setenv("REPLICA_S3_INSECURE_SKIP_VERIFY", "false")
+	t.Setenv("REPLICA_S3_ROLE_ARN", "arn:aws:iam::210987654321:role/replica")
+	t.Setenv("REPLICA_S3_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/dr-token")
+	t.Setenv("REPLICA_S3_ROLE_SESSION_NAME", "oiler-replica")
+	cfg, err = GetConfig()
+	require.NoError(t, err)
+
+	replica = cfg.ReplicaStorageConfig()
+	assert.True(t, replica.ForcePathStyle)
+	assert.False(t, replica.InsecureSkipVerify)
+	assert.Equal(t, "arn:aws:iam::210987654321:role/replica", replica.RoleARN)
+	assert.Equal(t, "/var/run/secrets/dr-token", replica.WebIdentityTokenFile)
+	assert.Equal(t, "oiler-replica", replica.RoleSessionName)
+	assert.False(t, cfg.StorageConfig().ForcePathStyle)
+
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("S3_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("S3_ROLE_ARN", "")
+	t.Setenv("REPLICA_S3_WEB_IDENTITY_TOKEN_FILE", "")
+	_, err = GetConfig()
+	require.ErrorContains(t, err, "REPLICA_S3_WEB_IDENTITY_TOKEN_FILE")
+}
+
+func Test_GetConfig_ReplicaMissingCredentials(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "5")
+	t.Setenv("REPLICA_S3_ENDPOINT", "dr.example.com")
+	t.Setenv("REPLICA_S3_BUCKET_NAME", "dr-bucket")
+	t.Setenv("REPLICA_S3_ACCESS_KEY", "replica_access_key")
+
+	_, err := GetConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REPLICA_S3_ACCESS_KEY and REPLICA_S3_SECRET_KEY")
+}
+
+func Test_GetConfig_S3Options(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "https://minio.local:9000")
+	t.Setenv("S3_ACCESS_KEY", "access_key")
+	t.Setenv("S3_SECRET_KEY", "secret_key")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "5")
+	t.Setenv("SECURE", "true")
+	t.Setenv("S3_REGION", "eu-central-1")
+	t.Setenv("S3_FORCE_PATH_STYLE", "false")
+	t.Setenv("S3_CA_FILE", "/etc/ssl/minio/ca.pem")
+	t.Setenv("S3_INSECURE_SKIP_VERIFY", "true")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, s3client.Config{
+		Endpoint:           "https://minio.local:9000",
+		AccessKey:          "access_key",
+		SecretKey:          "secret_key",
+		RoleSessionName:    "oiler-restorer",
+		Region:             "eu-central-1",
+		ForcePathStyle:     false,
+		CAFile:             "/etc/ssl/minio/ca.pem",
+		InsecureSkipVerify: true,
+		Secure:             true,
+	}, cfg.StorageConfig())
+}
+
+func Test_GetConfig_WebIdentity(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "5")
+	t.Setenv("S3_ROLE_ARN", "arn:aws:iam::123456789012:role/restorer")
+	t.Setenv("S3_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	cc := cfg.StorageConfig()
+	assert.Empty(t, cc.AccessKey)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/restorer", cc.RoleARN)
+	assert.Equal(t, "/var/run/secrets/eks.amazonaws.com/serviceaccount/token", cc.WebIdentityTokenFile)
+	assert.Equal(t, "oiler-restorer", cc.RoleSessionName)
+}
+
+func Test_GetConfig_RoleWithoutToken(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "5")
+	t.Setenv("S3_ROLE_ARN", "arn:aws:iam::123456789012:role/restorer")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "S3_WEB_IDENTITY_TOKEN_FILE")
+}
+
+func Test_GetConfig_DifferentTarget(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "staging.local")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "staging")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("SOURCE_DB_NAME", "production")
+	t.Setenv("CREATE_DATABASE", "true")
+	t.Setenv("ALLOW_OVERWRITE", "true")
+	t.Setenv("PRE_RESTORE_SNAPSHOT", "true")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, "production", cfg.SourceDatabase())
+	assert.True(t, cfg.PreRestoreSnapshot)
+	assert.Equal(t, restorer.Options{
+		CreateDatabase:      true,
+		AllowOverwrite:      true,
+		Mode:                restorer.ModePlain,
+		PreRestoreRetention: 72 * time.Hour,
+		Retry:               defaultRetryPolicy,
+	}, cfg.RestoreOptions())
+}
+
+func Test_GetConfig_RestoreFilters(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("RESTORE_SCHEMAS", "public,billing")
+	t.Setenv("RESTORE_EXCLUDE_TABLES", "public.audit_log")
+	t.Setenv("RESTORE_SECTIONS", "pre-data,data")
+	t.Setenv("DATA_ONLY", "true")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	opts := cfg.RestoreOptions()
+	assert.Equal(t, []string{"public", "billing"}, opts.Schemas)
+	assert.Equal(t, []string{"public.audit_log"}, opts.ExcludeTables)
+	assert.Equal(t, []string{"pre-data", "data"}, opts.Sections)
+	assert.True(t, opts.DataOnly)
+}
+
+func Test_GetConfig_InvalidRestoreFilters(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("DATA_ONLY", "true")
+	t.Setenv("SCHEMA_ONLY", "true")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "mutually exclusive")
+}
+
+func Test_GetConfig_SwapMode(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("RESTORE_MODE", "swap")
+	t.Setenv("PRE_RESTORE_RETENTION", "24h")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	opts := cfg.RestoreOptions()
+	assert.Equal(t, restorer.ModeSwap, opts.Mode)
+	assert.Equal(t, 24*time.Hour, opts.PreRestoreRetention)
+}
+
+func Test_GetConfig_InvalidRestoreMode(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("RESTORE_MODE", "atomic")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "unknown restore mode")
+}
+
+func Test_GetConfig_Timeouts(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("RESTORE_TIMEOUT", "2h")
+	t.Setenv("DOWNLOAD_TIMEOUT", "30m")
+	t.Setenv("PG_RESTORE_TIMEOUT", "90m")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, 2*time.Hour, cfg.RestoreTimeout)
+	assert.Equal(t, 30*time.Minute, cfg.DownloadTimeout)
+	assert.Equal(t, 90*time.Minute, cfg.PgRestoreTimeout)
+}
+
+func Test_GetConfig_NegativeTimeout(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("DOWNLOAD_TIMEOUT", "-1m")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "must not be negative")
+}
+
+func Test_GetConfig_Download(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("SCRATCH_DIR", "/scratch")
+	t.Setenv("VERIFY_CHECKSUM", "false")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, "/scratch", cfg.ScratchDir)
+	assert.Equal(t, storage.DownloadOptions{VerifyChecksum: false, Retry: defaultRetryPolicy}, cfg.DownloadOptions())
+}
+
+func Test_GetConfig_InvalidRetry(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("RETRY_ATTEMPTS", "0")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "retry attempts must be positive")
+}
+
+func Test_GetConfig_PostRestore(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("POST_RESTORE_OWNER", "app")
+	t.Setenv("POST_RESTORE_GRANTS", "GRANT USAGE ON SCHEMA {{.Schema}} TO app_ro;GRANT SELECT, REFERENCES ON ALL TABLES IN SCHEMA {{.Schema}} TO app_ro")
+	t.Setenv("POST_RESTORE_RESET_SEQUENCES", "true")
+	t.Setenv("POST_RESTORE_SQL_DIR", "/etc/post-restore")
+	t.Setenv("POST_RESTORE_ANALYZE", "vacuum-analyze")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, restorer.PostRestoreOptions{
+		Owner: "app",
+		Grants: []string{
+			"GRANT USAGE ON SCHEMA {{.Schema}} TO app_ro",
+			"GRANT SELECT, REFERENCES ON ALL TABLES IN SCHEMA {{.Schema}} TO app_ro",
+		},
+		ResetSequences: true,
+		SQLDir:         "/etc/post-restore",
+		Analyze:        restorer.VacuumAnalyzeStatistics,
+	}, cfg.RestoreOptions().PostRestore)
+}
+
+func Test_GetConfig_InvalidPostRestore(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("POST_RESTORE_ANALYZE", "full")
+
+	_, err := GetConfig()
+	require.ErrorContains(t, err, "unknown analyze mode")
+}
+
+func Test_GetConfig_Tracing(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_PORT", "5432")
+	t.Setenv("DB_USER", "user")
+	t.Setenv("DB_PASSWORD", "pass")
+	t.Setenv("DB_NAME", "mydb")
+	t.Setenv("CORE_ADDR", "http://core:8080")
+	t.Setenv("S3_ENDPOINT", "s3.example.com")
+	t.Setenv("S3_BUCKET_NAME", "backup-bucket")
+	t.Setenv("BACKUP_REVISION", "0")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://otel-collector:4317")
+	t.Setenv("TRACEPARENT", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "http://otel-collector:4317", cfg.OtlpEndpoint)
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", cfg.TraceParent)
+}
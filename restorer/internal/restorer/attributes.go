@@ -0,0 +1,197 @@
+package restorer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// listSettings are settings whose values are lists, stored flattened with
+// double-quoted elements. pg_dump renders them element by element too.
+var listSettings = []string{
+	"search_path",
+	"temp_tablespaces",
+	"session_preload_libraries",
+	"local_preload_libraries",
+}
+
+// A databaseAttributes stores database-level attributes pg_dump does not
+// back up, which ModeSwap carries over to the database swapped in.
+type databaseAttributes struct {
+	Owner      string
+	ConnLimit  int  // -1 if unlimited
+	DefaultACL bool // Privileges were never granted or revoked
+	Grants     []databaseGrant
+	Settings   []databaseSetting
+}
+
+// A databaseGrant is a privilege on database.
+type databaseGrant struct {
+	Grantee   string // Empty for PUBLIC
+	Privilege string // CONNECT, CREATE or TEMPORARY
+	Grantable bool
+}
+
+// A databaseSetting is a configuration parameter set with ALTER DATABASE
+// or, if Role is not empty, with ALTER ROLE IN DATABASE.
+type databaseSetting struct {
+	Role  string
+	Name  string
+	Value string
+}
+
+// readDatabaseAttributes returns attributes of database dbName.
+func readDatabaseAttributes(ctx context.Context, db *sql.DB, dbName string) (databaseAttributes, error) {
+	var attrs databaseAttributes
+	err := db.QueryRowContext(ctx, `SELECT pg_get_userbyid(datdba), datconnlimit, datacl IS NULL
+		FROM pg_database WHERE datname = $1`, dbName).Scan(&attrs.Owner, &attrs.ConnLimit, &attrs.DefaultACL)
+	if err != nil {
+		return databaseAttributes{}, fmt.Errorf("failed to read attributes of database %s: %v", dbName, err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT COALESCE(r.rolname, ''), a.privilege_type, a.is_grantable
+		FROM pg_database d CROSS JOIN aclexplode(d.datacl) a
+		LEFT JOIN pg_roles r ON r.oid = a.grantee
+		WHERE d.datname = $1`, dbName)
+	if err != nil {
+		return databaseAttributes{}, fmt.Errorf("failed to read privileges on database %s: %v", dbName, err)
+	}
+	for rows.Next() {
+		var grant databaseGrant
+		err = rows.Scan(&grant.Grantee, &grant.Privilege, &grant.Grantable)
+		if err != nil {
+			rows.Close()
+			return databaseAttributes{}, fmt.Errorf("failed to read privileges on database %s: %v", dbName, err)
+		}
+		attrs.Grants = append(attrs.Grants, grant)
+	}
+	rows.Close()
+
+	rows, err = db.QueryContext(ctx, `SELECT COALESCE(r.rolname, ''), unnest(s.setconfig)
+		FROM pg_db_role_setting s
+		JOIN pg_database d ON d.oid = s.setdatabase
+		LEFT JOIN pg_roles r ON r.oid = s.setrole
+		WHERE d.datname = $1`, dbName)
+	if err != nil {
+		return databaseAttributes{}, fmt.Errorf("failed to read settings of database %s: %v", dbName, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role, config string
+		err = rows.Scan(&role, &config)
+		if err != nil {
+			return databaseAttributes{}, fmt.Errorf("failed to read settings of database %s: %v", dbName, err)
+		}
+		name, value, _ := strings.Cut(config, "=")
+		attrs.Settings = append(attrs.Settings, databaseSetting{Role: role, Name: name, Value: value})
+	}
+	return attrs, nil
+}
+
+// statements returns SQL applying attributes to database dbName owned by
+// the current user. Ownership is transferred last, so that the current user
+// may still grant privileges and change settings; privileges of the owner
+// are implied by ownership and are not granted explicitly.
+func (a databaseAttributes) statements(dbName string) []string {
+	database := pq.QuoteIdentifier(dbName)
+	statements := []string{}
+	if a.ConnLimit >= 0 {
+		statements = append(statements, fmt.Sprintf("ALTER DATABASE %s CONNECTION LIMIT %d", database, a.ConnLimit))
+	}
+	if !a.DefaultACL {
+		statements = append(statements, fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM PUBLIC", database))
+	}
+	for _, grant := range a.Grants {
+		if grant.Grantee == a.Owner {
+			continue
+		}
+		grantee := "PUBLIC"
+		if grant.Grantee != "" {
+			grantee = pq.QuoteIdentifier(grant.Grantee)
+		}
+		statement := fmt.Sprintf("GRANT %s ON DATABASE %s TO %s", grant.Privilege, database, grantee)
+		if grant.Grantable {
+			statement += " WITH GRANT OPTION"
+		}
+		statements = append(statements, statement)
+	}
+	for _, setting := range a.Settings {
+		target := "DATABASE " + database
+		if setting.Role != "" {
+			target = fmt.Sprintf("ROLE %s IN DATABASE %s", pq.QuoteIdentifier(setting.Role), database)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER %s SET %s TO %s",
+			target, pq.QuoteIdentifier(setting.Name), settingValue(setting.Name, setting.Value)))
+	}
+	if a.Owner != "" {
+		statements = append(statements, fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", database, pq.QuoteIdentifier(a.Owner)))
+	}
+	return statements
+}
+
+// settingValue returns value of setting name as SQL literals. Values of
+// listSettings are split into elements, e.g. `"$user", public` into '$user', 'public'.
+func settingValue(name, value string) string {
+	if !containsFold(listSettings, name) {
+		return pq.QuoteLiteral(value)
+	}
+	elements := splitList(value)
+	for i, element := range elements {
+		elements[i] = pq.QuoteLiteral(element)
+	}
+	return strings.Join(elements, ", ")
+}
+
+// splitList splits flattened list value on commas outside double quotes
+// and unquotes its elements.
+func splitList(value string) []string {
+	elements := []string{}
+	var element strings.Builder
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"' && quoted && i+1 < len(value) && value[i+1] == '"':
+			element.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			elements = append(elements, element.String())
+			element.Reset()
+		case (c == ' ' || c == '\t') && !quoted:
+			// Whitespace around unquoted elements is dropped.
+		default:
+			element.WriteByte(c)
+		}
+	}
+	return append(elements, element.String())
+}
+
+// containsFold reports whether names contain name ignoring case.
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyDatabaseAttributes applies attributes of database from to database to.
+func copyDatabaseAttributes(ctx context.Context, db *sql.DB, from, to string) error {
+	attrs, err := readDatabaseAttributes(ctx, db, from)
+	if err != nil {
+		return err
+	}
+	for _, statement := range attrs.statements(to) {
+		_, err = db.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to carry over attributes of database %s: %s: %v", from, statement, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package restorer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+)
+
+// commandWaitDelay is a period PostgreSQL client is given to exit after
+// SIGTERM when ctx is done. It is killed afterwards.
+const commandWaitDelay = 10 * time.Second
+
+// command returns PostgreSQL client command authenticated as the restorer user.
+// name is a program of client tools chosen by selectClient, e.g. pg_restore.
+// The command is interrupted with SIGTERM rather than killed when ctx is done,
+// so that it can close connections and roll back its transaction.
+func (r Restorer) command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, r.client.Path(name), args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", r.dbPass))
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = commandWaitDelay
+	return cmd
+}
+
+// selectClient returns client tools of Options.Clients compatible with
+// the server db is connected to. Tools in PATH are used without version
+// check if there are none.
+func (r Restorer) selectClient(ctx context.Context, db *sql.DB) (pgclient.Client, error) {
+	if len(r.opts.Clients) == 0 {
+		return pgclient.Client{}, nil
+	}
+
+	var versionNum int
+	err := db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&versionNum)
+	if err != nil {
+		return pgclient.Client{}, fmt.Errorf("failed to get server version: %w", err)
+	}
+	client, err := pgclient.Select(r.opts.Clients, pgclient.ServerMajor(versionNum))
+	if err != nil {
+		return pgclient.Client{}, fmt.Errorf("failed to choose client tools: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,59 @@
+package restorer
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+)
+
+func Test_Command_TerminatedOnCancel(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, dbName, backupName, Options{})
+
+	cmdCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := r.command(cmdCtx, "sleep", "10").Run()
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), commandWaitDelay)
+
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr))
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	require.True(t, ok)
+	assert.Equal(t, syscall.SIGTERM, status.Signal())
+}
+
+func Test_Command_Env(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, dbName, backupName, Options{})
+
+	cmd := r.command(context.Background(), "pg_restore", "--list")
+	assert.Contains(t, cmd.Env, "PGPASSWORD="+dbPass)
+}
+
+func Test_Command_Client(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, dbName, backupName, Options{})
+	assert.Equal(t, "pg_restore", r.command(context.Background(), "pg_restore").Args[0])
+
+	r.client = pgclient.Client{Major: 16, BinDir: "/usr/lib/postgresql/16/bin"}
+	cmd := r.command(context.Background(), "pg_restore", "--list")
+	assert.Equal(t, "/usr/lib/postgresql/16/bin/pg_restore", cmd.Path)
+	assert.Equal(t, []string{"/usr/lib/postgresql/16/bin/pg_restore", "--list"}, cmd.Args)
+}
+
+func Test_SelectClient_NoClients(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, dbName, backupName, Options{})
+
+	// Server is not queried if there are no clients to choose from.
+	client, err := r.selectClient(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, pgclient.Client{}, client)
+}
@@ -0,0 +1,225 @@
+package restorer
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/tracing"
+)
+
+// Formats of backups, same as formats of backuper.
+const (
+	FormatPlain     = "plain"     // SQL script applied with psql
+	FormatCustom    = "custom"    // pg_dump custom archive
+	FormatTar       = "tar"       // pg_dump tar archive
+	FormatDirectory = "directory" // Tar archive of pg_dump directory output
+)
+
+// Formats lists supported backup formats.
+var Formats = []string{FormatPlain, FormatCustom, FormatTar, FormatDirectory}
+
+// extensions maps formats to extensions of uploaded backups, same as of backuper.
+var extensions = map[string]string{
+	FormatPlain:     ".sql",
+	FormatCustom:    ".dump",
+	FormatTar:       ".tar",
+	FormatDirectory: ".dir.tar",
+}
+
+// Extension returns extension of uploaded backups in format, e.g. ".dump".
+func Extension(format string) string {
+	return extensions[format]
+}
+
+var (
+	// customMagic starts pg_dump custom archives.
+	customMagic = []byte("PGDMP")
+	// tarMagic is at offset 257 of tar headers.
+	tarMagic = []byte("ustar")
+)
+
+// tarMagicOffset is offset of tarMagic in tar headers.
+const tarMagicOffset = 257
+
+// tarRestoreScript is written by pg_dump to tar archives and is missing in
+// directory output, which tells tar archives from archived directories.
+const tarRestoreScript = "restore.sql"
+
+// DetectFormat detects format of backup at path by its contents.
+// Files which are neither custom nor tar archives are treated as plain scripts.
+func DetectFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, tarMagicOffset+len(tarMagic))
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read backup: %v", err)
+	}
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, customMagic):
+		return FormatCustom, nil
+	case len(header) == tarMagicOffset+len(tarMagic) && bytes.Equal(header[tarMagicOffset:], tarMagic):
+	default:
+		return FormatPlain, nil
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("failed to rewind backup: %v", err)
+	}
+	tr := tar.NewReader(file)
+	for {
+		entry, err := tr.Next()
+		if err == io.EOF {
+			return FormatDirectory, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read tar archive: %v", err)
+		}
+		if entry.Name == tarRestoreScript {
+			return FormatTar, nil
+		}
+	}
+}
+
+// WithFormat returns copy of r restoring backup in format, e.g. taken
+// from its manifest. Format is detected from backup if it is empty.
+func (r Restorer) WithFormat(format string) Restorer {
+	r.format = format
+	return r
+}
+
+// resolveFormat returns format of backup, detecting it if it is unknown.
+func (r Restorer) resolveFormat() (string, error) {
+	if r.format == "" {
+		return DetectFormat(r.backupPath)
+	}
+	if !slices.Contains(Formats, r.format) {
+		return "", fmt.Errorf("unknown backup format %q, expected one of %v", r.format, Formats)
+	}
+	return r.format, nil
+}
+
+// validateFormat checks that options can be applied to backup in format.
+// Plain scripts are applied as a whole.
+func (o Options) validateFormat(format string) error {
+	if format == FormatPlain && o.isSelective() {
+		return fmt.Errorf("restore filters require an archive backup, got %s format", format)
+	}
+	return nil
+}
+
+// restoreBackup applies backup to dbName with psql for plain scripts and
+// pg_restore otherwise. Archived directory output is extracted next to the
+// backup and removed afterwards.
+func (r Restorer) restoreBackup(ctx context.Context) error {
+	switch r.format {
+	case FormatPlain:
+		return r.psql(ctx)
+	case FormatDirectory:
+		dir := r.backupPath + ".dir"
+		defer os.RemoveAll(dir)
+		err := extractDirectory(r.backupPath, dir)
+		if err != nil {
+			return err
+		}
+		archive := r
+		archive.backupPath = dir
+		return archive.pgRestore(ctx)
+	default:
+		return r.pgRestore(ctx)
+	}
+}
+
+// psql applies plain script to dbName.
+func (r Restorer) psql(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "psql")
+	defer func() { tracing.End(span, err) }()
+
+	cmd := r.command(ctx, "psql", r.psqlArgs()...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return pgoutput.NewCommandError("psql", err, output)
+	}
+	return nil
+}
+
+// psqlArgs returns arguments of psql command applying plain script.
+// Script stops on the first error, so that failures are not hidden in output.
+func (r Restorer) psqlArgs() []string {
+	args := []string{
+		"-h", r.dbHost,
+		"-p", r.dbPort,
+		"-U", r.dbUser,
+		"-d", r.dbName,
+		"--no-psqlrc",
+		"-v", "ON_ERROR_STOP=1",
+	}
+	if r.opts.Mode == ModeSingleTransaction {
+		args = append(args, "--single-transaction")
+	}
+	return append(args, "-f", r.backupPath)
+}
+
+// extractDirectory extracts tar archive of pg_dump directory output at path to dir.
+func extractDirectory(path, dir string) error {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		return fmt.Errorf("failed to remove previous directory: %v", err)
+	}
+	err = os.Mkdir(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer file.Close()
+	tr := tar.NewReader(file)
+	for {
+		entry, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %v", err)
+		}
+		// Directory output is flat, entries with paths are not expected.
+		name := filepath.Base(entry.Name)
+		if entry.Typeflag != tar.TypeReg || name != entry.Name {
+			continue
+		}
+		err = extractFile(tr, filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %v", name, err)
+		}
+	}
+}
+
+// extractFile writes contents of r to a new file at path.
+func extractFile(r io.Reader, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
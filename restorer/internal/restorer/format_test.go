@@ -0,0 +1,110 @@
+package restorer
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTar writes tar archive of files named by keys of files to path.
+func writeTar(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	tw := tar.NewWriter(file)
+	for name, contents := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+}
+
+func Test_DetectFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	custom := filepath.Join(dir, "custom")
+	require.NoError(t, os.WriteFile(custom, []byte("PGDMP\x01\x0e\x00"), 0o600))
+	plain := filepath.Join(dir, "plain")
+	require.NoError(t, os.WriteFile(plain, []byte("--\n-- PostgreSQL database dump\n--\n"), 0o600))
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	tarArchive := filepath.Join(dir, "tar")
+	writeTar(t, tarArchive, map[string]string{"toc.dat": "toc", "3001.dat": "data", "restore.sql": "script"})
+	directory := filepath.Join(dir, "directory")
+	writeTar(t, directory, map[string]string{"toc.dat": "toc", "3001.dat.gz": "data"})
+
+	for path, expected := range map[string]string{
+		custom:     FormatCustom,
+		plain:      FormatPlain,
+		empty:      FormatPlain,
+		tarArchive: FormatTar,
+		directory:  FormatDirectory,
+	} {
+		format, err := DetectFormat(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, format, filepath.Base(path))
+	}
+
+	_, err := DetectFormat(filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "failed to open backup")
+}
+
+func Test_ResolveFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, os.WriteFile(path, []byte("PGDMP"), 0o600))
+	r := NewRestorer("localhost", "5432", "user", "pass", "mydb", path, Options{})
+
+	format, err := r.resolveFormat()
+	require.NoError(t, err)
+	assert.Equal(t, FormatCustom, format)
+
+	format, err = r.WithFormat(FormatPlain).resolveFormat()
+	require.NoError(t, err)
+	assert.Equal(t, FormatPlain, format)
+
+	_, err = r.WithFormat("zip").resolveFormat()
+	assert.ErrorContains(t, err, `unknown backup format "zip"`)
+}
+
+func Test_ValidateFormat(t *testing.T) {
+	assert.NoError(t, Options{Tables: []string{"users"}}.validateFormat(FormatCustom))
+	assert.NoError(t, Options{Mode: ModeSwap}.validateFormat(FormatPlain))
+	assert.ErrorContains(t, Options{Schemas: []string{"public"}}.validateFormat(FormatPlain), "restore filters require an archive backup")
+}
+
+func Test_PsqlArgs(t *testing.T) {
+	r := NewRestorer("localhost", "5432", "user", "pass", "mydb", "/tmp/backup", Options{Mode: ModeSingleTransaction})
+	assert.Equal(t, []string{
+		"-h", "localhost",
+		"-p", "5432",
+		"-U", "user",
+		"-d", "mydb",
+		"--no-psqlrc",
+		"-v", "ON_ERROR_STOP=1",
+		"--single-transaction",
+		"-f", "/tmp/backup",
+	}, r.psqlArgs())
+}
+
+func Test_ExtractDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup")
+	writeTar(t, path, map[string]string{"toc.dat": "toc", "3001.dat.gz": "data", "../escape": "x"})
+
+	dir := path + ".dir"
+	require.NoError(t, extractDirectory(path, dir))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"toc.dat", "3001.dat.gz"}, names)
+	data, err := os.ReadFile(filepath.Join(dir, "3001.dat.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
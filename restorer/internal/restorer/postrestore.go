@@ -0,0 +1,372 @@
+package restorer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Ways of collecting statistics after restore.
+const (
+	// AnalyzeStatistics runs ANALYZE on the whole database.
+	AnalyzeStatistics = "analyze"
+	// VacuumAnalyzeStatistics runs VACUUM (ANALYZE) on the whole database.
+	VacuumAnalyzeStatistics = "vacuum-analyze"
+)
+
+// Names of post-restore steps. Steps run in this order.
+// SQL files are reported as "sql:<file name>".
+const (
+	StepOwner     = "owner"
+	StepGrants    = "grants"
+	StepSequences = "sequences"
+	StepSQL       = "sql"
+	StepAnalyze   = "analyze"
+)
+
+// userSchemas filters out system schemas in queries joining pg_namespace as n.
+const userSchemas = `n.nspname NOT IN ('pg_catalog', 'information_schema')
+	AND n.nspname NOT LIKE 'pg\_toast%' AND n.nspname NOT LIKE 'pg\_temp\_%'`
+
+// A PostRestoreOptions describes steps run on the target database after
+// backup is applied, e.g. to restore what --no-owner drops.
+type PostRestoreOptions struct {
+	Owner          string // Role objects owned by restoring user are re-assigned to
+	ResetSequences bool   // Move sequences owned by columns past maximum values of the columns
+
+	// Grants are GRANT statements templates executed for every user schema.
+	// {{.Schema}} and {{.Database}} are replaced with quoted identifiers, e.g.
+	// "GRANT USAGE ON SCHEMA {{.Schema}} TO app". Identical statements are executed once.
+	Grants []string
+
+	SQLDir  string // Directory with *.sql files executed in lexical order, e.g. a mounted ConfigMap
+	Analyze string // AnalyzeStatistics or VacuumAnalyzeStatistics. Empty skips collecting statistics
+}
+
+// Validate checks that analyze mode is known and grant templates can be rendered.
+func (o PostRestoreOptions) Validate() error {
+	switch o.Analyze {
+	case "", AnalyzeStatistics, VacuumAnalyzeStatistics:
+	default:
+		return fmt.Errorf("unknown analyze mode %q, expected %s or %s", o.Analyze, AnalyzeStatistics, VacuumAnalyzeStatistics)
+	}
+	templates, err := parseGrants(o.Grants)
+	if err != nil {
+		return err
+	}
+	_, err = renderGrants(templates, "db", []string{"public"})
+	return err
+}
+
+// A StepResult describes outcome of a single post-restore step.
+type StepResult struct {
+	Step     string
+	Duration time.Duration
+	Err      error // Nil if step succeeded
+}
+
+// postRestoreStep is a post-restore step run over connection to the target database.
+type postRestoreStep struct {
+	name string
+	run  func(ctx context.Context, db *sql.DB) error
+}
+
+// PostRestore runs configured post-restore steps on the target database.
+// It stops on the first failed step and returns results of all steps run
+// so far together with the error of the failed one.
+func (r Restorer) PostRestore(ctx context.Context) ([]StepResult, error) {
+	steps, err := r.postRestoreSteps()
+	if err != nil || len(steps) == 0 {
+		return nil, err
+	}
+
+	db, err := r.connect(ctx, r.dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	results := []StepResult{}
+	for _, step := range steps {
+		start := time.Now()
+		err = step.run(ctx, db)
+		results = append(results, StepResult{Step: step.name, Duration: time.Since(start), Err: err})
+		if err != nil {
+			return results, fmt.Errorf("post-restore step %s failed: %w", step.name, err)
+		}
+	}
+	return results, nil
+}
+
+// postRestoreSteps returns configured steps in order they are run.
+func (r Restorer) postRestoreSteps() ([]postRestoreStep, error) {
+	o := r.opts.PostRestore
+	steps := []postRestoreStep{}
+	if o.Owner != "" {
+		steps = append(steps, postRestoreStep{StepOwner, func(ctx context.Context, db *sql.DB) error {
+			return reassignOwner(ctx, db, o.Owner)
+		}})
+	}
+	if len(o.Grants) > 0 {
+		templates, err := parseGrants(o.Grants)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, postRestoreStep{StepGrants, func(ctx context.Context, db *sql.DB) error {
+			return applyGrants(ctx, db, r.dbName, templates)
+		}})
+	}
+	if o.ResetSequences {
+		steps = append(steps, postRestoreStep{StepSequences, resetSequences})
+	}
+	if o.SQLDir != "" {
+		files, err := sqlFiles(o.SQLDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			steps = append(steps, postRestoreStep{StepSQL + ":" + filepath.Base(file), func(ctx context.Context, db *sql.DB) error {
+				return execFile(ctx, db, file)
+			}})
+		}
+	}
+	if o.Analyze != "" {
+		steps = append(steps, postRestoreStep{StepAnalyze, func(ctx context.Context, db *sql.DB) error {
+			return analyze(ctx, db, o.Analyze)
+		}})
+	}
+	return steps, nil
+}
+
+// reassignOwner transfers schemas, relations and routines owned by the
+// current user to owner in a single transaction. Sequences linked to
+// columns follow their tables and objects of extensions are skipped.
+func reassignOwner(ctx context.Context, db *sql.DB, owner string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `WITH me AS (SELECT oid FROM pg_roles WHERE rolname = current_user)
+		SELECT 'SCHEMA', quote_ident(n.nspname) FROM pg_namespace n
+		WHERE n.nspowner = (SELECT oid FROM me) AND `+userSchemas+`
+		UNION ALL
+		SELECT CASE c.relkind WHEN 'v' THEN 'VIEW' WHEN 'm' THEN 'MATERIALIZED VIEW'
+			WHEN 'S' THEN 'SEQUENCE' WHEN 'f' THEN 'FOREIGN TABLE' ELSE 'TABLE' END,
+			c.oid::regclass::text
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relowner = (SELECT oid FROM me) AND `+userSchemas+`
+		AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+		AND NOT EXISTS (SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid
+			AND (d.deptype = 'e' OR (c.relkind = 'S' AND d.deptype IN ('a', 'i'))))
+		UNION ALL
+		SELECT CASE p.prokind WHEN 'p' THEN 'PROCEDURE' WHEN 'a' THEN 'AGGREGATE' ELSE 'FUNCTION' END,
+			p.oid::regprocedure::text
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.proowner = (SELECT oid FROM me) AND `+userSchemas+`
+		AND NOT EXISTS (SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e')`)
+	if err != nil {
+		return fmt.Errorf("failed to list owned objects: %v", err)
+	}
+	statements := []string{}
+	for rows.Next() {
+		var kind, name string
+		err = rows.Scan(&kind, &name)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list owned objects: %v", err)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER %s %s OWNER TO %s", kind, name, pq.QuoteIdentifier(owner)))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to list owned objects: %v", err)
+	}
+
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to execute %q: %v", statement, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit ownership change: %v", err)
+	}
+	return nil
+}
+
+// grantData is data grant templates are executed with.
+type grantData struct {
+	Schema   string
+	Database string
+}
+
+// parseGrants parses grant templates.
+func parseGrants(grants []string) ([]*template.Template, error) {
+	templates := make([]*template.Template, 0, len(grants))
+	for i, grant := range grants {
+		tmpl, err := template.New(fmt.Sprintf("grant%d", i)).Option("missingkey=error").Parse(grant)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grant template %q: %v", grant, err)
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, nil
+}
+
+// renderGrants renders every template for every schema.
+// Statements not depending on schema are returned once.
+func renderGrants(templates []*template.Template, dbName string, schemas []string) ([]string, error) {
+	statements := []string{}
+	seen := map[string]bool{}
+	for _, tmpl := range templates {
+		for _, schema := range schemas {
+			var sb strings.Builder
+			err := tmpl.Execute(&sb, grantData{
+				Schema:   pq.QuoteIdentifier(schema),
+				Database: pq.QuoteIdentifier(dbName),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to render grant template: %v", err)
+			}
+			statement := sb.String()
+			if !seen[statement] {
+				seen[statement] = true
+				statements = append(statements, statement)
+			}
+		}
+	}
+	return statements, nil
+}
+
+// applyGrants executes grant templates for every user schema of dbName in a single transaction.
+func applyGrants(ctx context.Context, db *sql.DB, dbName string, templates []*template.Template) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT n.nspname FROM pg_namespace n WHERE "+userSchemas+" ORDER BY n.nspname")
+	if err != nil {
+		return fmt.Errorf("failed to list schemas: %v", err)
+	}
+	schemas := []string{}
+	for rows.Next() {
+		var schema string
+		err = rows.Scan(&schema)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list schemas: %v", err)
+		}
+		schemas = append(schemas, schema)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to list schemas: %v", err)
+	}
+
+	statements, err := renderGrants(templates, dbName, schemas)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to execute %q: %v", statement, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit grants: %v", err)
+	}
+	return nil
+}
+
+// resetSequences moves every ascending sequence linked to a column, i.e. serial
+// or identity one, to the maximum value of the column, so that inserts do not
+// collide with restored rows after data-only or filtered restores.
+func resetSequences(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT s.oid::regclass::text, quote_ident(a.attname), t.oid::regclass::text, ps.seqstart
+		FROM pg_class s
+		JOIN pg_sequence ps ON ps.seqrelid = s.oid
+		JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = s.oid
+			AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE s.relkind = 'S' AND ps.seqincrement > 0`)
+	if err != nil {
+		return fmt.Errorf("failed to list sequences: %v", err)
+	}
+	statements := []string{}
+	for rows.Next() {
+		var sequence, column, table string
+		var start int64
+		err = rows.Scan(&sequence, &column, &table, &start)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list sequences: %v", err)
+		}
+		statements = append(statements, fmt.Sprintf("SELECT setval(%s, COALESCE(max(%s), %d), max(%s) IS NOT NULL) FROM %s",
+			pq.QuoteLiteral(sequence), column, start, column, table))
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to list sequences: %v", err)
+	}
+
+	for _, statement := range statements {
+		_, err = db.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to execute %q: %v", statement, err)
+		}
+	}
+	return nil
+}
+
+// sqlFiles returns *.sql files of dir in lexical order.
+func sqlFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SQL files: %v", err)
+	}
+	return files, nil
+}
+
+// execFile executes statements of SQL file. Multiple statements are
+// executed in a single implicit transaction unless file controls it.
+func execFile(ctx context.Context, db *sql.DB, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read SQL file: %v", err)
+	}
+	_, err = db.ExecContext(ctx, string(content))
+	if err != nil {
+		return fmt.Errorf("failed to execute SQL file %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// analyze collects statistics of the whole database.
+func analyze(ctx context.Context, db *sql.DB, mode string) error {
+	statement := "ANALYZE"
+	if mode == VacuumAnalyzeStatistics {
+		statement = "VACUUM (ANALYZE)"
+	}
+	_, err := db.ExecContext(ctx, statement)
+	if err != nil {
+		return fmt.Errorf("failed to execute %s: %v", statement, err)
+	}
+	return nil
+}
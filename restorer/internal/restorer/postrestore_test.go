@@ -0,0 +1,84 @@
+package restorer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PostRestoreOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    PostRestoreOptions
+		wantErr string
+	}{
+		{"Empty", PostRestoreOptions{}, ""},
+		{"VacuumAnalyze", PostRestoreOptions{Analyze: VacuumAnalyzeStatistics}, ""},
+		{"Grants", PostRestoreOptions{Grants: []string{"GRANT USAGE ON SCHEMA {{.Schema}} TO app"}}, ""},
+		{"UnknownAnalyze", PostRestoreOptions{Analyze: "vacuum-full"}, "unknown analyze mode"},
+		{"MalformedGrant", PostRestoreOptions{Grants: []string{"GRANT USAGE ON SCHEMA {{.Schema TO app"}}, "invalid grant template"},
+		{"UnknownField", PostRestoreOptions{Grants: []string{"GRANT ALL ON {{.Table}} TO app"}}, "failed to render grant template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_RenderGrants(t *testing.T) {
+	templates, err := parseGrants([]string{
+		"GRANT USAGE ON SCHEMA {{.Schema}} TO app",
+		"GRANT CONNECT ON DATABASE {{.Database}} TO app",
+	})
+	require.NoError(t, err)
+
+	statements, err := renderGrants(templates, "my db", []string{"public", "Tenant"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`GRANT USAGE ON SCHEMA "public" TO app`,
+		`GRANT USAGE ON SCHEMA "Tenant" TO app`,
+		`GRANT CONNECT ON DATABASE "my db" TO app`,
+	}, statements)
+}
+
+func Test_PostRestoreSteps(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"20-grants.sql", "10-roles.sql", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1"), 0644))
+	}
+
+	r := NewRestorer("localhost", "5432", "user", "pass", "mydb", "/tmp/backup.sql", Options{
+		PostRestore: PostRestoreOptions{
+			Owner:          "app",
+			ResetSequences: true,
+			Grants:         []string{"GRANT USAGE ON SCHEMA {{.Schema}} TO app"},
+			SQLDir:         dir,
+			Analyze:        AnalyzeStatistics,
+		},
+	})
+	steps, err := r.postRestoreSteps()
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.name)
+	}
+	assert.Equal(t, []string{"owner", "grants", "sequences", "sql:10-roles.sql", "sql:20-grants.sql", "analyze"}, names)
+}
+
+func Test_PostRestore_NoSteps(t *testing.T) {
+	r := NewRestorer("invalid-host", "5432", "user", "pass", "mydb", "/tmp/backup.sql", Options{})
+
+	results, err := r.PostRestore(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
@@ -4,13 +4,110 @@ package restorer
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"slices"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/tracing"
+)
+
+// maintenanceDb is a database used to create target database.
+const maintenanceDb = "postgres"
+
+// sections are valid values of pg_restore --section flag.
+var sections = []string{"pre-data", "data", "post-data"}
+
+// Modes of applying backup to the target database.
+const (
+	// ModePlain drops and recreates objects one by one. A failure leaves
+	// the database partially restored.
+	ModePlain = "plain"
+	// ModeSingleTransaction restores backup in a single transaction
+	// rolled back on the first error.
+	ModeSingleTransaction = "single-transaction"
+	// ModeSwap restores backup into a temporary database and renames it
+	// to the target one. The original database is kept under
+	// "<db>_pre_restore_<timestamp>" name.
+	ModeSwap = "swap"
 )
 
+// ErrDatabaseNotEmpty is returned if target database contains user objects
+// and overwriting is not allowed.
+var ErrDatabaseNotEmpty = errors.New("target database is not empty")
+
+// An Options describes how backup is applied to the target database.
+// Tables and ExcludeTables accept either table names or schema-qualified
+// "schema.table" names and are applied with a generated use-list.
+type Options struct {
+	CreateDatabase bool   // Create target database if it does not exist
+	AllowOverwrite bool   // Allow restoring onto a database containing user objects
+	Mode           string // One of ModePlain, ModeSingleTransaction or ModeSwap. Empty means ModePlain
+
+	// PreRestoreRetention is a period original databases replaced in ModeSwap
+	// are kept for. Zero keeps them forever.
+	PreRestoreRetention time.Duration
+
+	Schemas        []string // Restore only objects in these schemas
+	ExcludeSchemas []string // Do not restore objects in these schemas
+	Tables         []string // Restore only these tables
+	ExcludeTables  []string // Do not restore these tables
+	DataOnly       bool     // Restore only data, not schema
+	SchemaOnly     bool     // Restore only schema, not data
+	Sections       []string // Restore only named sections: pre-data, data or post-data
+
+	PostRestore PostRestoreOptions // Steps run after backup is applied
+
+	Retry retry.Policy // Retries of connecting to the database server
+
+	// Installed client tools to choose pg_restore, psql and pg_dump matching
+	// the server from, tools in PATH are used without version check if there are none.
+	Clients []pgclient.Client
+}
+
+// Validate checks that options are consistent.
+func (o Options) Validate() error {
+	if o.DataOnly && o.SchemaOnly {
+		return fmt.Errorf("data-only and schema-only restores are mutually exclusive")
+	}
+	for _, section := range o.Sections {
+		if !slices.Contains(sections, section) {
+			return fmt.Errorf("unknown section %q, expected one of %v", section, sections)
+		}
+	}
+
+	switch o.Mode {
+	case "", ModePlain, ModeSingleTransaction:
+	case ModeSwap:
+		if o.isSelective() {
+			return fmt.Errorf("%s mode replaces the whole database and cannot be used with restore filters", ModeSwap)
+		}
+	default:
+		return fmt.Errorf("unknown restore mode %q, expected one of %v", o.Mode,
+			[]string{ModePlain, ModeSingleTransaction, ModeSwap})
+	}
+	return o.PostRestore.Validate()
+}
+
+// isSelective reports whether only a part of backup is restored.
+func (o Options) isSelective() bool {
+	return len(o.Schemas) > 0 || len(o.ExcludeSchemas) > 0 || len(o.Tables) > 0 || len(o.ExcludeTables) > 0 ||
+		o.DataOnly || o.SchemaOnly || len(o.Sections) > 0
+}
+
+// needsUseList reports whether backup contents should be filtered by a use-list.
+func (o Options) needsUseList() bool {
+	return len(o.Tables) > 0 || len(o.ExcludeTables) > 0
+}
+
 type Restorer struct {
 	dbHost string
 	dbPort string
@@ -19,11 +116,16 @@ type Restorer struct {
 	dbName string
 
 	backupPath string
+	format     string // One of Formats, detected from backup if empty
+	opts       Options
+	client     pgclient.Client // Client tools matching the server, chosen by selectClient
+	startedAt  time.Time
 }
 
 // NewRestorer is a constructor for Restorer.
-// Accepts parameters to connect to database and backupPath where backup will be stored locally.
-func NewRestorer(dbHost, dbPort, dbUser, dbPassword, dbName, backupPath string) Restorer {
+// Accepts parameters to connect to target database and backupPath where backup will be stored locally.
+// opts define how backup is applied.
+func NewRestorer(dbHost, dbPort, dbUser, dbPassword, dbName, backupPath string, opts Options) Restorer {
 	return Restorer{
 		dbHost:     dbHost,
 		dbPort:     dbPort,
@@ -31,39 +133,204 @@ func NewRestorer(dbHost, dbPort, dbUser, dbPassword, dbName, backupPath string)
 		dbPass:     dbPassword,
 		dbName:     dbName,
 		backupPath: backupPath,
+		opts:       opts,
+		startedAt:  time.Now(),
 	}
 }
 
 // Restore restores backup from local file.
-// It uses postgres command with appropriate flags.
+// It uses psql for plain scripts and pg_restore for archives with appropriate flags,
+// both of the installed client tools matching version of the server.
 func (r Restorer) Restore(ctx context.Context) error {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		r.dbHost, r.dbPort, r.dbUser, r.dbPass, r.dbName)
-	db, err := sql.Open("postgres", connStr)
+	format, err := r.resolveFormat()
 	if err != nil {
-		return fmt.Errorf("failed to open driver for database: %v", err)
+		return err
+	}
+	err = r.opts.validateFormat(format)
+	if err != nil {
+		return err
+	}
+	r.format = format
+
+	if r.opts.Mode == ModeSwap {
+		return r.restoreWithSwap(ctx)
+	}
+
+	if r.opts.CreateDatabase {
+		err = r.ensureDatabase(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := r.connect(ctx, r.dbName)
+	if err != nil {
+		return err
 	}
 	defer db.Close()
 
-	err = db.PingContext(ctx)
+	r.client, err = r.selectClient(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if !r.opts.AllowOverwrite {
+		err = checkEmpty(ctx, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.restoreBackup(ctx)
+}
+
+// pgRestore runs pg_restore against dbName.
+func (r Restorer) pgRestore(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "pg_restore")
+	defer func() { tracing.End(span, err) }()
+
+	args := r.pgRestoreArgs()
+	if r.opts.needsUseList() {
+		useListPath, err := r.writeUseList(ctx)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(useListPath)
+		args = append([]string{"-L", useListPath}, args...)
+	}
+
+	cmd := r.command(ctx, "pg_restore", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return pgoutput.NewCommandError("pg_restore", err, output)
+	}
+	return nil
+}
+
+// connect opens connection to dbName on the target host and checks that it is
+// reachable. Transient failures, e.g. server starting up, are retried according to Options.Retry.
+func (r Restorer) connect(ctx context.Context, dbName string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", r.connStr(dbName))
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
+		return nil, fmt.Errorf("failed to open driver for database: %v", err)
 	}
+	ctx, span := tracing.Start(ctx, "connect", trace.WithAttributes(attribute.String("db.name", dbName)))
+	err = retry.Do(ctx, r.opts.Retry, retry.IsTransient, db.PingContext)
+	tracing.End(span, err)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
 
-	cmd := exec.Command("pg_restore",
+// connStr returns connection string to dbName on the target host.
+func (r Restorer) connStr(dbName string) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		r.dbHost, r.dbPort, r.dbUser, r.dbPass, dbName)
+}
+
+// pgRestoreArgs returns arguments of pg_restore command.
+// Existing objects are not dropped on data-only restores as pg_restore
+// does not allow --clean with --data-only.
+func (r Restorer) pgRestoreArgs() []string {
+	args := []string{
 		"-h", r.dbHost,
 		"-p", r.dbPort,
 		"-U", r.dbUser,
 		"-d", r.dbName,
 		"--no-owner",
-		"--clean",
-		r.backupPath,
-	)
-	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", r.dbPass))
+	}
+	if !r.opts.DataOnly {
+		args = append(args, "--clean", "--if-exists")
+	}
+	for _, schema := range r.opts.Schemas {
+		args = append(args, "-n", schema)
+	}
+	for _, schema := range r.opts.ExcludeSchemas {
+		args = append(args, "-N", schema)
+	}
+	if r.opts.DataOnly {
+		args = append(args, "--data-only")
+	}
+	if r.opts.SchemaOnly {
+		args = append(args, "--schema-only")
+	}
+	for _, section := range r.opts.Sections {
+		args = append(args, "--section="+section)
+	}
+	switch r.opts.Mode {
+	case ModeSingleTransaction:
+		args = append(args, "--single-transaction", "--exit-on-error")
+	case ModeSwap:
+		args = append(args, "--exit-on-error")
+	}
 
-	output, err := cmd.CombinedOutput()
+	return append(args, r.backupPath)
+}
+
+// ensureDatabase creates target database if it does not exist.
+func (r Restorer) ensureDatabase(ctx context.Context) error {
+	db, err := r.connect(ctx, maintenanceDb)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	exists, err := databaseExists(ctx, db, r.dbName)
 	if err != nil {
-		return fmt.Errorf("failed executing pg_restore: %+v\n.Output:%s", err, string(output))
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	return createDatabase(ctx, db, r.dbName)
+}
+
+// databaseExists reports whether database named dbName exists.
+func databaseExists(ctx context.Context, db *sql.DB, dbName string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", dbName).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check database existence: %v", err)
+	}
+	return exists, nil
+}
+
+// createDatabase creates database named dbName.
+func createDatabase(ctx context.Context, db *sql.DB, dbName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(dbName)))
+	if err != nil {
+		return fmt.Errorf("failed to create database: %v", err)
+	}
+	return nil
+}
+
+// checkTargetEmpty returns ErrDatabaseNotEmpty if target database contains user relations.
+func (r Restorer) checkTargetEmpty(ctx context.Context) error {
+	db, err := r.connect(ctx, r.dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return checkEmpty(ctx, db)
+}
+
+// checkEmpty returns ErrDatabaseNotEmpty if db contains user relations.
+func checkEmpty(ctx context.Context, db *sql.DB) error {
+	var count int
+	err := db.QueryRowContext(ctx, `SELECT count(*) FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg_toast%'
+		AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')`).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check database contents: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: found %d relations", ErrDatabaseNotEmpty, count)
 	}
 	return nil
 }
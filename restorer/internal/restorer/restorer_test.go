@@ -2,12 +2,18 @@ package restorer
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	tc "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
 )
 
 var (
@@ -66,6 +72,7 @@ func setupPostgresContainer() (*tc.Container, error) {
 // 		dbPass,
 // 		dbName,
 // 		backupFile,
+// 		Options{},
 // 	)
 
 // 	err = r.Restore(ctx)
@@ -94,6 +101,7 @@ func Test_Redtore_InvalidDump(t *testing.T) {
 		dbPass,
 		dbName,
 		backupFile,
+		Options{},
 	)
 
 	err = r.Restore(ctx)
@@ -110,8 +118,164 @@ func Test_Redtore_InvalidDBHost(t *testing.T) {
 		dbPass,
 		dbName,
 		backupName,
+		Options{},
 	)
 
 	err := r.Restore(ctx)
 	require.ErrorContains(t, err, "failed to connect to database:")
 }
+
+func Test_PgRestoreArgs(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, "staging", backupName, Options{})
+
+	assert.Equal(t, []string{
+		"-h", "localhost",
+		"-p", "5432",
+		"-U", dbUser,
+		"-d", "staging",
+		"--no-owner",
+		"--clean",
+		"--if-exists",
+		backupName,
+	}, r.pgRestoreArgs())
+}
+
+func Test_PgRestoreArgs_Filters(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, dbName, backupName, Options{
+		Schemas:        []string{"public"},
+		ExcludeSchemas: []string{"audit"},
+		DataOnly:       true,
+		Sections:       []string{"data"},
+	})
+
+	assert.Equal(t, []string{
+		"-h", "localhost",
+		"-p", "5432",
+		"-U", dbUser,
+		"-d", dbName,
+		"--no-owner",
+		"-n", "public",
+		"-N", "audit",
+		"--data-only",
+		"--section=data",
+		backupName,
+	}, r.pgRestoreArgs())
+}
+
+func Test_Options_Validate(t *testing.T) {
+	require.NoError(t, Options{SchemaOnly: true, Sections: []string{"pre-data", "post-data"}}.Validate())
+	require.ErrorContains(t, Options{DataOnly: true, SchemaOnly: true}.Validate(), "mutually exclusive")
+	require.ErrorContains(t, Options{Sections: []string{"indexes"}}.Validate(), "unknown section")
+}
+
+func Test_Restore_RefusesNonEmptyDatabase(t *testing.T) {
+	postgresC, err := setupPostgresContainer()
+	require.NoError(t, err)
+	defer func() {
+		err := (*postgresC).Terminate(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	dbHost, _ := (*postgresC).Host(ctx)
+	dbPort, _ := (*postgresC).MappedPort(ctx, "5432")
+
+	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbHost, dbPort.Port(), dbUser, dbPass, dbName))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.ExecContext(ctx, "CREATE TABLE users (id int)")
+	require.NoError(t, err)
+
+	r := NewRestorer(dbHost, dbPort.Port(), dbUser, dbPass, dbName, backupName, Options{})
+
+	err = r.Restore(ctx)
+	require.ErrorIs(t, err, ErrDatabaseNotEmpty)
+}
+
+func Test_Restore_CreatesDatabase(t *testing.T) {
+	postgresC, err := setupPostgresContainer()
+	require.NoError(t, err)
+	defer func() {
+		err := (*postgresC).Terminate(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	dbHost, _ := (*postgresC).Host(ctx)
+	dbPort, _ := (*postgresC).MappedPort(ctx, "5432")
+
+	r := NewRestorer(dbHost, dbPort.Port(), dbUser, dbPass, "staging", filepath.Join(t.TempDir(), backupName),
+		Options{CreateDatabase: true})
+
+	err = r.Restore(ctx)
+	require.ErrorContains(t, err, "failed executing pg_restore")
+
+	err = r.ensureDatabase(ctx)
+	require.NoError(t, err)
+}
+
+func Test_SelectClient(t *testing.T) {
+	postgresC, err := setupPostgresContainer()
+	require.NoError(t, err)
+	defer func() {
+		err := (*postgresC).Terminate(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	dbHost, _ := (*postgresC).Host(ctx)
+	dbPort, _ := (*postgresC).MappedPort(ctx, "5432")
+
+	r := NewRestorer(dbHost, dbPort.Port(), dbUser, dbPass, dbName, backupName, Options{
+		Clients: []pgclient.Client{{Major: 13}, {Major: 15}, {Major: 16}},
+	})
+	db, err := r.connect(ctx, dbName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	client, err := r.selectClient(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, 15, client.Major)
+
+	r.opts.Clients = []pgclient.Client{{Major: 12}, {Major: 13}}
+	_, err = r.selectClient(ctx, db)
+	require.ErrorContains(t, err, "installed versions are 12, 13")
+	assert.Equal(t, pgoutput.ClassVersionMismatch, pgoutput.Classify(err))
+}
+
+func Test_SnapshotArgs(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, "staging", backupName, Options{})
+
+	assert.Equal(t, []string{
+		"-h", "localhost",
+		"-p", "5432",
+		"-U", dbUser,
+		"-d", "staging",
+		"-F", "c",
+		"-f", "snapshot.sql",
+	}, r.snapshotArgs("snapshot.sql"))
+}
+
+func Test_Snapshot_MissingDatabase(t *testing.T) {
+	postgresC, err := setupPostgresContainer()
+	require.NoError(t, err)
+	defer func() {
+		err := (*postgresC).Terminate(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	dbHost, _ := (*postgresC).Host(ctx)
+	dbPort, _ := (*postgresC).MappedPort(ctx, "5432")
+
+	r := NewRestorer(dbHost, dbPort.Port(), dbUser, dbPass, "staging", backupName, Options{CreateDatabase: true})
+
+	taken, err := r.Snapshot(ctx, filepath.Join(t.TempDir(), "snapshot.sql"))
+	require.NoError(t, err)
+	assert.False(t, taken)
+}
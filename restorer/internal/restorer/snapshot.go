@@ -0,0 +1,53 @@
+package restorer
+
+import (
+	"context"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+)
+
+// SnapshotFormat is a format snapshots of target database are taken in.
+const SnapshotFormat = FormatCustom
+
+// Snapshot dumps current contents of target database to snapshotPath
+// in SnapshotFormat, so that they can be restored after an
+// accidental restore. Returns false without dumping if target database
+// does not exist yet.
+func (r Restorer) Snapshot(ctx context.Context, snapshotPath string) (bool, error) {
+	db, err := r.connect(ctx, maintenanceDb)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	exists, err := databaseExists(ctx, db, r.dbName)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, nil
+	}
+	r.client, err = r.selectClient(ctx, db)
+	if err != nil {
+		return false, err
+	}
+
+	cmd := r.command(ctx, "pg_dump", r.snapshotArgs(snapshotPath)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return false, pgoutput.NewCommandError("pg_dump", err, output)
+	}
+	return true, nil
+}
+
+// snapshotArgs returns arguments of pg_dump command taking snapshot.
+func (r Restorer) snapshotArgs(snapshotPath string) []string {
+	return []string{
+		"-h", r.dbHost,
+		"-p", r.dbPort,
+		"-U", r.dbUser,
+		"-d", r.dbName,
+		"-F", "c",
+		"-f", snapshotPath,
+	}
+}
@@ -0,0 +1,274 @@
+package restorer
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+const (
+	tempDbSuffix       = "_restore_"     // Suffix of a database backup is restored into in ModeSwap
+	preRestoreDbSuffix = "_pre_restore_" // Suffix of an original database replaced in ModeSwap
+
+	swapTimestampLayout = "20060102150405"
+	cleanupTimeout      = time.Minute // Timeout of dropping temporary database after failure
+	maxIdentifierLength = 63          // PostgreSQL NAMEDATALEN - 1
+	nameHashLength      = 8           // Hex digits of hash distinguishing truncated names
+)
+
+// swapPrefix returns common prefix of auxiliary databases derived from dbName.
+// A long dbName is truncated and suffixed with its hash, so that the name with
+// timestamp fits into PostgreSQL identifier and databases sharing a long prefix
+// do not get the same auxiliary names.
+func swapPrefix(dbName, suffix string) string {
+	maxLen := maxIdentifierLength - len(suffix) - len(swapTimestampLayout)
+	if len(dbName) > maxLen {
+		sum := sha256.Sum256([]byte(dbName))
+		cut := maxLen - nameHashLength - 1
+		for cut > 0 && !utf8.RuneStart(dbName[cut]) {
+			cut--
+		}
+		dbName = dbName[:cut] + "_" + hex.EncodeToString(sum[:])[:nameHashLength]
+	}
+	return dbName + suffix
+}
+
+// swapName returns name of an auxiliary database derived from dbName.
+func swapName(dbName, suffix string, ts time.Time) string {
+	return swapPrefix(dbName, suffix) + ts.UTC().Format(swapTimestampLayout)
+}
+
+// PreRestoreDatabase returns name the original database is kept under in ModeSwap.
+func (r Restorer) PreRestoreDatabase() string {
+	return swapName(r.dbName, preRestoreDbSuffix, r.startedAt)
+}
+
+// restoreWithSwap restores backup into a temporary database and replaces
+// the target database with it. The target database is left untouched if
+// restoration fails.
+func (r Restorer) restoreWithSwap(ctx context.Context) (err error) {
+	db, err := r.connect(ctx, maintenanceDb)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	r.client, err = r.selectClient(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	targetExists, err := databaseExists(ctx, db, r.dbName)
+	if err != nil {
+		return err
+	}
+	if !targetExists && !r.opts.CreateDatabase {
+		return fmt.Errorf("target database %s does not exist", r.dbName)
+	}
+	if targetExists && !r.opts.AllowOverwrite {
+		err = r.checkTargetEmpty(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	tempDb := swapName(r.dbName, tempDbSuffix, r.startedAt)
+	err = createDatabase(ctx, db, tempDb)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Temporary database is dropped even if restore was cancelled.
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		defer cancel()
+		dropErr := dropDatabase(cleanupCtx, db, tempDb)
+		if dropErr != nil {
+			err = fmt.Errorf("%w; failed to drop temporary database %s: %v", err, tempDb, dropErr)
+		}
+	}()
+
+	temp := r
+	temp.dbName = tempDb
+	err = temp.restoreBackup(ctx)
+	if err != nil {
+		return err
+	}
+	if targetExists {
+		err = copyDatabaseAttributes(ctx, db, r.dbName, tempDb)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.swap(ctx, db, tempDb, targetExists)
+}
+
+// swap renames target database to PreRestoreDatabase and tempDb to target
+// database in a single transaction. PostgreSQL does not rename databases in use,
+// so new connections to target database are disallowed and existing ones
+// are terminated first. Connections are allowed again afterwards, to the
+// original database under whichever name it has.
+func (r Restorer) swap(ctx context.Context, db *sql.DB, tempDb string, targetExists bool) (err error) {
+	if targetExists {
+		var allow func(context.Context, string) error
+		allow, err = disallowConnections(ctx, db, r.dbName)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			name := r.dbName
+			if err == nil {
+				name = r.PreRestoreDatabase()
+			}
+			cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+			defer cancel()
+			allowErr := allow(cleanupCtx, name)
+			if allowErr != nil && err == nil {
+				err = allowErr
+			} else if allowErr != nil {
+				err = fmt.Errorf("%w; %v", err, allowErr)
+			}
+		}()
+
+		_, err = db.ExecContext(ctx, `SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+			WHERE datname = $1 AND pid <> pg_backend_pid()`, r.dbName)
+		if err != nil {
+			return fmt.Errorf("failed to terminate connections to target database: %v", err)
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if targetExists {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s RENAME TO %s",
+			pq.QuoteIdentifier(r.dbName), pq.QuoteIdentifier(r.PreRestoreDatabase())))
+		if err != nil {
+			return fmt.Errorf("failed to rename target database: %v", err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s RENAME TO %s",
+		pq.QuoteIdentifier(tempDb), pq.QuoteIdentifier(r.dbName)))
+	if err != nil {
+		return fmt.Errorf("failed to rename restored database: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit database swap: %v", err)
+	}
+	return nil
+}
+
+// disallowConnections disallows new connections to database dbName.
+// Returns function allowing them again to the database, renamed meanwhile
+// to the passed name, unless they were disallowed already.
+func disallowConnections(ctx context.Context, db *sql.DB, dbName string) (func(context.Context, string) error, error) {
+	var allowed bool
+	err := db.QueryRowContext(ctx, "SELECT datallowconn FROM pg_database WHERE datname = $1", dbName).Scan(&allowed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check connections to target database: %v", err)
+	}
+	if !allowed {
+		return func(context.Context, string) error { return nil }, nil
+	}
+	err = setAllowConnections(ctx, db, dbName, false)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, name string) error {
+		return setAllowConnections(ctx, db, name, true)
+	}, nil
+}
+
+// setAllowConnections sets ALLOW_CONNECTIONS of database dbName.
+func setAllowConnections(ctx context.Context, db *sql.DB, dbName string, allow bool) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s WITH ALLOW_CONNECTIONS %t", pq.QuoteIdentifier(dbName), allow))
+	if err != nil {
+		return fmt.Errorf("failed to set ALLOW_CONNECTIONS of database %s: %v", dbName, err)
+	}
+	return nil
+}
+
+// DropExpiredPreRestore drops original databases replaced in ModeSwap
+// which are older than PreRestoreRetention. Returns names of dropped databases.
+func (r Restorer) DropExpiredPreRestore(ctx context.Context) ([]string, error) {
+	if r.opts.PreRestoreRetention <= 0 {
+		return nil, nil
+	}
+
+	db, err := r.connect(ctx, maintenanceDb)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT datname FROM pg_database WHERE NOT datistemplate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %v", err)
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to list databases: %v", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	dropped := []string{}
+	for _, name := range expiredPreRestore(names, r.dbName, r.startedAt, r.opts.PreRestoreRetention) {
+		err = dropDatabase(ctx, db, name)
+		if err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, name)
+	}
+	return dropped, nil
+}
+
+// expiredPreRestore returns names of original databases replaced in ModeSwap
+// created more than retention before now.
+func expiredPreRestore(names []string, dbName string, now time.Time, retention time.Duration) []string {
+	prefix := swapPrefix(dbName, preRestoreDbSuffix)
+	expired := []string{}
+	for _, name := range names {
+		tsStr, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		ts, err := time.Parse(swapTimestampLayout, tsStr)
+		if err != nil {
+			continue
+		}
+		if now.Sub(ts) > retention {
+			expired = append(expired, name)
+		}
+	}
+	return expired
+}
+
+// dropDatabase drops database named dbName.
+func dropDatabase(ctx context.Context, db *sql.DB, dbName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(dbName)))
+	if err != nil {
+		return fmt.Errorf("failed to drop database %s: %v", dbName, err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package restorer
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SwapName(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "mydb_pre_restore_20240501100000", swapName("mydb", preRestoreDbSuffix, ts))
+	assert.Equal(t, "mydb_restore_20240501100000", swapName("mydb", tempDbSuffix, ts))
+
+	long := swapName(strings.Repeat("a", 60), preRestoreDbSuffix, ts)
+	assert.Len(t, long, maxIdentifierLength)
+	assert.True(t, strings.HasSuffix(long, "_pre_restore_20240501100000"))
+	other := swapName(strings.Repeat("a", 59)+"b", preRestoreDbSuffix, ts)
+	assert.Len(t, other, maxIdentifierLength)
+	assert.NotEqual(t, long, other)
+
+	multibyte := swapName(strings.Repeat("ж", 30), tempDbSuffix, ts)
+	assert.LessOrEqual(t, len(multibyte), maxIdentifierLength)
+	assert.True(t, utf8.ValidString(multibyte))
+}
+
+func Test_DatabaseAttributes_Statements(t *testing.T) {
+	attrs := databaseAttributes{
+		Owner:     "app_owner",
+		ConnLimit: 50,
+		Grants: []databaseGrant{
+			{Grantee: "app_owner", Privilege: "CREATE"},
+			{Grantee: "app", Privilege: "CONNECT"},
+			{Grantee: "", Privilege: "TEMPORARY"},
+			{Grantee: "admin", Privilege: "CREATE", Grantable: true},
+		},
+		Settings: []databaseSetting{
+			{Name: "search_path", Value: `"$user", public, "My Schema"`},
+			{Name: "work_mem", Value: "64MB"},
+			{Role: "app", Name: "statement_timeout", Value: "30s"},
+		},
+	}
+
+	assert.Equal(t, []string{
+		`ALTER DATABASE "mydb_restore_1" CONNECTION LIMIT 50`,
+		`REVOKE ALL ON DATABASE "mydb_restore_1" FROM PUBLIC`,
+		`GRANT CONNECT ON DATABASE "mydb_restore_1" TO "app"`,
+		`GRANT TEMPORARY ON DATABASE "mydb_restore_1" TO PUBLIC`,
+		`GRANT CREATE ON DATABASE "mydb_restore_1" TO "admin" WITH GRANT OPTION`,
+		`ALTER DATABASE "mydb_restore_1" SET "search_path" TO '$user', 'public', 'My Schema'`,
+		`ALTER DATABASE "mydb_restore_1" SET "work_mem" TO '64MB'`,
+		`ALTER ROLE "app" IN DATABASE "mydb_restore_1" SET "statement_timeout" TO '30s'`,
+		`ALTER DATABASE "mydb_restore_1" OWNER TO "app_owner"`,
+	}, attrs.statements("mydb_restore_1"))
+
+	assert.Equal(t, []string{`ALTER DATABASE "mydb_restore_1" OWNER TO "postgres"`},
+		databaseAttributes{Owner: "postgres", ConnLimit: -1, DefaultACL: true}.statements("mydb_restore_1"))
+}
+
+func Test_PreRestoreDatabase(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, "mydb", backupName, Options{Mode: ModeSwap})
+	r.startedAt = time.Date(2024, 5, 1, 13, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+
+	assert.Equal(t, "mydb_pre_restore_20240501100000", r.PreRestoreDatabase())
+}
+
+func Test_ExpiredPreRestore(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	names := []string{
+		"mydb",
+		"mydb_pre_restore_20240501000000",
+		"mydb_pre_restore_20240509120000",
+		"mydb_pre_restore_garbage",
+		"otherdb_pre_restore_20240101000000",
+	}
+
+	assert.Equal(t, []string{"mydb_pre_restore_20240501000000"},
+		expiredPreRestore(names, "mydb", now, 24*time.Hour))
+	assert.Empty(t, expiredPreRestore(names, "mydb", now, 30*24*time.Hour))
+}
+
+func Test_Options_Validate_Mode(t *testing.T) {
+	require.NoError(t, Options{Mode: ModeSingleTransaction, Tables: []string{"users"}}.Validate())
+	require.NoError(t, Options{Mode: ModeSwap}.Validate())
+	require.ErrorContains(t, Options{Mode: ModeSwap, Tables: []string{"users"}}.Validate(), "cannot be used with restore filters")
+	require.ErrorContains(t, Options{Mode: "atomic"}.Validate(), "unknown restore mode")
+}
+
+func Test_PgRestoreArgs_SingleTransaction(t *testing.T) {
+	r := NewRestorer("localhost", "5432", dbUser, dbPass, dbName, backupName, Options{Mode: ModeSingleTransaction})
+
+	args := r.pgRestoreArgs()
+	assert.Contains(t, args, "--single-transaction")
+	assert.Contains(t, args, "--exit-on-error")
+	assert.Equal(t, backupName, args[len(args)-1])
+}
+
+func Test_Restore_Swap_KeepsTargetOnFailure(t *testing.T) {
+	postgresC, err := setupPostgresContainer()
+	require.NoError(t, err)
+	defer func() {
+		err := (*postgresC).Terminate(ctx)
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	dbHost, _ := (*postgresC).Host(ctx)
+	dbPort, _ := (*postgresC).MappedPort(ctx, "5432")
+
+	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbHost, dbPort.Port(), dbUser, dbPass, dbName))
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.ExecContext(ctx, "CREATE TABLE users (id int)")
+	require.NoError(t, err)
+
+	backupFile := filepath.Join(t.TempDir(), backupName)
+	require.NoError(t, os.WriteFile(backupFile, []byte("invalid dump"), 0o600))
+
+	r := NewRestorer(dbHost, dbPort.Port(), dbUser, dbPass, dbName, backupFile, Options{
+		AllowOverwrite: true,
+		Mode:           ModeSwap,
+	})
+
+	err = r.Restore(ctx)
+	require.ErrorContains(t, err, "failed executing pg_restore")
+
+	var tempDatabases int
+	err = db.QueryRowContext(ctx, "SELECT count(*) FROM pg_database WHERE datname LIKE $1",
+		swapPrefix(dbName, tempDbSuffix)+"%").Scan(&tempDatabases)
+	require.NoError(t, err)
+	assert.Zero(t, tempDatabases)
+
+	_, err = db.ExecContext(ctx, "SELECT * FROM users")
+	require.NoError(t, err)
+}
@@ -0,0 +1,253 @@
+package restorer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+)
+
+// multiWordDescs are descriptions of TOC entries consisting of several words.
+// Longer descriptions go first to be matched before their prefixes.
+var multiWordDescs = []string{
+	"PUBLICATION TABLES IN SCHEMA", "TEXT SEARCH CONFIGURATION", "TEXT SEARCH DICTIONARY",
+	"MATERIALIZED VIEW DATA", "FOREIGN DATA WRAPPER", "TEXT SEARCH TEMPLATE", "TEXT SEARCH PARSER",
+	"DATABASE PROPERTIES", "PROCEDURAL LANGUAGE", "SEQUENCE OWNED BY", "PUBLICATION TABLE",
+	"MATERIALIZED VIEW", "CHECK CONSTRAINT", "OPERATOR FAMILY", "STATISTICS DATA",
+	"OPERATOR CLASS", "FOREIGN SERVER", "SECURITY LABEL", "FOREIGN TABLE", "EVENT TRIGGER",
+	"ACCESS METHOD", "FK CONSTRAINT", "SEQUENCE SET", "ROW SECURITY", "USER MAPPING",
+	"INDEX ATTACH", "TABLE ATTACH", "LARGE OBJECT", "DEFAULT ACL", "TABLE DATA",
+}
+
+// tableDescs are descriptions of TOC entries whose tag is name of the table
+// they belong to.
+var tableDescs = []string{"TABLE", "TABLE DATA", "ROW SECURITY"}
+
+// tablePrefixedDescs are descriptions of TOC entries whose tag starts with
+// name of the table they belong to, e.g. "users users_pkey".
+var tablePrefixedDescs = []string{"CONSTRAINT", "FK CONSTRAINT", "CHECK CONSTRAINT", "DEFAULT", "TRIGGER", "POLICY", "RULE"}
+
+// ownedDescs are descriptions of TOC entries whose tag is name of an index or
+// a sequence. Table they belong to is not listed, see resolveOwners.
+var ownedDescs = []string{"INDEX", "SEQUENCE", "SEQUENCE SET", "SEQUENCE OWNED BY"}
+
+// A tocEntry is a parsed line of `pg_restore --list` output.
+// table is empty for entries unrelated to tables.
+type tocEntry struct {
+	desc      string
+	namespace string
+	tag       string
+	table     string
+}
+
+// parseTocEntry parses line of `pg_restore --list` output.
+// Returns false for comments and lines it does not recognize.
+// Line has a form "<id>; <catalog oid> <oid> <desc> <namespace> <tag> <owner>",
+// where desc and tag may consist of several words and owner may be empty.
+func parseTocEntry(line string) (tocEntry, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	id, rest, found := strings.Cut(strings.TrimLeft(line, " "), ";")
+	if !found {
+		return tocEntry{}, false
+	}
+	if _, err := strconv.Atoi(id); err != nil {
+		return tocEntry{}, false
+	}
+	fields := strings.SplitN(strings.TrimPrefix(rest, " "), " ", 3)
+	if len(fields) < 3 {
+		return tocEntry{}, false
+	}
+	rest = fields[2]
+
+	var entry tocEntry
+	for _, desc := range multiWordDescs {
+		if strings.HasPrefix(rest, desc+" ") {
+			entry.desc = desc
+			break
+		}
+	}
+	if entry.desc == "" {
+		entry.desc, _, _ = strings.Cut(rest, " ")
+	}
+	rest = strings.TrimPrefix(rest, entry.desc+" ")
+	namespace, rest, found := strings.Cut(rest, " ")
+	if !found {
+		return tocEntry{}, false
+	}
+	entry.namespace = namespace
+	// Owner is the last word, possibly empty.
+	i := strings.LastIndex(rest, " ")
+	if i < 0 {
+		return tocEntry{}, false
+	}
+	entry.tag = rest[:i]
+
+	switch {
+	case slices.Contains(tableDescs, entry.desc):
+		entry.table = entry.tag
+	case slices.Contains(tablePrefixedDescs, entry.desc):
+		entry.table, _, _ = strings.Cut(entry.tag, " ")
+	}
+	return entry, true
+}
+
+// matchTable reports whether table in namespace matches one of patterns.
+// Pattern is either a table name or a schema-qualified "schema.table" name.
+func matchTable(patterns []string, namespace, table string) bool {
+	for _, p := range patterns {
+		if p == table || p == namespace+"."+table {
+			return true
+		}
+	}
+	return false
+}
+
+// A qualifiedName is a name of an object in a schema.
+type qualifiedName struct {
+	namespace string
+	name      string
+}
+
+// filterTocList returns lines of toc that should be restored according to
+// Tables and ExcludeTables options. Entries unrelated to tables are kept
+// unless Tables is set, mirroring behaviour of `pg_restore -t`. Indexes and
+// sequences belong to tables found in owners, e.g. with resolveOwners.
+func filterTocList(toc string, opts Options, owners map[qualifiedName]qualifiedName) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(toc))
+	for scanner.Scan() {
+		line := scanner.Text()
+		entry, ok := parseTocEntry(line)
+		if !ok {
+			continue
+		}
+		namespace, table := entry.namespace, entry.table
+		if owner, ok := owners[qualifiedName{entry.namespace, entry.tag}]; ok && slices.Contains(ownedDescs, entry.desc) {
+			namespace, table = owner.namespace, owner.name
+		}
+
+		if table == "" {
+			if len(opts.Tables) == 0 {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		if len(opts.Tables) > 0 && !matchTable(opts.Tables, namespace, table) {
+			continue
+		}
+		if matchTable(opts.ExcludeTables, namespace, table) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// identifier matches a possibly quoted SQL identifier.
+const identifier = `(?:"(?:[^"]|"")*"|[^\s."(]+)`
+
+var (
+	// tocHeader matches comment pg_restore writes before each entry.
+	tocHeader = regexp.MustCompile(`^-- Name: (.*); Type: (.*); Schema: (.*); Owner:`)
+	// ownerStatements match statements naming table an index or a sequence belongs to.
+	ownerStatements = []*regexp.Regexp{
+		regexp.MustCompile(`CREATE (?:UNIQUE )?INDEX .*? ON (?:ONLY )?(` + identifier + `\.` + identifier + `) `),
+		regexp.MustCompile(`ALTER SEQUENCE ` + identifier + `\.` + identifier + ` OWNED BY (` + identifier + `\.` + identifier + `)\.`),
+		regexp.MustCompile(`ALTER TABLE (?:ONLY )?(` + identifier + `\.` + identifier + `) ALTER COLUMN .* ADD GENERATED`),
+	}
+	identifierPart = regexp.MustCompile(identifier)
+)
+
+// parseOwners parses SQL script of index and sequence entries written by
+// pg_restore and returns tables they belong to. Sequences are owned by
+// tables either with OWNED BY or as identity columns.
+func parseOwners(script string) map[qualifiedName]qualifiedName {
+	owners := map[qualifiedName]qualifiedName{}
+	var object qualifiedName
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := tocHeader.FindStringSubmatch(line); m != nil {
+			object = qualifiedName{namespace: m[3], name: m[1]}
+			continue
+		}
+		for _, re := range ownerStatements {
+			m := re.FindStringSubmatch(line)
+			if m == nil || object.name == "" {
+				continue
+			}
+			parts := identifierPart.FindAllString(m[1], -1)
+			owners[object] = qualifiedName{namespace: unquoteIdentifier(parts[0]), name: unquoteIdentifier(parts[1])}
+		}
+	}
+	return owners
+}
+
+// unquoteIdentifier removes quotes of SQL identifier.
+func unquoteIdentifier(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+	return s
+}
+
+// resolveOwners returns tables indexes and sequences of toc belong to.
+// pg_restore does not list dependencies, so the definitions of such entries
+// are rendered with `pg_restore -f -` and parsed.
+func (r Restorer) resolveOwners(ctx context.Context, toc string) (map[qualifiedName]qualifiedName, error) {
+	lines := []string{}
+	for _, line := range strings.Split(toc, "\n") {
+		entry, ok := parseTocEntry(line)
+		if ok && entry.desc != "SEQUENCE SET" && slices.Contains(ownedDescs, entry.desc) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	listPath := r.backupPath + ".owners.list"
+	err := os.WriteFile(listPath, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write use-list: %v", err)
+	}
+	defer os.Remove(listPath)
+
+	cmd := r.command(ctx, "pg_restore", "-L", listPath, "-f", "-", r.backupPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, pgoutput.NewCommandError("pg_restore", err, output)
+	}
+	return parseOwners(string(output)), nil
+}
+
+// writeUseList lists contents of backup, filters them and writes result to
+// the file passed to `pg_restore -L`. Returns path of the written file.
+func (r Restorer) writeUseList(ctx context.Context) (string, error) {
+	cmd := r.command(ctx, "pg_restore", "--list", r.backupPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", pgoutput.NewCommandError("pg_restore", err, output)
+	}
+	owners, err := r.resolveOwners(ctx, string(output))
+	if err != nil {
+		return "", err
+	}
+
+	useListPath := r.backupPath + ".list"
+	lines := filterTocList(string(output), r.opts, owners)
+	err = os.WriteFile(useListPath, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write use-list: %v", err)
+	}
+
+	return useListPath, nil
+}
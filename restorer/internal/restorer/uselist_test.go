@@ -0,0 +1,151 @@
+package restorer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testToc = `;
+; Archive created at 2024-05-01 10:00:00 UTC
+;     dbname: testdb
+;
+5; 2615 2200 SCHEMA - public testuser
+215; 1259 16386 TABLE public users testuser
+216; 1259 16392 TABLE public audit_log testuser
+217; 1259 16398 TABLE billing invoices testuser
+218; 1259 16390 SEQUENCE public users_id_seq testuser
+219; 0 0 SEQUENCE OWNED BY public users_id_seq testuser
+220; 1259 16394 SEQUENCE public audit_log_id_seq testuser
+3100; 2604 16391 DEFAULT public users id testuser
+3345; 0 16386 TABLE DATA public users testuser
+3346; 0 16392 TABLE DATA public audit_log testuser
+3347; 0 16398 TABLE DATA billing invoices testuser
+3400; 0 0 SEQUENCE SET public users_id_seq testuser
+3401; 0 0 SEQUENCE SET public audit_log_id_seq testuser
+3200; 2606 16400 CONSTRAINT public users users_pkey testuser
+3201; 1259 16401 INDEX public users_email_idx testuser
+3203; 1259 16403 INDEX billing invoices_total_idx testuser
+3202; 2606 16402 FK CONSTRAINT billing invoices invoices_user_fkey testuser
+`
+
+// testOwners are tables indexes and sequences of testToc belong to.
+var testOwners = map[qualifiedName]qualifiedName{
+	{"public", "users_id_seq"}:        {"public", "users"},
+	{"public", "audit_log_id_seq"}:    {"public", "audit_log"},
+	{"public", "users_email_idx"}:     {"public", "users"},
+	{"billing", "invoices_total_idx"}: {"billing", "invoices"},
+}
+
+func Test_ParseTocEntry(t *testing.T) {
+	_, ok := parseTocEntry("; dbname: testdb")
+	assert.False(t, ok)
+	_, ok = parseTocEntry("pg_restore: warning: archive items not in correct section order")
+	assert.False(t, ok)
+
+	entry, ok := parseTocEntry("3345; 0 16386 TABLE DATA public users testuser")
+	assert.True(t, ok)
+	assert.Equal(t, tocEntry{desc: "TABLE DATA", namespace: "public", tag: "users", table: "users"}, entry)
+
+	entry, ok = parseTocEntry("3202; 2606 16402 FK CONSTRAINT billing invoices invoices_user_fkey testuser")
+	assert.True(t, ok)
+	assert.Equal(t, tocEntry{desc: "FK CONSTRAINT", namespace: "billing", tag: "invoices invoices_user_fkey", table: "invoices"}, entry)
+
+	entry, ok = parseTocEntry("3100; 2604 16391 DEFAULT public users id testuser")
+	assert.True(t, ok)
+	assert.Equal(t, "users", entry.table)
+
+	entry, ok = parseTocEntry("3201; 1259 16401 INDEX public users_email_idx testuser")
+	assert.True(t, ok)
+	assert.Equal(t, tocEntry{desc: "INDEX", namespace: "public", tag: "users_email_idx"}, entry)
+
+	entry, ok = parseTocEntry("3400; 0 0 SEQUENCE SET public users_id_seq testuser")
+	assert.True(t, ok)
+	assert.Equal(t, tocEntry{desc: "SEQUENCE SET", namespace: "public", tag: "users_id_seq"}, entry)
+
+	entry, ok = parseTocEntry("216; 1259 16392 TABLE public audit log ")
+	assert.True(t, ok)
+	assert.Equal(t, tocEntry{desc: "TABLE", namespace: "public", tag: "audit log", table: "audit log"}, entry)
+}
+
+func Test_FilterTocList_Tables(t *testing.T) {
+	lines := filterTocList(testToc, Options{Tables: []string{"users", "billing.invoices"}}, testOwners)
+
+	assert.Equal(t, []string{
+		"215; 1259 16386 TABLE public users testuser",
+		"217; 1259 16398 TABLE billing invoices testuser",
+		"218; 1259 16390 SEQUENCE public users_id_seq testuser",
+		"219; 0 0 SEQUENCE OWNED BY public users_id_seq testuser",
+		"3100; 2604 16391 DEFAULT public users id testuser",
+		"3345; 0 16386 TABLE DATA public users testuser",
+		"3347; 0 16398 TABLE DATA billing invoices testuser",
+		"3400; 0 0 SEQUENCE SET public users_id_seq testuser",
+		"3200; 2606 16400 CONSTRAINT public users users_pkey testuser",
+		"3201; 1259 16401 INDEX public users_email_idx testuser",
+		"3203; 1259 16403 INDEX billing invoices_total_idx testuser",
+		"3202; 2606 16402 FK CONSTRAINT billing invoices invoices_user_fkey testuser",
+	}, lines)
+}
+
+func Test_FilterTocList_ExcludeTables(t *testing.T) {
+	lines := filterTocList(testToc, Options{ExcludeTables: []string{"public.audit_log", "invoices"}}, testOwners)
+
+	assert.Equal(t, []string{
+		"5; 2615 2200 SCHEMA - public testuser",
+		"215; 1259 16386 TABLE public users testuser",
+		"218; 1259 16390 SEQUENCE public users_id_seq testuser",
+		"219; 0 0 SEQUENCE OWNED BY public users_id_seq testuser",
+		"3100; 2604 16391 DEFAULT public users id testuser",
+		"3345; 0 16386 TABLE DATA public users testuser",
+		"3400; 0 0 SEQUENCE SET public users_id_seq testuser",
+		"3200; 2606 16400 CONSTRAINT public users users_pkey testuser",
+		"3201; 1259 16401 INDEX public users_email_idx testuser",
+	}, lines)
+}
+
+func Test_ParseOwners(t *testing.T) {
+	script := `--
+-- PostgreSQL database dump
+--
+
+--
+-- Name: users_id_seq; Type: SEQUENCE; Schema: public; Owner: testuser
+--
+
+CREATE SEQUENCE public.users_id_seq
+    START WITH 1;
+
+--
+-- Name: users_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: testuser
+--
+
+ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+
+--
+-- Name: Orders_id_seq; Type: SEQUENCE; Schema: My Schema; Owner: testuser
+--
+
+ALTER TABLE "My Schema"."Orders" ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME "My Schema"."Orders_id_seq"
+);
+
+--
+-- Name: users_email_idx; Type: INDEX; Schema: public; Owner: testuser
+--
+
+CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email) WHERE (note <> 'ON x'::text);
+
+--
+-- Name: measurements_idx; Type: INDEX; Schema: public; Owner: testuser
+--
+
+CREATE INDEX measurements_idx ON ONLY public.measurements USING btree (ts);
+`
+
+	assert.Equal(t, map[qualifiedName]qualifiedName{
+		{"public", "users_id_seq"}:     {"public", "users"},
+		{"My Schema", "Orders_id_seq"}: {"My Schema", "Orders"},
+		{"public", "users_email_idx"}:  {"public", "users"},
+		{"public", "measurements_idx"}: {"public", "measurements"},
+	}, parseOwners(script))
+}
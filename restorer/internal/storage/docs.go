@@ -0,0 +1,4 @@
+// Package storage provides methods to work with s3-compatible storage.
+//
+// Unlike s3base it allows to configure region, addressing style and TLS.
+package storage
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+)
+
+// A DownloadOptions describes how downloaded backups are checked.
+type DownloadOptions struct {
+	// VerifyChecksum compares downloaded backup with checksum from its manifest
+	// or, for backups without one, with ETag of a single-part upload.
+	VerifyChecksum bool
+	// Retry describes retries of requests failed with transient errors.
+	// Interrupted downloads are resumed from the last received byte.
+	Retry retry.Policy
+}
+
+// S3Downloader represents a downloader for files stored in s3-compatible storage.
+type S3Downloader struct {
+	client IS3Client
+	opts   DownloadOptions
+}
+
+// NewS3Downloader creates and returns a new instance of S3Downloader.
+// It initializes the underlying s3-client according to cc.
+func NewS3Downloader(ctx context.Context, cc s3client.Config, opts DownloadOptions) (S3Downloader, error) { // coverage-ignore
+	client, err := s3client.New(ctx, cc)
+	if err != nil {
+		return S3Downloader{}, err
+	}
+
+	return S3Downloader{
+		client: client,
+		opts:   opts,
+	}, nil
+}
+
+// Download downloads the specified backup from S3 to backupPath
+// and returns its key. See revision.Resolve for values of backupRevisionStr.
+//
+// A partially downloaded file left by a previous attempt is resumed if it belongs
+// to the same object, otherwise it is truncated. See resume.go for details.
+func (d S3Downloader) Download(ctx context.Context, bucketName, databaseName, backupRevisionStr, backupPath string) (string, error) {
+	selectedBackupKey, err := d.ResolveRevision(ctx, bucketName, databaseName, backupRevisionStr)
+	if err != nil {
+		return "", err
+	}
+
+	var head *s3.HeadObjectOutput
+	err = retry.Do(ctx, d.opts.Retry, retry.IsTransient, func(ctx context.Context) (err error) {
+		head, err = d.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(selectedBackupKey),
+		})
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get S3 object: %v", err)
+	}
+	object := downloadState{
+		Key:  selectedBackupKey,
+		ETag: aws.ToString(head.ETag),
+		Size: aws.ToInt64(head.ContentLength),
+	}
+
+	err = retry.Do(ctx, d.opts.Retry, retry.IsTransient, func(ctx context.Context) error {
+		return d.fetch(ctx, bucketName, object, backupPath)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if d.opts.VerifyChecksum {
+		err = d.verify(ctx, bucketName, object, backupPath)
+		if err != nil {
+			// Drop corrupted file, so that the next attempt starts over.
+			_ = RemoveDownload(backupPath)
+			return "", err
+		}
+	}
+
+	return selectedBackupKey, nil
+}
+
+// GetManifest returns manifest of backup stored under backupKey.
+func (d S3Downloader) GetManifest(ctx context.Context, bucketName, backupKey string) (manifest.Manifest, error) {
+	var resp *s3.GetObjectOutput
+	err := retry.Do(ctx, d.opts.Retry, retry.IsTransient, func(ctx context.Context) (err error) {
+		resp, err = d.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(manifest.KeyFor(backupKey)),
+		})
+		return err
+	})
+	if err != nil {
+		return manifest.Manifest{}, fmt.Errorf("failed to get manifest: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return manifest.Manifest{}, fmt.Errorf("failed to read manifest: %v", err)
+	}
+
+	return manifest.Parse(data)
+}
+
+// listWithManifests returns all backups stored in backupDir and set of keys of their manifests.
+func (d S3Downloader) listWithManifests(ctx context.Context, bucketName, backupDir string) ([]types.Object, map[string]bool, error) {
+	objects := []types.Object{}
+	manifests := map[string]bool{}
+	paginator := s3.NewListObjectsV2Paginator(d.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(ensureTrailingSlash(backupDir)),
+	})
+	for paginator.HasMorePages() {
+		var page *s3.ListObjectsV2Output
+		err := retry.Do(ctx, d.opts.Retry, retry.IsTransient, func(ctx context.Context) (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list objects: %+v", err)
+		}
+		for _, obj := range page.Contents {
+			if manifest.IsManifestKey(*obj.Key) {
+				manifests[*obj.Key] = true
+			} else {
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	return objects, manifests, nil
+}
+
+// ensureTrailingSlash adds trailing slash to s if it is not added yet.
+func ensureTrailingSlash(s string) string {
+	if !strings.HasSuffix(s, "/") {
+		s = fmt.Sprint(s, "/")
+	}
+	return s
+}
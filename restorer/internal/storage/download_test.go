@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+)
+
+func listOutput() *s3.ListObjectsV2Output {
+	now := time.Now()
+	return &s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("db/old-backup.sql"), LastModified: aws.Time(now.Add(-2 * time.Hour))},
+			{Key: aws.String("db/new-backup.sql"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+			{Key: aws.String("db/new-backup.sql.manifest.json"), LastModified: aws.Time(now.Add(-1 * time.Hour))},
+		},
+	}
+}
+
+// mockNewManifest makes client return manifest of db/new-backup.sql from listOutput.
+func mockNewManifest(client *MockS3Client) {
+	// Body is replaced on every call, as manifest is read repeatedly.
+	output := &s3.GetObjectOutput{}
+	client.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("db/new-backup.sql.manifest.json"),
+	}).Run(func(mock.Arguments) {
+		output.Body = io.NopCloser(strings.NewReader(`{"backupKey": "db/new-backup.sql"}`))
+	}).Return(output, nil)
+}
+
+// mockListed makes client list backups stored under keys.
+func mockListed(client *MockS3Client, keys ...string) {
+	objects := []types.Object{}
+	for _, key := range keys {
+		objects = append(objects, types.Object{Key: aws.String(key), LastModified: aws.Time(time.Now())})
+	}
+	client.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: objects}, nil)
+}
+
+func Test_ResolveRevision_Index(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(listOutput(), nil)
+	mockNewManifest(mockClient)
+
+	key, err := d.ResolveRevision(context.Background(), "bucket", "db", "0")
+	require.NoError(t, err)
+	assert.Equal(t, "db/new-backup.sql", key)
+
+	key, err = d.ResolveRevision(context.Background(), "bucket", "db", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "db/old-backup.sql", key)
+}
+
+func Test_ResolveRevision_Index_OutOfRange(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(listOutput(), nil)
+	mockNewManifest(mockClient)
+
+	_, err := d.ResolveRevision(context.Background(), "bucket", "db", "2")
+	require.ErrorContains(t, err, "out of range")
+}
+
+func Test_ResolveRevision_Index_ListError(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).
+		Return((*s3.ListObjectsV2Output)(nil), fmt.Errorf("list error"))
+
+	_, err := d.ResolveRevision(context.Background(), "bucket", "db", "0")
+	require.ErrorContains(t, err, "failed to list objects")
+}
+
+// dumpETag is ETag of a single-part upload of "dump".
+const dumpETag = `"b9ef165b255673dde47bff07f4390fb1"`
+
+func headOutput(etag string, size int64) *s3.HeadObjectOutput {
+	return &s3.HeadObjectOutput{ETag: aws.String(etag), ContentLength: aws.Int64(size)}
+}
+
+func Test_Download_ByRevision(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(listOutput(), nil)
+	mockNewManifest(mockClient)
+	mockClient.On("HeadObject", mock.Anything, mock.Anything).Return(headOutput(`"etag-1"`, 4), nil)
+	mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("db/new-backup.sql"),
+		IfMatch: aws.String(`"etag-1"`),
+	}).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("dump"))}, nil)
+
+	backupPath := filepath.Join(t.TempDir(), "backup.sql")
+	key, err := d.Download(context.Background(), "bucket", "db", "0", backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "db/new-backup.sql", key)
+
+	content, err := os.ReadFile(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "dump", string(content))
+}
+
+func Test_Download_ByKey(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockListed(mockClient, "db/2025-01-01-00-00-00-backup.sql")
+	mockClient.On("HeadObject", mock.Anything, &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("db/2025-01-01-00-00-00-backup.sql"),
+	}).Return((*s3.HeadObjectOutput)(nil), fmt.Errorf("no such key"))
+
+	_, err := d.Download(context.Background(), "bucket", "db", "db/2025-01-01-00-00-00-backup.sql",
+		filepath.Join(t.TempDir(), "backup.sql"))
+	require.ErrorContains(t, err, "failed to get S3 object")
+
+	_, err = d.Download(context.Background(), "bucket", "db", "other/2025-01-01-00-00-00-backup.sql",
+		filepath.Join(t.TempDir(), "backup.sql"))
+	require.ErrorContains(t, err, "no backup matches revision")
+	mockClient.AssertNumberOfCalls(t, "HeadObject", 1)
+}
+
+func Test_Download_TruncatesStaleFile(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockListed(mockClient, "db/backup.sql")
+	mockClient.On("HeadObject", mock.Anything, mock.Anything).Return(headOutput(`"etag-2"`, 4), nil)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return input.Range == nil
+	})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("dump"))}, nil)
+
+	backupPath := filepath.Join(t.TempDir(), "backup.sql")
+	require.NoError(t, os.WriteFile(backupPath, []byte("stale dump"), 0644))
+	require.NoError(t, writeState(backupPath, downloadState{Key: "db/backup.sql", ETag: `"etag-1"`, Size: 10}))
+
+	_, err := d.Download(context.Background(), "bucket", "db", "db/backup.sql", backupPath)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "dump", string(content))
+}
+
+func Test_Download_Resumes(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient, opts: DownloadOptions{VerifyChecksum: true}}
+	mockListed(mockClient, "db/backup.sql")
+	object := downloadState{Key: "db/backup.sql", ETag: dumpETag, Size: 4}
+	mockClient.On("HeadObject", mock.Anything, mock.Anything).Return(headOutput(object.ETag, object.Size), nil)
+	mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("db/backup.sql"),
+		IfMatch: aws.String(dumpETag),
+		Range:   aws.String("bytes=2-"),
+	}).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("mp")), ContentRange: aws.String("bytes 2-3/4")}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), fmt.Errorf("no such key"))
+
+	backupPath := filepath.Join(t.TempDir(), "backup.sql")
+	require.NoError(t, os.WriteFile(backupPath, []byte("du"), 0644))
+	require.NoError(t, writeState(backupPath, object))
+
+	_, err := d.Download(context.Background(), "bucket", "db", "db/backup.sql", backupPath)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "dump", string(content))
+}
+
+func Test_Download_RangeIgnored(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		contentRange *string
+	}{
+		{"full body", nil},
+		{"other range", aws.String("bytes 0-3/4")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mockClient := new(MockS3Client)
+			d := S3Downloader{client: mockClient}
+			mockListed(mockClient, "db/backup.sql")
+			object := downloadState{Key: "db/backup.sql", ETag: dumpETag, Size: 4}
+			mockClient.On("HeadObject", mock.Anything, mock.Anything).Return(headOutput(object.ETag, object.Size), nil)
+			mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+				return input.Range != nil
+			})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("dump")), ContentRange: tc.contentRange}, nil)
+			mockClient.On("GetObject", mock.Anything, mock.Anything).
+				Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("dump"))}, nil)
+
+			backupPath := filepath.Join(t.TempDir(), "backup.sql")
+			require.NoError(t, os.WriteFile(backupPath, []byte("du"), 0644))
+			require.NoError(t, writeState(backupPath, object))
+
+			_, err := d.Download(context.Background(), "bucket", "db", "db/backup.sql", backupPath)
+			require.NoError(t, err)
+
+			content, err := os.ReadFile(backupPath)
+			require.NoError(t, err)
+			assert.Equal(t, "dump", string(content))
+		})
+	}
+}
+
+func Test_Download_ChecksumMismatch(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient, opts: DownloadOptions{VerifyChecksum: true}}
+	mockListed(mockClient, "db/backup.sql")
+	mockClient.On("HeadObject", mock.Anything, mock.Anything).Return(headOutput(`"etag-1"`, 4), nil)
+	mockClient.On("GetObject", mock.Anything, mock.MatchedBy(func(input *s3.GetObjectInput) bool {
+		return *input.Key == "db/backup.sql.manifest.json"
+	})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(`{"sha256": "0000"}`))}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.Anything).
+		Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("dump"))}, nil)
+
+	backupPath := filepath.Join(t.TempDir(), "backup.sql")
+	_, err := d.Download(context.Background(), "bucket", "db", "db/backup.sql", backupPath)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+
+	assert.NoFileExists(t, backupPath)
+	assert.NoFileExists(t, backupPath+stateSuffix)
+}
+
+func Test_GetManifest(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("db/new-backup.sql.manifest.json"),
+	}).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(
+		`{"database": "db", "scope": {"excludeTables": ["cache"]}}`,
+	))}, nil)
+
+	m, err := d.GetManifest(context.Background(), "bucket", "db/new-backup.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "db", m.Database)
+	assert.Equal(t, []string{"cache"}, m.Scope.ExcludeTables)
+}
+
+func Test_GetManifest_NotFound(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient}
+	mockClient.On("GetObject", mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), fmt.Errorf("no such key"))
+
+	_, err := d.GetManifest(context.Background(), "bucket", "db/new-backup.sql")
+	require.ErrorContains(t, err, "failed to get manifest")
+}
+
+func Test_Download_RetriesFromLastByte(t *testing.T) {
+	mockClient := new(MockS3Client)
+	d := S3Downloader{client: mockClient, opts: DownloadOptions{VerifyChecksum: true, Retry: retry.Policy{Attempts: 2}}}
+	mockListed(mockClient, "db/backup.sql")
+	mockClient.On("HeadObject", mock.Anything, mock.Anything).Return(headOutput(dumpETag, 4), nil)
+	mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("db/backup.sql"),
+		IfMatch: aws.String(dumpETag),
+	}).Return(&s3.GetObjectOutput{Body: io.NopCloser(io.MultiReader(
+		strings.NewReader("du"), iotest.ErrReader(syscall.ECONNRESET),
+	))}, nil)
+	mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("db/backup.sql"),
+		IfMatch: aws.String(dumpETag),
+		Range:   aws.String("bytes=2-"),
+	}).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("mp")), ContentRange: aws.String("bytes 2-3/4")}, nil)
+	mockClient.On("GetObject", mock.Anything, mock.Anything).Return((*s3.GetObjectOutput)(nil), fmt.Errorf("no such key"))
+
+	backupPath := filepath.Join(t.TempDir(), "backup.sql")
+	_, err := d.Download(context.Background(), "bucket", "db", "db/backup.sql", backupPath)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(backupPath)
+	require.NoError(t, err)
+	assert.Equal(t, "dump", string(content))
+}
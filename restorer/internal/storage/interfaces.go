@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// An IS3Client provides functionality to work with s3-compatible storage.
+//
+// See https://pkg.go.dev/github.com/aws/aws-sdk-go-v2 for more information.
+type IS3Client interface {
+	// ListObjectsV2 returns list of objects in a specified bucket.
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	// HeadObject returns metadata of a specified object.
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	// GetObject returns content of a specified object.
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	// PutObject stores an object in a specified bucket.
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
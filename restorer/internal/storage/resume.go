@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// stateSuffix is appended to a backup path to get path of its download state.
+const stateSuffix = ".state"
+
+// singlePartETag matches ETag of an object uploaded in a single part without
+// SSE-KMS, which is MD5 of its content. Multipart ETags contain a dash.
+var singlePartETag = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ErrChecksumMismatch is returned when downloaded backup differs from the stored one.
+var ErrChecksumMismatch = errors.New("checksum of downloaded backup does not match")
+
+// A downloadState identifies the object a local file is downloaded from.
+// It is written before the first byte, so that a retried Pod knows whether
+// a file left in scratch directory can be resumed.
+type downloadState struct {
+	Key  string `json:"key"`
+	ETag string `json:"etag"`
+	Size int64  `json:"size"`
+}
+
+// fetch downloads object to backupPath. Errors of requests and of reading
+// response are wrapped, so that callers can retry transient ones. If backupPath holds a prefix of the same
+// object, only the rest is requested with a ranged GET. The request is conditional
+// on ETag, so an object replaced in the meantime is never mixed with the old one.
+// If the response does not start at the requested offset, e.g. the server
+// ignored Range and sent the whole object, the file is downloaded from scratch.
+func (d S3Downloader) fetch(ctx context.Context, bucketName string, object downloadState, backupPath string) error {
+	offset := resumeOffset(backupPath, object)
+	if offset > 0 && offset == object.Size {
+		return nil
+	}
+	if offset == 0 {
+		err := writeState(backupPath, object)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := d.getObject(ctx, bucketName, object, offset)
+	if err != nil {
+		return err
+	}
+	defer func() { resp.Body.Close() }()
+	if offset > 0 && !startsAt(resp.ContentRange, offset) {
+		offset = 0
+		if resp.ContentRange != nil {
+			resp.Body.Close()
+			resp, err = d.getObject(ctx, bucketName, object, 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(backupPath, flag, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %v", err)
+	}
+	_, err = io.Copy(file, resp.Body)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write S3 object to file: %w", err)
+	}
+	// Close reports errors of delayed writes, so it is checked
+	// before the file is handed to pg_restore.
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write S3 object to file: %v", err)
+	}
+
+	return nil
+}
+
+// getObject requests object from offset on, conditional on its ETag.
+func (d S3Downloader) getObject(ctx context.Context, bucketName string, object downloadState, offset int64) (*s3.GetObjectOutput, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(object.Key),
+	}
+	if object.ETag != "" {
+		input.IfMatch = aws.String(object.ETag)
+	}
+	if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get S3 object: %w", err)
+	}
+	return resp, nil
+}
+
+// startsAt reports whether Content-Range header, e.g. "bytes 2-3/4",
+// describes a part starting at offset.
+func startsAt(contentRange *string, offset int64) bool {
+	if contentRange == nil {
+		return false
+	}
+	var start, end, size int64
+	_, err := fmt.Sscanf(*contentRange, "bytes %d-%d/%d", &start, &end, &size)
+	return err == nil && start == offset
+}
+
+// resumeOffset returns size of the already downloaded prefix of object.
+// It is zero if backupPath is missing, was downloaded from another object
+// or is larger than object.
+func resumeOffset(backupPath string, object downloadState) int64 {
+	if object.ETag == "" {
+		return 0
+	}
+	data, err := os.ReadFile(backupPath + stateSuffix)
+	if err != nil {
+		return 0
+	}
+	var state downloadState
+	if json.Unmarshal(data, &state) != nil || state != object {
+		return 0
+	}
+	info, err := os.Stat(backupPath)
+	if err != nil || info.Size() > object.Size {
+		return 0
+	}
+	return info.Size()
+}
+
+// writeState records object backupPath is about to be downloaded from.
+func writeState(backupPath string, object downloadState) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("failed to encode download state: %v", err)
+	}
+	err = os.WriteFile(backupPath+stateSuffix, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write download state: %v", err)
+	}
+	return nil
+}
+
+// verify compares downloaded file with SHA-256 checksum from manifest of the backup.
+// Backups without checksum in manifest are compared with ETag if it is MD5 of the object,
+// and are not verified otherwise.
+func (d S3Downloader) verify(ctx context.Context, bucketName string, object downloadState, backupPath string) error {
+	var h hash.Hash
+	var expected string
+	m, err := d.GetManifest(ctx, bucketName, object.Key)
+	etag := strings.Trim(object.ETag, `"`)
+	switch {
+	case err == nil && m.SHA256 != "":
+		h, expected = sha256.New(), m.SHA256
+	case singlePartETag.MatchString(etag):
+		h, expected = md5.New(), etag
+	default:
+		return nil
+	}
+
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %v", err)
+	}
+	defer file.Close()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return fmt.Errorf("failed to read backup file: %v", err)
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expected, actual)
+	}
+	return nil
+}
+
+// RemoveDownload removes downloaded backup and its download state.
+func RemoveDownload(backupPath string) error {
+	err := os.Remove(backupPath + stateSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = os.Remove(backupPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
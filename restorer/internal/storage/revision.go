@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/revision"
+)
+
+// ResolveRevision returns key of the backup of databaseName selected by
+// backupRevision. See revision.Resolve for accepted values.
+func (d S3Downloader) ResolveRevision(ctx context.Context, bucketName, databaseName, backupRevision string) (string, error) {
+	err := revision.Validate(backupRevision)
+	if err != nil {
+		return "", err
+	}
+	objects, manifests, err := d.listWithManifests(ctx, bucketName, databaseName)
+	if err != nil {
+		return "", fmt.Errorf("failed to list backup files from S3: %v", err)
+	}
+
+	backups := make([]revision.Backup, 0, len(objects))
+	for _, obj := range objects {
+		backups = append(backups, revision.Backup{
+			Key:          aws.ToString(obj.Key),
+			LastModified: aws.ToTime(obj.LastModified),
+			HasManifest:  manifests[manifest.KeyFor(aws.ToString(obj.Key))],
+		})
+	}
+	key, err := revision.Resolve(ctx, backupRevision, backups, func(ctx context.Context, key string) (manifest.Manifest, error) {
+		return d.GetManifest(ctx, bucketName, key)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve revision of %s: %v", databaseName, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/revision/revisiontest"
+)
+
+// revisionsClient returns client storing revisiontest.Backups with their manifests.
+func revisionsClient(t *testing.T) *MockS3Client {
+	mockClient := new(MockS3Client)
+	objects := []types.Object{}
+	for _, b := range revisiontest.Backups {
+		objects = append(objects, types.Object{Key: aws.String(b.Key), LastModified: aws.Time(b.LastModified)})
+		if b.Manifest == nil {
+			continue
+		}
+		objects = append(objects, types.Object{Key: aws.String(manifest.KeyFor(b.Key)), LastModified: aws.Time(b.LastModified)})
+		data, err := b.Manifest.Marshal()
+		require.NoError(t, err)
+		// Body is replaced on every call, as manifests are read repeatedly.
+		output := &s3.GetObjectOutput{}
+		mockClient.On("GetObject", mock.Anything, &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(manifest.KeyFor(b.Key)),
+		}).Run(func(mock.Arguments) {
+			output.Body = io.NopCloser(strings.NewReader(string(data)))
+		}).Return(output, nil)
+	}
+	mockClient.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: objects}, nil)
+	return mockClient
+}
+
+func Test_ResolveRevision(t *testing.T) {
+	d := S3Downloader{client: revisionsClient(t)}
+
+	for revision, expected := range revisiontest.Resolved {
+		key, err := d.ResolveRevision(context.Background(), "bucket", revisiontest.Database, revision)
+		require.NoError(t, err, revision)
+		assert.Equal(t, expected, key, revision)
+	}
+}
+
+func Test_ResolveRevision_NotFound(t *testing.T) {
+	d := S3Downloader{client: revisionsClient(t)}
+
+	for revision, expected := range revisiontest.Unresolved {
+		_, err := d.ResolveRevision(context.Background(), "bucket", revisiontest.Database, revision)
+		assert.ErrorContains(t, err, expected, revision)
+	}
+}
+
+func Test_ResolveRevision_Invalid(t *testing.T) {
+	// Storage is not listed for revisions which cannot be resolved anyway.
+	d := S3Downloader{client: new(MockS3Client)}
+
+	_, err := d.ResolveRevision(context.Background(), "bucket", "db", "latest-before=2025-01-01")
+	assert.ErrorContains(t, err, "invalid revision")
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+)
+
+// An UploadOptions describes how objects are uploaded.
+type UploadOptions struct {
+	Retry retry.Policy // Retries of uploads failed with transient errors
+}
+
+// A S3Uploader provides methods to upload file to s3-compatible storage.
+type S3Uploader struct {
+	client IS3Client
+	opts   UploadOptions
+}
+
+// NewS3Uploader is a constructor for S3Uploader.
+//
+// It configures and instantiates s3-client according to cc.
+func NewS3Uploader(ctx context.Context, cc s3client.Config, opts UploadOptions) (S3Uploader, error) { // coverage-ignore
+	client, err := s3client.New(ctx, cc)
+	if err != nil {
+		return S3Uploader{}, err
+	}
+
+	return S3Uploader{
+		client: client,
+		opts:   opts,
+	}, nil
+}
+
+// Upload uploads a single file to storage.
+// fileContent should be seekable to let s3-client compute its length and checksum.
+// Uploads of content which is not seekable are not retried.
+func (u S3Uploader) Upload(ctx context.Context, bucketName, objectKey string, fileContent io.Reader) error {
+	policy := u.opts.Retry
+	seeker, seekable := fileContent.(io.Seeker)
+	if !seekable {
+		policy.Attempts = 1
+	}
+	err := retry.Do(ctx, policy, retry.IsTransient, func(ctx context.Context) error {
+		if seekable {
+			_, err := seeker.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := u.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(objectKey),
+			Body:   fileContent,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put S3 object: %v", err)
+	}
+
+	return nil
+}
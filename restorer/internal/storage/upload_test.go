@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/retry"
+)
+
+func Test_Upload(t *testing.T) {
+	mockClient := new(MockS3Client)
+	u := S3Uploader{client: mockClient}
+
+	body := strings.NewReader("dump")
+	mockClient.On("PutObject", mock.Anything, &s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("pre-restore/db/backup.sql"),
+		Body:   body,
+	}).Return(&s3.PutObjectOutput{}, nil)
+
+	err := u.Upload(context.Background(), "bucket", "pre-restore/db/backup.sql", body)
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func Test_Upload_Error(t *testing.T) {
+	mockClient := new(MockS3Client)
+	u := S3Uploader{client: mockClient}
+
+	mockClient.On("PutObject", mock.Anything, mock.Anything).Return((*s3.PutObjectOutput)(nil), fmt.Errorf("access denied"))
+
+	err := u.Upload(context.Background(), "bucket", "pre-restore/db/backup.sql", strings.NewReader("dump"))
+	require.ErrorContains(t, err, "failed to put S3 object")
+}
+
+func Test_Upload_RetriesTransient(t *testing.T) {
+	mockClient := new(MockS3Client)
+	u := S3Uploader{client: mockClient, opts: UploadOptions{Retry: retry.Policy{Attempts: 2}}}
+
+	mockClient.On("PutObject", mock.Anything, mock.Anything).
+		Return((*s3.PutObjectOutput)(nil), &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}).Once()
+	mockClient.On("PutObject", mock.Anything, mock.Anything).Return(&s3.PutObjectOutput{}, nil).Once()
+
+	body := strings.NewReader("dump")
+	_, err := body.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+
+	err = u.Upload(context.Background(), "bucket", "pre-restore/db/backup.sql", body)
+	require.NoError(t, err)
+	mockClient.AssertNumberOfCalls(t, "PutObject", 2)
+	assert.Equal(t, 4, body.Len())
+}
@@ -0,0 +1,66 @@
+// Package tracing exports OpenTelemetry traces of restorer. Restore runs in
+// trace of the scheduler request which created its Job.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies restorer in exported traces.
+const ServiceName = "oiler-postgres-restorer"
+
+// tracerName is the instrumentation scope of restorer spans.
+const tracerName = "github.com/oiler-backup/postgres-adapter/restorer/internal/tracing"
+
+// Setup exports spans over OTLP/gRPC to endpoint, e.g. http://otel-collector:4317.
+// Returns function flushing spans, which must be called before exit.
+// Tracing is disabled if endpoint is empty.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// StartRun starts root span of a restore run as a child of span described by
+// W3C traceParent and traceState, i.e. of the request which created Job.
+// A new trace is started if traceParent is empty or invalid.
+func StartRun(ctx context.Context, name, traceParent, traceState string) (context.Context, trace.Span) {
+	carrier := propagation.MapCarrier{"traceparent": traceParent, "tracestate": traceState}
+	return Start(otel.GetTextMapPropagator().Extract(ctx, carrier), name)
+}
+
+// Start starts span name as a child of span in ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End records err in span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
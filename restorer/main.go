@@ -1,24 +1,61 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+	"github.com/oiler-backup/postgres-adapter/common/pgclient"
+	"github.com/oiler-backup/postgres-adapter/common/pgoutput"
+	"github.com/oiler-backup/postgres-adapter/common/retry"
 	"github.com/oiler-backup/postgres-adapter/restorer/internal/config"
-	"github.com/oiler-backup/postgres-adapter/restorer/internal/restorer"
+	restorerpkg "github.com/oiler-backup/postgres-adapter/restorer/internal/restorer"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/storage"
+	"github.com/oiler-backup/postgres-adapter/restorer/internal/tracing"
 
 	loggerbase "github.com/oiler-backup/base/logger"
 	metricsbase "github.com/oiler-backup/base/metrics"
-	s3base "github.com/oiler-backup/base/s3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-// Constants for S3 region and backup path.
+// Constants for backup file names in SCRATCH_DIR.
 const (
-	S3REGION    = "us-east-1" // Fictitious
-	BACKUP_PATH = "/tmp/backup.sql"
+	BACKUP_FILE   = "backup.sql"
+	SNAPSHOT_FILE = "pre-restore.sql"
+
+	// TERMINATION_LOG_PATH is a default path of Kubernetes termination message
+	// used to expose restore result in Pod status.
+	TERMINATION_LOG_PATH = "/dev/termination-log"
+
+	// REPORT_TIMEOUT limits reporting status to core, including retries. Status is reported with
+	// a separate context as the restore one might be already cancelled.
+	REPORT_TIMEOUT = 30 * time.Second
+)
+
+// Restore statuses. RestoreMetrics has no status field, so every failure is
+// reported to core with FAILED_TIME_ELAPSED. Statuses and classes of failures
+// are distinguished by the termination message and by exit code of the Job.
+const (
+	STATUS_FAILED    = "Failed"
+	STATUS_TIMED_OUT = "TimedOut"
+	STATUS_CANCELLED = "Cancelled"
+
+	FAILED_TIME_ELAPSED = -1
+
+	EXIT_FAILED    = 1
+	EXIT_TIMED_OUT = 124 // Same as timeout(1)
+	EXIT_CANCELLED = 143 // 128 + SIGTERM
 )
 
 // Global variables for logger, metrics reporter, context, and backup name.
@@ -27,13 +64,20 @@ var (
 	metricsReporter metricsbase.MetricsReporter
 	ctx             context.Context
 	backupInfo      string
+	result          = map[string]string{} // Restore result exposed in termination message
+	retryPolicy     retry.Policy          // Retries of transient failures, zero until configured
+	runSpan         trace.Span            // Root span of restore run
+	shutdownTracing func(context.Context) error
 )
 
 // main initializes the logger, configuration, restorer, metrics reporter,
 // and S3 downloader. It then downloads the backup file from S3, restores it,
 // reports the status, and logs the success message.
 func main() {
-	ctx = context.Background()
+	// Cancel download and pg_restore when Kubernetes terminates the Pod.
+	var stop context.CancelFunc
+	ctx, stop = signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
 	// Initialize the Zap logger with production settings.
 	var err error
@@ -48,54 +92,360 @@ func main() {
 		panic(fmt.Sprintf("Failed to configurate: %v", err))
 	}
 
+	// Join trace of the scheduler request which created the Job.
+	shutdownTracing, err = tracing.Setup(ctx, cfg.OtlpEndpoint)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to set up tracing: %v", err))
+	}
+	ctx, runSpan = tracing.StartRun(ctx, "restore", cfg.TraceParent, cfg.TraceState)
+
 	// Create a new MetricsReporter instance with the provided configuration.
 	metricsReporter = metricsbase.NewMetricsReporter(cfg.CoreAddr, false)
+	// The whole run is reported under the requested revision, so that core
+	// sees a single restore. The resolved key goes to logs and termination message.
+	backupInfo = restoreInfo(cfg, cfg.BackupRevision)
+	retryPolicy = cfg.RetryPolicy()
+	retryPolicy.Notify = logRetry
+	if cfg.RestoreTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.RestoreTimeout)
+		defer cancel()
+	}
 	// Create a new Restorer instance with the provided configuration.
-	restorer := restorer.NewRestorer(cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbPassword, cfg.DbName, BACKUP_PATH)
+	backupPath := filepath.Join(cfg.ScratchDir, BACKUP_FILE)
+	restoreOpts := cfg.RestoreOptions()
+	restoreOpts.Retry = retryPolicy
+	restoreOpts.Clients, err = pgclient.Find(ctx, cfg.PgClientDirs)
+	if err != nil {
+		mustProccessErrors("Failed to find client tools", err)
+	}
+	restorer := restorerpkg.NewRestorer(cfg.DbHost, cfg.DbPort, cfg.DbUser, cfg.DbPassword, cfg.DbName, backupPath, restoreOpts)
 	// Create a new S3Downloader instance with the provided configuration.
-	downloader, err := s3base.NewS3Downloader(ctx, cfg.S3Endpoint, cfg.S3AccessKey, cfg.S3SecretKey, S3REGION, cfg.Secure)
+	downloader, err := storage.NewS3Downloader(ctx, cfg.StorageConfig(), downloadOptions(cfg))
 	if err != nil {
 		mustProccessErrors("Failed to create downloader", err)
 	}
 
-	backupInfo = fmt.Sprintf("%s:%s/%s-revision-%s", cfg.DbHost, cfg.DbPort, cfg.DbName, cfg.BackupRevision)
-
-	// Open a backup file for writing.
-	backupFile, err := os.OpenFile(BACKUP_PATH, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	start := time.Now()
+	// Download the backup file from S3. A file left by a previous attempt
+	// in SCRATCH_DIR is resumed or truncated by downloader.
+	downloadCtx, cancelDownload := withTimeout(ctx, cfg.DownloadTimeout)
+	downloadCtx, downloadSpan := tracing.Start(downloadCtx, "download")
+	bucketName := cfg.S3BucketName
+	backupKey, err := downloader.Download(downloadCtx, bucketName, cfg.SourceDatabase(), cfg.BackupRevision, backupPath)
+	if err != nil && cfg.FallbackEnabled() && downloadCtx.Err() == nil {
+		logger.Warnw("Failed to download from primary S3, falling back to replica", "error", err)
+		bucketName = cfg.ReplicaS3BucketName
+		downloader, backupKey, err = downloadFromReplica(downloadCtx, cfg, backupPath)
+	}
+	tracing.End(downloadSpan, err)
 	if err != nil {
-		mustProccessErrors("Failed to open backupFile: %+v", err)
+		mustProccessPhaseErrors(downloadCtx, "Failed to perform download", err)
 	}
+	cancelDownload()
+	// Revisions such as latest are resolved at download time, so the concrete
+	// one is logged and written to termination message to tell which backup is restored.
+	logger.Infow("Backup revision was resolved", "revision", cfg.BackupRevision, "backup", backupKey)
+	writeResult("backupRevision", backupKey)
+	restorer = restorer.WithFormat(readManifest(downloader, bucketName, backupKey).Format)
 
-	start := time.Now()
-	// Download the backup file from S3.
-	err = downloader.Download(ctx, cfg.S3BucketName, cfg.DbName, cfg.BackupRevision, backupFile)
-	if err != nil {
-		mustProccessErrors("Failed to perform download", err)
+	if cfg.PreRestoreSnapshot {
+		snapshotKey, err := uploadSnapshot(cfg, restorer)
+		if err != nil {
+			mustProccessErrors("Failed to take pre-restore snapshot", err)
+		}
+		if snapshotKey != "" {
+			logger.Infow("Pre-restore snapshot was uploaded", "revision", snapshotKey)
+			writeResult("preRestoreRevision", snapshotKey)
+		}
 	}
 
-	// Restore the backup file to the MongoDB database.
-	err = restorer.Restore(ctx)
+	// Restore the backup file to the PostgreSQL database.
+	restoreCtx, cancelRestore := withTimeout(ctx, cfg.PgRestoreTimeout)
+	err = restorer.Restore(restoreCtx)
+	if err != nil {
+		mustProccessPhaseErrors(restoreCtx, "Faild to restore backup", err)
+	}
+	cancelRestore()
+	err = runPostRestore(restorer)
+	if err != nil {
+		mustProccessErrors("Failed post-restore step", err)
+	}
+	// Downloaded backup is kept after failures, so that a retried Pod
+	// with persistent SCRATCH_DIR does not download it again.
+	err = storage.RemoveDownload(backupPath)
 	if err != nil {
-		mustProccessErrors("Faild to restore backup", err)
+		logger.Warnw("Failed to remove downloaded backup", "error", err)
+	}
+	if cfg.RestoreMode == restorerpkg.ModeSwap {
+		dropExpiredPreRestore(restorer)
 	}
 
 	// Report the successful restoration status.
 	timeElapsed := time.Since(start)
-	err = metricsReporter.ReportRestoreStatus(ctx, backupInfo, true, int64(timeElapsed.Milliseconds()))
+	err = reportStatus(true, timeElapsed.Milliseconds())
 	if err != nil {
 		mustProccessErrors("Failed to report successful status", err)
 	}
 	// Log the success message.
 	logger.Infof("Backup was applied successfully")
+	endTrace(nil)
+}
+
+// downloadOptions returns download options of cfg with retries logged.
+func downloadOptions(cfg config.Config) storage.DownloadOptions {
+	opts := cfg.DownloadOptions()
+	opts.Retry = retryPolicy
+	return opts
+}
+
+// logRetry logs an operation failed with transient error before it is retried.
+func logRetry(err error, attempt int, delay time.Duration) {
+	logger.Warnw("Operation failed, retrying", "error", err, "attempt", attempt, "delay", delay)
+}
+
+// reportStatus reports restore status to core. Status is reported with a separate
+// context as the restore one might be already cancelled. Transient failures are retried.
+func reportStatus(success bool, timeElapsed int64) error {
+	reportCtx, cancel := context.WithTimeout(context.Background(), REPORT_TIMEOUT)
+	defer cancel()
+	return retry.Do(reportCtx, retryPolicy, retry.IsTransient, func(ctx context.Context) error {
+		return metricsReporter.ReportRestoreStatus(ctx, backupInfo, success, timeElapsed)
+	})
+}
+
+// restoreInfo returns name restore of requested backup revision is reported to core under.
+func restoreInfo(cfg config.Config, revision string) string {
+	info := fmt.Sprintf("%s:%s/%s-revision-%s", cfg.DbHost, cfg.DbPort, cfg.DbName, revision)
+	if cfg.SourceDatabase() != cfg.DbName {
+		info = fmt.Sprintf("%s-from-%s", info, cfg.SourceDatabase())
+	}
+	return info
+}
+
+// downloadFromReplica downloads the backup file from the secondary S3 storage.
+// Data partially downloaded from the primary one is resumed only if the replica
+// holds the same object, otherwise the local backup file is truncated.
+// Returns downloader of the secondary storage and key of the downloaded backup.
+func downloadFromReplica(ctx context.Context, cfg config.Config, backupPath string) (storage.S3Downloader, string, error) {
+	replicaDownloader, err := storage.NewS3Downloader(ctx, cfg.ReplicaStorageConfig(), downloadOptions(cfg))
+	if err != nil {
+		return storage.S3Downloader{}, "", fmt.Errorf("failed to create replica downloader: %+v", err)
+	}
+
+	backupKey, err := replicaDownloader.Download(ctx, cfg.ReplicaS3BucketName, cfg.SourceDatabase(), cfg.BackupRevision, backupPath)
+	if err != nil {
+		return storage.S3Downloader{}, "", fmt.Errorf("failed to download from replica: %+v", err)
+	}
+	logger.Infof("Backup was downloaded from replica S3")
+
+	return replicaDownloader, backupKey, nil
+}
+
+// dropExpiredPreRestore drops original databases replaced by previous restores
+// in swap mode. Failures are logged and do not fail the restore.
+func dropExpiredPreRestore(restorer restorerpkg.Restorer) {
+	logger.Infow("Original database, if existed, was kept", "database", restorer.PreRestoreDatabase())
+	dropped, err := restorer.DropExpiredPreRestore(ctx)
+	if len(dropped) > 0 {
+		logger.Infow("Dropped expired pre-restore databases", "databases", dropped)
+	}
+	if err != nil {
+		logger.Warnw("Failed to drop expired pre-restore databases", "error", err)
+	}
+}
+
+// uploadSnapshot dumps target database and uploads it to the primary storage
+// as a revision tagged with manifest.TagPreRestore. Snapshots are stored next to
+// backups of the target database with checksum in manifest, so they are
+// listed, resolved and pruned like backups. Returns empty key if target
+// database does not exist.
+func uploadSnapshot(cfg config.Config, restorer restorerpkg.Restorer) (snapshotKey string, err error) {
+	ctx, span := tracing.Start(ctx, "pre_restore_snapshot")
+	defer func() { tracing.End(span, err) }()
+
+	snapshotPath := filepath.Join(cfg.ScratchDir, SNAPSHOT_FILE)
+	taken, err := restorer.Snapshot(ctx, snapshotPath)
+	if err != nil || !taken {
+		return "", err
+	}
+
+	uploadOpts := cfg.UploadOptions()
+	uploadOpts.Retry = retryPolicy
+	uploader, err := storage.NewS3Uploader(ctx, cfg.StorageConfig(), uploadOpts)
+	if err != nil {
+		return "", fmt.Errorf("failed to create uploader: %+v", err)
+	}
+
+	createdAt := time.Now()
+	snapshotKey = fmt.Sprintf("%s/%s-backup%s", cfg.DbName, createdAt.Format("2006-01-02-15-04-05"),
+		restorerpkg.Extension(restorerpkg.SnapshotFormat))
+	snapshotFile, err := os.Open(snapshotPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open snapshot: %+v", err)
+	}
+	defer snapshotFile.Close()
+	snapshotManifest := manifest.New(cfg.DbName, snapshotKey, restorerpkg.SnapshotFormat, createdAt)
+	snapshotManifest.Tags = []string{manifest.TagPreRestore}
+	checkedManifest, err := snapshotManifest.WithChecksum(snapshotFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to build snapshot manifest: %+v", err)
+	}
+
+	// Uploads of seekable files start from the beginning.
+	err = uploader.Upload(ctx, cfg.S3BucketName, snapshotKey, snapshotFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload snapshot: %+v", err)
+	}
+
+	data, err := checkedManifest.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to build snapshot manifest: %+v", err)
+	}
+	err = uploader.Upload(ctx, cfg.S3BucketName, manifest.KeyFor(snapshotKey), bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload snapshot manifest: %+v", err)
+	}
+
+	return snapshotKey, nil
+}
+
+// runPostRestore runs post-restore steps on the restored database.
+// Result of every step is logged and added to restore result as
+// "postRestore" list of "<step>=ok" or "<step>=failed" entries.
+func runPostRestore(restorer restorerpkg.Restorer) (err error) {
+	ctx, span := tracing.Start(ctx, "post_restore")
+	defer func() { tracing.End(span, err) }()
+
+	results, err := restorer.PostRestore(ctx)
+	if len(results) == 0 {
+		return err
+	}
+
+	outcomes := make([]string, 0, len(results))
+	for _, result := range results {
+		span.AddEvent(result.Step, trace.WithAttributes(
+			attribute.String("duration", result.Duration.String()),
+			attribute.Bool("failed", result.Err != nil),
+		))
+		if result.Err != nil {
+			logger.Errorw("Post-restore step failed", "step", result.Step, "duration", result.Duration, "error", result.Err)
+			outcomes = append(outcomes, result.Step+"=failed")
+			continue
+		}
+		logger.Infow("Post-restore step completed", "step", result.Step, "duration", result.Duration)
+		outcomes = append(outcomes, result.Step+"=ok")
+	}
+	writeResult("postRestore", strings.Join(outcomes, ","))
+	return err
+}
+
+// logOutput logs parsed output of failed pg_dump or pg_restore, one entry per message.
+func logOutput(err error) {
+	var cmdErr *pgoutput.CommandError
+	if !errors.As(err, &cmdErr) {
+		return
+	}
+	for _, message := range cmdErr.Output {
+		keysAndValues := []any{"program", message.Program, "severity", message.Severity}
+		if message.Code != "" {
+			keysAndValues = append(keysAndValues, "code", message.Code)
+		}
+		if message.Object != "" {
+			keysAndValues = append(keysAndValues, "object", message.Object)
+		}
+		if message.Class != "" {
+			keysAndValues = append(keysAndValues, "class", message.Class)
+		}
+		switch message.Severity {
+		case pgoutput.SeverityError:
+			logger.Errorw(message.Text, keysAndValues...)
+		case pgoutput.SeverityWarning:
+			logger.Warnw(message.Text, keysAndValues...)
+		default:
+			logger.Infow(message.Text, keysAndValues...)
+		}
+	}
+}
+
+// endTrace ends root span of restore run with err and flushes spans.
+func endTrace(err error) {
+	tracing.End(runSpan, err)
+	err = shutdownTracing(context.Background())
+	if err != nil {
+		logger.Errorw("Failed to flush traces", "error", err)
+	}
+}
+
+// withTimeout returns context of a restore phase limited by timeout.
+// Zero timeout leaves phase limited by the overall restore timeout only.
+func withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// writeResult adds key to restore result and writes it to Kubernetes termination message.
+// Failures are logged, e.g. when running outside of Kubernetes.
+func writeResult(key, value string) {
+	result[key] = value
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Warnw("Failed to encode restore result", "error", err)
+		return
+	}
+	err = os.WriteFile(TERMINATION_LOG_PATH, data, 0644)
+	if err != nil {
+		logger.Warnw("Failed to write restore result", "error", err)
+	}
+}
+
+// readManifest returns manifest of the backup and logs objects missing in it.
+// Backups created before manifests were introduced have none, so a missing
+// manifest is not an error: empty manifest is returned and format of the
+// backup is detected from its contents.
+func readManifest(downloader storage.S3Downloader, bucketName, backupKey string) manifest.Manifest {
+	backupManifest, err := downloader.GetManifest(ctx, bucketName, backupKey)
+	if err != nil {
+		logger.Infow("Manifest of backup is not available", "backup", backupKey, "error", err)
+		return manifest.Manifest{}
+	}
+	if backupManifest.Scope.IsPartial() {
+		logger.Warnw("Backup does not contain the whole database", "backup", backupKey, "scope", backupManifest.Scope)
+	}
+	return backupManifest
 }
 
 // mustProccessErrors logs an error message and attempts to report the failure status.
 // If reporting the failure status also fails, it logs a fatal error and exits the program.
 func mustProccessErrors(msg string, err error, keysAndValues ...any) {
-	logger.Errorw(msg, "error", err, keysAndValues)
-	err = metricsReporter.ReportRestoreStatus(ctx, backupInfo, false, -1)
+	mustProccessPhaseErrors(ctx, msg, err, keysAndValues...)
+}
+
+// mustProccessPhaseErrors is like mustProccessErrors, but distinguishes
+// timed out and cancelled restores by phaseCtx the failed phase was running with.
+func mustProccessPhaseErrors(phaseCtx context.Context, msg string, err error, keysAndValues ...any) {
+	class := pgoutput.Classify(err)
+	status, exitCode := STATUS_FAILED, EXIT_FAILED
+	switch {
+	case errors.Is(phaseCtx.Err(), context.DeadlineExceeded):
+		status, exitCode = STATUS_TIMED_OUT, EXIT_TIMED_OUT
+	case errors.Is(phaseCtx.Err(), context.Canceled):
+		status, exitCode = STATUS_CANCELLED, EXIT_CANCELLED
+	}
+
+	logOutput(err)
+	logger.Errorw(msg, "error", err, "status", status, "failureClass", class, keysAndValues)
+	writeResult("status", status)
+	if status == STATUS_FAILED {
+		writeResult("failureClass", string(class))
+	}
+	endTrace(err)
+
+	err = reportStatus(false, FAILED_TIME_ELAPSED)
 	if err != nil {
 		logger.Fatalf("Failed to report metric %w\n", err)
 	}
-	os.Exit(1)
+	os.Exit(exitCode)
 }
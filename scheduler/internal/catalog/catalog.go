@@ -0,0 +1,244 @@
+// Package catalog lists backups stored in s3-compatible storage by backuper.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+)
+
+// backupInfix separates timestamp of a backup from extension in its key,
+// e.g. mydb/2025-01-01-00-00-00-backup.dump.
+const backupInfix = "-backup"
+
+// DefaultPageSize is used if page size is not set.
+const DefaultPageSize = 50
+
+// MaxPageSize limits number of backups returned at once,
+// as a manifest is read for each of them.
+const MaxPageSize = 1000
+
+// ErrNotFound is returned if there is no backup matching revision.
+var ErrNotFound = errors.New("backup not found")
+
+// An IS3Client provides functionality to read s3-compatible storage.
+//
+// See https://pkg.go.dev/github.com/aws/aws-sdk-go-v2 for more information.
+type IS3Client interface {
+	// ListObjectsV2 returns list of objects in a specified bucket.
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	// GetObject returns content of a specified object.
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// A Backup describes a single backup revision.
+type Backup struct {
+	Key          string    `json:"key"`      // Key in bucket, accepted by restorer as BACKUP_REVISION
+	Revision     string    `json:"revision"` // Timestamp in key, accepted by restorer as BACKUP_REVISION
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	// Fields copied from manifest for convenience.
+	Tags     []string `json:"tags,omitempty"`
+	Pinned   bool     `json:"pinned"`
+	Verified bool     `json:"verified"`
+	// Manifest as written by backuper, nil for backups without manifest.
+	Manifest map[string]any `json:"manifest,omitempty"`
+}
+
+// A Page is a part of list of backups.
+type Page struct {
+	Backups       []Backup `json:"backups"`
+	NextPageToken string   `json:"nextPageToken,omitempty"` // Empty on the last page
+}
+
+// A Catalog lists backups of databases in a bucket.
+type Catalog struct {
+	client     IS3Client
+	bucketName string
+}
+
+// New is a constructor for Catalog of backups in bucketName.
+func New(client IS3Client, bucketName string) Catalog {
+	return Catalog{
+		client:     client,
+		bucketName: bucketName,
+	}
+}
+
+// List returns up to pageSize backups of database, oldest first, following
+// pageToken returned with the previous page. Backups are stored under
+// timestamped keys, so that storage order is creation order.
+// Pre-restore snapshots are skipped, so that a page might be shorter than
+// pageSize even if it is not the last one. Get still returns them.
+func (c Catalog) List(ctx context.Context, database string, pageSize int, pageToken string) (Page, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	pageSize = min(pageSize, MaxPageSize)
+	prefix := ensureTrailingSlash(database)
+	if pageToken != "" && !strings.HasPrefix(pageToken, prefix) {
+		return Page{}, fmt.Errorf("invalid page token %q", pageToken)
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucketName),
+		Prefix: aws.String(prefix),
+	}
+	if pageToken != "" {
+		input.StartAfter = aws.String(pageToken)
+	}
+
+	page := Page{Backups: []Backup{}}
+	manifests := map[string]bool{}
+	paginator := s3.NewListObjectsV2Paginator(c.client, input)
+listing:
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return Page{}, fmt.Errorf("failed to list objects: %v", err)
+		}
+		for _, obj := range output.Contents {
+			key := aws.ToString(obj.Key)
+			if manifest.IsManifestKey(key) {
+				manifests[key] = true
+				continue
+			}
+			// Manifest of the last backup is listed right after it, so it is seen already.
+			if len(page.Backups) == pageSize {
+				page.NextPageToken = page.Backups[pageSize-1].Key
+				break listing
+			}
+			page.Backups = append(page.Backups, Backup{
+				Key:          key,
+				Revision:     revisionOf(prefix, key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	backups := page.Backups[:0]
+	for _, backup := range page.Backups {
+		if manifests[manifest.KeyFor(backup.Key)] {
+			err := c.readManifest(ctx, &backup)
+			if err != nil {
+				return Page{}, err
+			}
+		}
+		if !slices.Contains(backup.Tags, manifest.TagPreRestore) {
+			backups = append(backups, backup)
+		}
+	}
+	page.Backups = backups
+	return page, nil
+}
+
+// Get returns backup of database selected by revision, either a timestamp
+// or a key as returned by List. Keys of backups of other databases are rejected.
+func (c Catalog) Get(ctx context.Context, database, revision string) (Backup, error) {
+	prefix := ensureTrailingSlash(database) + revision + backupInfix
+	if strings.Contains(revision, "/") {
+		if !strings.HasPrefix(revision, ensureTrailingSlash(database)) {
+			return Backup{}, fmt.Errorf("%w: %s is not a backup of %s", ErrNotFound, revision, database)
+		}
+		prefix = revision
+	}
+	output, err := c.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucketName),
+		Prefix: aws.String(prefix),
+	})
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to list objects: %v", err)
+	}
+
+	var backup *Backup
+	hasManifest := false
+	for _, obj := range output.Contents {
+		key := aws.ToString(obj.Key)
+		if backup == nil && !manifest.IsManifestKey(key) {
+			backup = &Backup{
+				Key:          key,
+				Revision:     revisionOf(ensureTrailingSlash(database), key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			}
+		}
+		if backup != nil && key == manifest.KeyFor(backup.Key) {
+			hasManifest = true
+		}
+	}
+	if backup == nil {
+		return Backup{}, fmt.Errorf("%w: %s", ErrNotFound, revision)
+	}
+	if hasManifest {
+		err = c.readManifest(ctx, backup)
+		if err != nil {
+			return Backup{}, err
+		}
+	}
+	return *backup, nil
+}
+
+// readManifest reads manifest of backup and copies its fields to backup.
+func (c Catalog) readManifest(ctx context.Context, backup *Backup) error {
+	key := manifest.KeyFor(backup.Key)
+	output, err := c.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get manifest %s: %v", key, err)
+	}
+	defer output.Body.Close()
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest %s: %v", key, err)
+	}
+
+	var fields struct {
+		Tags     []string `json:"tags"`
+		Pinned   bool     `json:"pinned"`
+		Verified bool     `json:"verified"`
+	}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %v", key, err)
+	}
+	err = json.Unmarshal(data, &backup.Manifest)
+	if err != nil { // coverage-ignore
+		return fmt.Errorf("failed to parse manifest %s: %v", key, err)
+	}
+	backup.Tags = fields.Tags
+	backup.Pinned = fields.Pinned
+	backup.Verified = fields.Verified
+	return nil
+}
+
+// revisionOf returns timestamp of backup stored under key in directory prefix,
+// or empty string if key is not named by backuper.
+func revisionOf(prefix, key string) string {
+	name := strings.TrimPrefix(key, prefix)
+	timestamp, _, found := strings.Cut(name, backupInfix)
+	if !found {
+		return ""
+	}
+	return timestamp
+}
+
+// ensureTrailingSlash adds trailing slash to s if it is not added yet.
+func ensureTrailingSlash(s string) string {
+	if !strings.HasSuffix(s, "/") {
+		s = fmt.Sprint(s, "/")
+	}
+	return s
+}
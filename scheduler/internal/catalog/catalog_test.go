@@ -0,0 +1,178 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/common/manifest"
+)
+
+var modified = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// object returns listed object stored under key.
+func object(key string, size int64) types.Object {
+	return types.Object{Key: aws.String(key), Size: aws.Int64(size), LastModified: aws.Time(modified)}
+}
+
+// mockManifest makes client return data as manifest of backupKey.
+func mockManifest(client *MockS3Client, backupKey, data string) {
+	client.On("GetObject", mock.Anything, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String(manifest.KeyFor(backupKey)),
+	}).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(data))}, nil).Once()
+}
+
+func Test_List(t *testing.T) {
+	client := new(MockS3Client)
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("db/"),
+	}).Return(&s3.ListObjectsV2Output{Contents: []types.Object{
+		object("db/2025-01-01-00-00-00-backup.dump", 100),
+		object("db/2025-01-01-00-00-00-backup.dump.manifest.json", 10),
+		object("db/2025-01-02-00-00-00-backup.sql", 200),
+		object("db/2025-01-03-00-00-00-backup.dump", 300),
+	}}, nil)
+	mockManifest(client, "db/2025-01-01-00-00-00-backup.dump", `{"format": "custom", "tags": ["pre-migration-v42"], "pinned": true, "verified": true}`)
+
+	page, err := New(client, "bucket").List(context.Background(), "db", 2, "")
+	require.NoError(t, err)
+	assert.Equal(t, Page{
+		Backups: []Backup{
+			{
+				Key:          "db/2025-01-01-00-00-00-backup.dump",
+				Revision:     "2025-01-01-00-00-00",
+				Size:         100,
+				LastModified: modified,
+				Tags:         []string{"pre-migration-v42"},
+				Pinned:       true,
+				Verified:     true,
+				Manifest: map[string]any{
+					"format":   "custom",
+					"tags":     []any{"pre-migration-v42"},
+					"pinned":   true,
+					"verified": true,
+				},
+			},
+			{
+				Key:          "db/2025-01-02-00-00-00-backup.sql",
+				Revision:     "2025-01-02-00-00-00",
+				Size:         200,
+				LastModified: modified,
+			},
+		},
+		NextPageToken: "db/2025-01-02-00-00-00-backup.sql",
+	}, page)
+	client.AssertExpectations(t)
+}
+
+func Test_List_NextPage(t *testing.T) {
+	client := new(MockS3Client)
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket:     aws.String("bucket"),
+		Prefix:     aws.String("db/"),
+		StartAfter: aws.String("db/2025-01-02-00-00-00-backup.sql"),
+	}).Return(&s3.ListObjectsV2Output{Contents: []types.Object{
+		object("db/2025-01-03-00-00-00-backup.dump", 300),
+	}}, nil)
+
+	page, err := New(client, "bucket").List(context.Background(), "db", 2, "db/2025-01-02-00-00-00-backup.sql")
+	require.NoError(t, err)
+	require.Len(t, page.Backups, 1)
+	assert.Equal(t, "2025-01-03-00-00-00", page.Backups[0].Revision)
+	assert.Empty(t, page.NextPageToken)
+
+	_, err = New(client, "bucket").List(context.Background(), "db", 2, "other/2025-01-02-00-00-00-backup.sql")
+	assert.ErrorContains(t, err, "invalid page token")
+}
+
+func Test_List_SkipsSnapshots(t *testing.T) {
+	client := new(MockS3Client)
+	client.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []types.Object{
+		object("db/2025-01-01-00-00-00-backup.dump", 100),
+		object("db/2025-01-02-00-00-00-backup.dump", 200),
+		object("db/2025-01-02-00-00-00-backup.dump.manifest.json", 10),
+		object("db/2025-01-03-00-00-00-backup.dump", 300),
+	}}, nil)
+	mockManifest(client, "db/2025-01-02-00-00-00-backup.dump", `{"tags": ["pre-restore"]}`)
+
+	page, err := New(client, "bucket").List(context.Background(), "db", 2, "")
+	require.NoError(t, err)
+	require.Len(t, page.Backups, 1)
+	assert.Equal(t, "db/2025-01-01-00-00-00-backup.dump", page.Backups[0].Key)
+	assert.Equal(t, "db/2025-01-02-00-00-00-backup.dump", page.NextPageToken)
+}
+
+func Test_List_Errors(t *testing.T) {
+	client := new(MockS3Client)
+	client.On("ListObjectsV2", mock.Anything, mock.Anything).
+		Return((*s3.ListObjectsV2Output)(nil), fmt.Errorf("access denied")).Once()
+
+	_, err := New(client, "bucket").List(context.Background(), "db", 0, "")
+	require.ErrorContains(t, err, "failed to list objects: access denied")
+
+	client.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []types.Object{
+		object("db/2025-01-01-00-00-00-backup.dump", 100),
+		object("db/2025-01-01-00-00-00-backup.dump.manifest.json", 10),
+	}}, nil)
+	mockManifest(client, "db/2025-01-01-00-00-00-backup.dump", `{`)
+
+	_, err = New(client, "bucket").List(context.Background(), "db", 0, "")
+	require.ErrorContains(t, err, "failed to parse manifest db/2025-01-01-00-00-00-backup.dump.manifest.json")
+}
+
+func Test_Get(t *testing.T) {
+	client := new(MockS3Client)
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("db/2025-01-01-00-00-00-backup"),
+	}).Return(&s3.ListObjectsV2Output{Contents: []types.Object{
+		object("db/2025-01-01-00-00-00-backup.dump", 100),
+		object("db/2025-01-01-00-00-00-backup.dump.manifest.json", 10),
+	}}, nil)
+	client.On("ListObjectsV2", mock.Anything, &s3.ListObjectsV2Input{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("db/2025-01-02-00-00-00-backup.sql"),
+	}).Return(&s3.ListObjectsV2Output{Contents: []types.Object{
+		object("db/2025-01-02-00-00-00-backup.sql", 200),
+	}}, nil)
+	client.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil)
+	mockManifest(client, "db/2025-01-01-00-00-00-backup.dump", `{"verified": true}`)
+	c := New(client, "bucket")
+
+	backup, err := c.Get(context.Background(), "db", "2025-01-01-00-00-00")
+	require.NoError(t, err)
+	assert.Equal(t, "db/2025-01-01-00-00-00-backup.dump", backup.Key)
+	assert.True(t, backup.Verified)
+
+	backup, err = c.Get(context.Background(), "db", "db/2025-01-02-00-00-00-backup.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01-02-00-00-00", backup.Revision)
+	assert.Nil(t, backup.Manifest)
+
+	_, err = c.Get(context.Background(), "db", "2024-01-01-00-00-00")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func Test_Get_OtherDatabase(t *testing.T) {
+	client := new(MockS3Client)
+	c := New(client, "bucket")
+
+	for _, key := range []string{"other/2025-01-01-00-00-00-backup.dump", "dbx/2025-01-01-00-00-00-backup.dump"} {
+		_, err := c.Get(context.Background(), "db", key)
+		assert.ErrorIs(t, err, ErrNotFound, key)
+		assert.ErrorContains(t, err, "is not a backup of db", key)
+	}
+	client.AssertNotCalled(t, "ListObjectsV2")
+}
@@ -1,14 +1,69 @@
 // Package config stores configuration for scheduler.
 package config
 
-import "github.com/caarlos0/env/v11"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/envgetters"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/server"
+)
 
 // A Config stores configuraton.
 type Config struct {
-	SystemNamespace string `env:"SYSTEM_NAMESPACE,required"` // Namespace of Kubernetes Operator core
-	BackuperVersion string `env:"BACKUPER_VERSION" envDefault:"ashadrinnn/pgbackuper:0.0.1-0"`
-	RestorerVersion string `env:"RESTORER_VERSION" envDefault:"sveb00/pgrestorer:0.0.1-1"`
-	Port            int64  `env:"PORT" envDefault:"50051"` // gRPC port
+	SystemNamespace    string `env:"SYSTEM_NAMESPACE,required"` // Namespace of Kubernetes Operator core
+	BackuperVersion    string `env:"BACKUPER_VERSION" envDefault:"ashadrinnn/pgbackuper:0.0.1-0"`
+	RestorerVersion    string `env:"RESTORER_VERSION" envDefault:"sveb00/pgrestorer:0.0.1-1"`
+	Port               int64  `env:"PORT" envDefault:"50051"`                   // gRPC port
+	MetricsPort        int64  `env:"METRICS_PORT" envDefault:"9090"`            // HTTP port of /metrics, 0 disables metrics
+	JobsServiceAccount string `env:"JOBS_SERVICE_ACCOUNT"`                      // Service account of generated CronJobs and Jobs
+	AllowOverwrite     bool   `env:"RESTORE_ALLOW_OVERWRITE" envDefault:"true"` // Allow restoring onto non-empty databases
+	RestoreMode        string `env:"RESTORE_MODE"`                              // plain, single-transaction or swap
+
+	RestoreTimeout time.Duration `env:"RESTORE_TIMEOUT" envDefault:"0"` // Timeout of restore Jobs, zero disables it
+
+	// Steps restorer runs after backup is applied.
+	PostRestoreOwner          string `env:"POST_RESTORE_OWNER"`
+	PostRestoreGrants         string `env:"POST_RESTORE_GRANTS"` // Semicolon-separated GRANT templates
+	PostRestoreResetSequences bool   `env:"POST_RESTORE_RESET_SEQUENCES" envDefault:"false"`
+	PostRestoreAnalyze        string `env:"POST_RESTORE_ANALYZE"`       // analyze or vacuum-analyze
+	PostRestoreSQLConfigMap   string `env:"POST_RESTORE_SQL_CONFIGMAP"` // ConfigMap with *.sql files run after restore
+
+	// JSON arrays of hooks backuper runs around dump, validated by backuper.
+	PreBackupHooks  string `env:"PRE_BACKUP_HOOKS"`
+	PostBackupHooks string `env:"POST_BACKUP_HOOKS"`
+
+	// Output format, timeouts and isolation of pg_dump run by backuper. Empty values keep defaults.
+	BackupFormat                   string        `env:"BACKUP_FORMAT"` // plain, custom, tar or directory
+	PgDumpLockWaitTimeout          time.Duration `env:"PG_DUMP_LOCK_WAIT_TIMEOUT" envDefault:"0"`
+	PgDumpStatementTimeout         time.Duration `env:"PG_DUMP_STATEMENT_TIMEOUT" envDefault:"0"`
+	PgDumpIdleInTransactionTimeout time.Duration `env:"PG_DUMP_IDLE_IN_TRANSACTION_TIMEOUT" envDefault:"0"`
+	PgDumpSerializableDeferrable   bool          `env:"PG_DUMP_SERIALIZABLE_DEFERRABLE" envDefault:"false"`
+
+	// Hot standbys backups are taken from, as comma-separated primary=standby[:port]
+	// pairs, e.g. "pg-main=pg-replica,pg-billing=pg-billing-replica:5433".
+	StandbyHosts       map[string]string `env:"STANDBY_HOSTS" envKeyValSeparator:"="`
+	StandbyMaxLag      time.Duration     `env:"STANDBY_MAX_LAG" envDefault:"0"` // Zero disables the check
+	StandbyPauseReplay bool              `env:"STANDBY_PAUSE_REPLAY" envDefault:"false"`
+
+	// Prometheus Pushgateway backuper pushes detailed metrics to. Pushing is disabled if empty.
+	PushgatewayURL string `env:"PUSHGATEWAY_URL"`
+	PushgatewayJob string `env:"PUSHGATEWAY_JOB"`
+
+	// Secrets in SYSTEM_NAMESPACE the backup catalog may read storage credentials from,
+	// and TLS and web identity settings of its connections to storage.
+	CatalogS3Secrets              []string `env:"CATALOG_S3_SECRETS"`
+	CatalogS3CAFile               string   `env:"CATALOG_S3_CA_FILE"`
+	CatalogS3InsecureSkipVerify   bool     `env:"CATALOG_S3_INSECURE_SKIP_VERIFY" envDefault:"false"`
+	CatalogS3RoleARN              string   `env:"CATALOG_S3_ROLE_ARN"`
+	CatalogS3WebIdentityTokenFile string   `env:"CATALOG_S3_WEB_IDENTITY_TOKEN_FILE"`
+
+	// OTLP/gRPC endpoint traces of scheduler, backuper and restorer are exported to,
+	// e.g. http://otel-collector:4317. Tracing is disabled if empty.
+	OtlpEndpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
 }
 
 // GetConfig reads environment variables, validates them and return Config object or
@@ -19,5 +74,84 @@ func GetConfig() (Config, error) {
 		return Config{}, err
 	}
 
+	err = cfg.validate()
+	if err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
+
+// validate checks that hooks are well-formed JSON, so that
+// malformed hooks are noticed before backups run.
+func (c Config) validate() error {
+	if c.PreBackupHooks != "" && !json.Valid([]byte(c.PreBackupHooks)) {
+		return fmt.Errorf("PRE_BACKUP_HOOKS must be a JSON array")
+	}
+	if c.PostBackupHooks != "" && !json.Valid([]byte(c.PostBackupHooks)) {
+		return fmt.Errorf("POST_BACKUP_HOOKS must be a JSON array")
+	}
+	return nil
+}
+
+// RestoreOptions returns options passed to every restore Job.
+func (c Config) RestoreOptions() envgetters.RestoreOptionsEnvGetter {
+	return envgetters.RestoreOptionsEnvGetter{
+		AllowOverwrite: c.AllowOverwrite,
+		Mode:           c.RestoreMode,
+		Timeout:        c.RestoreTimeout,
+
+		PostRestoreOwner:          c.PostRestoreOwner,
+		PostRestoreGrants:         c.PostRestoreGrants,
+		PostRestoreResetSequences: c.PostRestoreResetSequences,
+		PostRestoreAnalyze:        c.PostRestoreAnalyze,
+		PostRestoreSQLConfigMap:   c.PostRestoreSQLConfigMap,
+	}
+}
+
+// BackupHooks returns hooks passed to every backup CronJob.
+func (c Config) BackupHooks() envgetters.BackupHooksEnvGetter {
+	return envgetters.BackupHooksEnvGetter{
+		Pre:  c.PreBackupHooks,
+		Post: c.PostBackupHooks,
+	}
+}
+
+// BackupDump returns pg_dump format and options passed to every backup CronJob.
+func (c Config) BackupDump() envgetters.BackupDumpEnvGetter {
+	return envgetters.BackupDumpEnvGetter{
+		Format:                   c.BackupFormat,
+		LockWaitTimeout:          c.PgDumpLockWaitTimeout,
+		StatementTimeout:         c.PgDumpStatementTimeout,
+		IdleInTransactionTimeout: c.PgDumpIdleInTransactionTimeout,
+		SerializableDeferrable:   c.PgDumpSerializableDeferrable,
+	}
+}
+
+// BackupStandby returns standbys passed to backup CronJobs of their primaries.
+func (c Config) BackupStandby() envgetters.BackupStandbyEnvGetter {
+	return envgetters.BackupStandbyEnvGetter{
+		Hosts:       c.StandbyHosts,
+		MaxLag:      c.StandbyMaxLag,
+		PauseReplay: c.StandbyPauseReplay,
+	}
+}
+
+// BackupMetrics returns Pushgateway parameters passed to every backup CronJob.
+func (c Config) BackupMetrics() envgetters.BackupMetricsEnvGetter {
+	return envgetters.BackupMetricsEnvGetter{
+		PushgatewayURL: c.PushgatewayURL,
+		PushgatewayJob: c.PushgatewayJob,
+	}
+}
+
+// Catalog returns options of the backup catalog.
+func (c Config) Catalog() server.CatalogOptions {
+	return server.CatalogOptions{
+		Secrets:              c.CatalogS3Secrets,
+		CAFile:               c.CatalogS3CAFile,
+		InsecureSkipVerify:   c.CatalogS3InsecureSkipVerify,
+		RoleARN:              c.CatalogS3RoleARN,
+		WebIdentityTokenFile: c.CatalogS3WebIdentityTokenFile,
+	}
+}
@@ -3,9 +3,13 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/envgetters"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/server"
 )
 
 func Test_GetConfig_Success(t *testing.T) {
@@ -18,6 +22,18 @@ func Test_GetConfig_Success(t *testing.T) {
 	require.NoError(t, err)
 	err = os.Setenv("PORT", "8080")
 	require.NoError(t, err)
+	err = os.Setenv("JOBS_SERVICE_ACCOUNT", "backup-sa")
+	require.NoError(t, err)
+	err = os.Setenv("RESTORE_ALLOW_OVERWRITE", "false")
+	require.NoError(t, err)
+	err = os.Setenv("RESTORE_MODE", "swap")
+	require.NoError(t, err)
+	err = os.Setenv("RESTORE_TIMEOUT", "1h")
+	require.NoError(t, err)
+	err = os.Setenv("POST_RESTORE_OWNER", "app")
+	require.NoError(t, err)
+	err = os.Setenv("POST_RESTORE_SQL_CONFIGMAP", "post-restore-sql")
+	require.NoError(t, err)
 
 	cfg, err := GetConfig()
 
@@ -26,6 +42,16 @@ func Test_GetConfig_Success(t *testing.T) {
 	assert.Equal(t, "myorg/my-backuper:latest", cfg.BackuperVersion)
 	assert.Equal(t, "myorg/my-restorer:latest", cfg.RestorerVersion)
 	assert.Equal(t, int64(8080), cfg.Port)
+	assert.Equal(t, "backup-sa", cfg.JobsServiceAccount)
+	assert.False(t, cfg.AllowOverwrite)
+	assert.Equal(t, envgetters.RestoreOptionsEnvGetter{
+		AllowOverwrite: false,
+		Mode:           "swap",
+		Timeout:        time.Hour,
+
+		PostRestoreOwner:        "app",
+		PostRestoreSQLConfigMap: "post-restore-sql",
+	}, cfg.RestoreOptions())
 }
 
 func Test_GetConfig_MissingRequiredField(t *testing.T) {
@@ -49,6 +75,9 @@ func Test_GetConfig_UsesDefaults(t *testing.T) {
 	assert.Equal(t, "ashadrinnn/pgbackuper:0.0.1-0", cfg.BackuperVersion)
 	assert.Equal(t, "sveb00/pgrestorer:0.0.1-1", cfg.RestorerVersion)
 	assert.Equal(t, int64(50051), cfg.Port)
+	assert.Equal(t, int64(9090), cfg.MetricsPort)
+	assert.Empty(t, cfg.JobsServiceAccount)
+	assert.True(t, cfg.AllowOverwrite)
 }
 
 func Test_GetConfig_DefaultsWithOverride(t *testing.T) {
@@ -66,3 +95,88 @@ func Test_GetConfig_DefaultsWithOverride(t *testing.T) {
 	assert.Equal(t, "sveb00/pgrestorer:0.0.1-1", cfg.RestorerVersion)
 	assert.Equal(t, int64(9090), cfg.Port)
 }
+
+func Test_GetConfig_BackupHooks(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("SYSTEM_NAMESPACE", "test-system")
+	t.Setenv("PRE_BACKUP_HOOKS", `[{"name": "checkpoint", "sql": "CHECKPOINT"}]`)
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, envgetters.BackupHooksEnvGetter{
+		Pre: `[{"name": "checkpoint", "sql": "CHECKPOINT"}]`,
+	}, cfg.BackupHooks())
+
+	t.Setenv("POST_BACKUP_HOOKS", `[{"name": "notify"`)
+	_, err = GetConfig()
+	require.ErrorContains(t, err, "POST_BACKUP_HOOKS")
+}
+
+func Test_GetConfig_BackupDump(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("SYSTEM_NAMESPACE", "test-system")
+	t.Setenv("PG_DUMP_LOCK_WAIT_TIMEOUT", "30s")
+	t.Setenv("PG_DUMP_SERIALIZABLE_DEFERRABLE", "true")
+	t.Setenv("BACKUP_FORMAT", "plain")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, envgetters.BackupDumpEnvGetter{
+		Format:                 "plain",
+		LockWaitTimeout:        30 * time.Second,
+		SerializableDeferrable: true,
+	}, cfg.BackupDump())
+}
+
+func Test_GetConfig_BackupStandby(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("SYSTEM_NAMESPACE", "test-system")
+	t.Setenv("STANDBY_HOSTS", "pg-main=pg-replica,pg-billing=pg-billing-replica:5433")
+	t.Setenv("STANDBY_MAX_LAG", "5m")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, envgetters.BackupStandbyEnvGetter{
+		Hosts: map[string]string{
+			"pg-main":    "pg-replica",
+			"pg-billing": "pg-billing-replica:5433",
+		},
+		MaxLag: 5 * time.Minute,
+	}, cfg.BackupStandby())
+}
+
+func Test_GetConfig_BackupMetrics(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("SYSTEM_NAMESPACE", "test-system")
+	t.Setenv("PUSHGATEWAY_URL", "http://pushgateway:9091")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, envgetters.BackupMetricsEnvGetter{
+		PushgatewayURL: "http://pushgateway:9091",
+	}, cfg.BackupMetrics())
+}
+
+func Test_GetConfig_Catalog(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("SYSTEM_NAMESPACE", "test-system")
+	t.Setenv("CATALOG_S3_SECRETS", "s3-credentials,s3-replica-credentials")
+	t.Setenv("CATALOG_S3_CA_FILE", "/etc/s3/ca.pem")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, server.CatalogOptions{
+		Secrets: []string{"s3-credentials", "s3-replica-credentials"},
+		CAFile:  "/etc/s3/ca.pem",
+	}, cfg.Catalog())
+}
+
+func Test_GetConfig_Tracing(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("SYSTEM_NAMESPACE", "test-system")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://otel-collector:4317")
+
+	cfg, err := GetConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "http://otel-collector:4317", cfg.OtlpEndpoint)
+}
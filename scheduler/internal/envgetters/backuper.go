@@ -0,0 +1,111 @@
+package envgetters
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// BackupHooksEnvGetter describes hooks backuper runs around dump.
+type BackupHooksEnvGetter struct {
+	Pre  string // JSON array of pre-backup hooks. Not passed if empty.
+	Post string // JSON array of post-backup hooks. Not passed if empty.
+}
+
+func (bhg BackupHooksEnvGetter) GetEnvs() []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	if bhg.Pre != "" {
+		envs = append(envs, corev1.EnvVar{Name: "PRE_BACKUP_HOOKS", Value: bhg.Pre})
+	}
+	if bhg.Post != "" {
+		envs = append(envs, corev1.EnvVar{Name: "POST_BACKUP_HOOKS", Value: bhg.Post})
+	}
+	return envs
+}
+
+// BackupMetricsEnvGetter describes where backuper pushes detailed metrics.
+type BackupMetricsEnvGetter struct {
+	PushgatewayURL string // Metrics are not pushed if empty.
+	PushgatewayJob string // Backuper default is used if empty.
+}
+
+func (bmg BackupMetricsEnvGetter) GetEnvs() []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	if bmg.PushgatewayURL == "" {
+		return envs
+	}
+	envs = append(envs, corev1.EnvVar{Name: "PUSHGATEWAY_URL", Value: bmg.PushgatewayURL})
+	if bmg.PushgatewayJob != "" {
+		envs = append(envs, corev1.EnvVar{Name: "PUSHGATEWAY_JOB", Value: bmg.PushgatewayJob})
+	}
+	return envs
+}
+
+// BackupDumpEnvGetter describes output format, timeouts and isolation of pg_dump run by backuper.
+type BackupDumpEnvGetter struct {
+	Format                   string        // plain, custom, tar or directory. Backuper default is used if empty.
+	LockWaitTimeout          time.Duration // Not passed if zero.
+	StatementTimeout         time.Duration // Not passed if zero.
+	IdleInTransactionTimeout time.Duration // Not passed if zero.
+	SerializableDeferrable   bool
+}
+
+func (bdg BackupDumpEnvGetter) GetEnvs() []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	if bdg.Format != "" {
+		envs = append(envs, corev1.EnvVar{Name: "BACKUP_FORMAT", Value: bdg.Format})
+	}
+	if bdg.LockWaitTimeout > 0 {
+		envs = append(envs, corev1.EnvVar{Name: "PG_DUMP_LOCK_WAIT_TIMEOUT", Value: bdg.LockWaitTimeout.String()})
+	}
+	if bdg.StatementTimeout > 0 {
+		envs = append(envs, corev1.EnvVar{Name: "PG_DUMP_STATEMENT_TIMEOUT", Value: bdg.StatementTimeout.String()})
+	}
+	if bdg.IdleInTransactionTimeout > 0 {
+		envs = append(envs, corev1.EnvVar{Name: "PG_DUMP_IDLE_IN_TRANSACTION_TIMEOUT", Value: bdg.IdleInTransactionTimeout.String()})
+	}
+	if bdg.SerializableDeferrable {
+		envs = append(envs, corev1.EnvVar{Name: "PG_DUMP_SERIALIZABLE_DEFERRABLE", Value: fmt.Sprint(bdg.SerializableDeferrable)})
+	}
+	return envs
+}
+
+// BackupStandbyEnvGetter describes hot standbys backuper takes backups from.
+type BackupStandbyEnvGetter struct {
+	Hosts       map[string]string // Standby host[:port] of each primary host. Nothing is passed if primary has none.
+	MaxLag      time.Duration     // Not passed if zero.
+	PauseReplay bool
+
+	primary string
+}
+
+// For returns copy of bsg passing standby of primary host.
+func (bsg BackupStandbyEnvGetter) For(primary string) BackupStandbyEnvGetter {
+	bsg.primary = primary
+	return bsg
+}
+
+func (bsg BackupStandbyEnvGetter) GetEnvs() []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	standby, ok := bsg.Hosts[bsg.primary]
+	if !ok {
+		return envs
+	}
+	host, port, err := net.SplitHostPort(standby)
+	if err != nil {
+		host, port = standby, ""
+	}
+	envs = append(envs, corev1.EnvVar{Name: "STANDBY_HOST", Value: host})
+	if port != "" {
+		envs = append(envs, corev1.EnvVar{Name: "STANDBY_PORT", Value: port})
+	}
+	if bsg.MaxLag > 0 {
+		envs = append(envs, corev1.EnvVar{Name: "STANDBY_MAX_LAG", Value: bsg.MaxLag.String()})
+	}
+	if bsg.PauseReplay {
+		envs = append(envs, corev1.EnvVar{Name: "STANDBY_PAUSE_REPLAY", Value: fmt.Sprint(bsg.PauseReplay)})
+	}
+	return envs
+}
@@ -0,0 +1,74 @@
+package envgetters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestBackupHooksEnvGetter_GetEnvs(t *testing.T) {
+	assert.Empty(t, BackupHooksEnvGetter{}.GetEnvs())
+
+	bhg := BackupHooksEnvGetter{
+		Pre:  `[{"name": "checkpoint", "sql": "CHECKPOINT"}]`,
+		Post: `[{"name": "notify", "exec": ["true"]}]`,
+	}
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "PRE_BACKUP_HOOKS", Value: bhg.Pre},
+		{Name: "POST_BACKUP_HOOKS", Value: bhg.Post},
+	}, bhg.GetEnvs())
+}
+
+func TestBackupMetricsEnvGetter_GetEnvs(t *testing.T) {
+	assert.Empty(t, BackupMetricsEnvGetter{PushgatewayJob: "backups"}.GetEnvs())
+
+	bmg := BackupMetricsEnvGetter{PushgatewayURL: "http://pushgateway:9091", PushgatewayJob: "backups"}
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "PUSHGATEWAY_URL", Value: "http://pushgateway:9091"},
+		{Name: "PUSHGATEWAY_JOB", Value: "backups"},
+	}, bmg.GetEnvs())
+}
+
+func TestBackupDumpEnvGetter_GetEnvs(t *testing.T) {
+	assert.Empty(t, BackupDumpEnvGetter{}.GetEnvs())
+
+	bdg := BackupDumpEnvGetter{
+		Format:                   "directory",
+		LockWaitTimeout:          30 * time.Second,
+		StatementTimeout:         2 * time.Hour,
+		IdleInTransactionTimeout: 10 * time.Minute,
+		SerializableDeferrable:   true,
+	}
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "BACKUP_FORMAT", Value: "directory"},
+		{Name: "PG_DUMP_LOCK_WAIT_TIMEOUT", Value: "30s"},
+		{Name: "PG_DUMP_STATEMENT_TIMEOUT", Value: "2h0m0s"},
+		{Name: "PG_DUMP_IDLE_IN_TRANSACTION_TIMEOUT", Value: "10m0s"},
+		{Name: "PG_DUMP_SERIALIZABLE_DEFERRABLE", Value: "true"},
+	}, bdg.GetEnvs())
+}
+
+func TestBackupStandbyEnvGetter_GetEnvs(t *testing.T) {
+	bsg := BackupStandbyEnvGetter{
+		Hosts: map[string]string{
+			"pg-main":  "pg-replica:5433",
+			"pg-other": "pg-other-replica",
+		},
+		MaxLag:      5 * time.Minute,
+		PauseReplay: true,
+	}
+	assert.Empty(t, bsg.GetEnvs())
+	assert.Empty(t, bsg.For("pg-unknown").GetEnvs())
+
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "STANDBY_HOST", Value: "pg-replica"},
+		{Name: "STANDBY_PORT", Value: "5433"},
+		{Name: "STANDBY_MAX_LAG", Value: "5m0s"},
+		{Name: "STANDBY_PAUSE_REPLAY", Value: "true"},
+	}, bsg.For("pg-main").GetEnvs())
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "STANDBY_HOST", Value: "pg-other-replica"},
+	}, BackupStandbyEnvGetter{Hosts: bsg.Hosts}.For("pg-other").GetEnvs())
+}
@@ -0,0 +1,3 @@
+// Package envgetters contains adapter specific implementations of
+// base envgetters.EnvGetter that are not part of gRPC API.
+package envgetters
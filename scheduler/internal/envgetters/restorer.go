@@ -0,0 +1,56 @@
+package envgetters
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PostRestoreSQLDir is a directory PostRestoreSQLConfigMap is mounted to in restore Jobs.
+const PostRestoreSQLDir = "/etc/oiler/post-restore"
+
+// RestoreOptionsEnvGetter describes how restorer applies backup to target database.
+type RestoreOptionsEnvGetter struct {
+	AllowOverwrite bool          // Allow restoring onto a database containing user objects.
+	Mode           string        // Restore mode: plain, single-transaction or swap. Restorer default is used if empty.
+	Timeout        time.Duration // Timeout of the whole restore. Zero disables timeout.
+
+	// Steps run after backup is applied. Empty values disable steps.
+	PostRestoreOwner          string // Role restored objects are re-assigned to.
+	PostRestoreGrants         string // Semicolon-separated GRANT templates.
+	PostRestoreResetSequences bool   // Move column sequences past restored values.
+	PostRestoreAnalyze        string // analyze or vacuum-analyze.
+	PostRestoreSQLConfigMap   string // ConfigMap with *.sql files mounted to PostRestoreSQLDir.
+}
+
+func (reg RestoreOptionsEnvGetter) GetEnvs() []corev1.EnvVar {
+	envs := []corev1.EnvVar{
+		{
+			Name:  "ALLOW_OVERWRITE",
+			Value: fmt.Sprint(reg.AllowOverwrite),
+		},
+	}
+	if reg.Mode != "" {
+		envs = append(envs, corev1.EnvVar{Name: "RESTORE_MODE", Value: reg.Mode})
+	}
+	if reg.Timeout > 0 {
+		envs = append(envs, corev1.EnvVar{Name: "RESTORE_TIMEOUT", Value: reg.Timeout.String()})
+	}
+	if reg.PostRestoreOwner != "" {
+		envs = append(envs, corev1.EnvVar{Name: "POST_RESTORE_OWNER", Value: reg.PostRestoreOwner})
+	}
+	if reg.PostRestoreGrants != "" {
+		envs = append(envs, corev1.EnvVar{Name: "POST_RESTORE_GRANTS", Value: reg.PostRestoreGrants})
+	}
+	if reg.PostRestoreResetSequences {
+		envs = append(envs, corev1.EnvVar{Name: "POST_RESTORE_RESET_SEQUENCES", Value: "true"})
+	}
+	if reg.PostRestoreAnalyze != "" {
+		envs = append(envs, corev1.EnvVar{Name: "POST_RESTORE_ANALYZE", Value: reg.PostRestoreAnalyze})
+	}
+	if reg.PostRestoreSQLConfigMap != "" {
+		envs = append(envs, corev1.EnvVar{Name: "POST_RESTORE_SQL_DIR", Value: PostRestoreSQLDir})
+	}
+	return envs
+}
@@ -0,0 +1,88 @@
+package envgetters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreOptionsEnvGetter_GetEnvs(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowOverwrite bool
+		expectedValue  string
+	}{
+		{
+			name:           "Overwrite allowed",
+			allowOverwrite: true,
+			expectedValue:  "true",
+		},
+		{
+			name:           "Overwrite forbidden",
+			allowOverwrite: false,
+			expectedValue:  "false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := RestoreOptionsEnvGetter{
+				AllowOverwrite: tt.allowOverwrite,
+			}
+
+			envs := reg.GetEnvs()
+
+			require.Len(t, envs, 1)
+			assert.Equal(t, "ALLOW_OVERWRITE", envs[0].Name)
+			assert.Equal(t, tt.expectedValue, envs[0].Value)
+		})
+	}
+}
+
+func TestRestoreOptionsEnvGetter_GetEnvs_Mode(t *testing.T) {
+	reg := RestoreOptionsEnvGetter{
+		AllowOverwrite: true,
+		Mode:           "swap",
+	}
+
+	envs := reg.GetEnvs()
+
+	require.Len(t, envs, 2)
+	assert.Equal(t, "RESTORE_MODE", envs[1].Name)
+	assert.Equal(t, "swap", envs[1].Value)
+}
+
+func TestRestoreOptionsEnvGetter_GetEnvs_Timeout(t *testing.T) {
+	reg := RestoreOptionsEnvGetter{
+		Timeout: 90 * time.Minute,
+	}
+
+	envs := reg.GetEnvs()
+
+	require.Len(t, envs, 2)
+	assert.Equal(t, "RESTORE_TIMEOUT", envs[1].Name)
+	assert.Equal(t, "1h30m0s", envs[1].Value)
+}
+
+func TestRestoreOptionsEnvGetter_GetEnvs_PostRestore(t *testing.T) {
+	reg := RestoreOptionsEnvGetter{
+		PostRestoreOwner:          "app",
+		PostRestoreGrants:         "GRANT USAGE ON SCHEMA {{.Schema}} TO app_ro",
+		PostRestoreResetSequences: true,
+		PostRestoreAnalyze:        "analyze",
+		PostRestoreSQLConfigMap:   "post-restore-sql",
+	}
+
+	envs := reg.GetEnvs()
+
+	require.Len(t, envs, 6)
+	assert.Equal(t, "POST_RESTORE_OWNER", envs[1].Name)
+	assert.Equal(t, "app", envs[1].Value)
+	assert.Equal(t, "POST_RESTORE_GRANTS", envs[2].Name)
+	assert.Equal(t, "POST_RESTORE_RESET_SEQUENCES", envs[3].Name)
+	assert.Equal(t, "POST_RESTORE_ANALYZE", envs[4].Name)
+	assert.Equal(t, "POST_RESTORE_SQL_DIR", envs[5].Name)
+	assert.Equal(t, PostRestoreSQLDir, envs[5].Value)
+}
@@ -0,0 +1,28 @@
+package envgetters
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TracingEnvGetter describes where backuper and restorer export traces and
+// the trace their spans belong to.
+type TracingEnvGetter struct {
+	Endpoint    string // OTLP endpoint. Nothing is passed if empty.
+	TraceParent string // W3C traceparent of the span which created the Job.
+	TraceState  string // W3C tracestate, passed along with TraceParent.
+}
+
+func (tg TracingEnvGetter) GetEnvs() []corev1.EnvVar {
+	envs := []corev1.EnvVar{}
+	if tg.Endpoint == "" {
+		return envs
+	}
+	envs = append(envs, corev1.EnvVar{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: tg.Endpoint})
+	if tg.TraceParent != "" {
+		envs = append(envs, corev1.EnvVar{Name: "TRACEPARENT", Value: tg.TraceParent})
+	}
+	if tg.TraceState != "" {
+		envs = append(envs, corev1.EnvVar{Name: "TRACESTATE", Value: tg.TraceState})
+	}
+	return envs
+}
@@ -0,0 +1,21 @@
+package envgetters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTracingEnvGetter_GetEnvs(t *testing.T) {
+	assert.Empty(t, TracingEnvGetter{TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}.GetEnvs())
+
+	tg := TracingEnvGetter{
+		Endpoint:    "http://otel-collector:4317",
+		TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	}
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "OTEL_EXPORTER_OTLP_ENDPOINT", Value: tg.Endpoint},
+		{Name: "TRACEPARENT", Value: tg.TraceParent},
+	}, tg.GetEnvs())
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+)
+
+// Labels set on CronJobs and Jobs created by scheduler, so that they can be watched.
+const (
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	LabelComponent = "app.kubernetes.io/component"
+
+	ManagedBy        = "oiler-postgres-scheduler"
+	ComponentBackup  = "backup"
+	ComponentRestore = "restore"
+)
+
+// A jobsCollector derives metrics from cached CronJobs and Jobs on every scrape.
+type jobsCollector struct {
+	cronJobs batchlisters.CronJobLister
+	jobs     batchlisters.JobLister
+
+	lastSuccess    *prometheus.Desc
+	lastSchedule   *prometheus.Desc
+	activeRestores *prometheus.Desc
+	failedJobs     *prometheus.Desc
+}
+
+// WatchJobs watches CronJobs and Jobs created by scheduler in namespace until
+// stopCh is closed and exposes their state. Returns once caches are synced.
+func (m *Metrics) WatchJobs(client kubernetes.Interface, namespace string, stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = labels.SelectorFromSet(labels.Set{LabelManagedBy: ManagedBy}).String()
+		}),
+	)
+	collector := newJobsCollector(factory.Batch().V1().CronJobs().Lister(), factory.Batch().V1().Jobs().Lister())
+
+	factory.Start(stopCh)
+	for informerType, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return fmt.Errorf("failed to sync cache of %v", informerType)
+		}
+	}
+	return m.registry.Register(collector)
+}
+
+// newJobsCollector is a constructor for jobsCollector.
+func newJobsCollector(cronJobs batchlisters.CronJobLister, jobs batchlisters.JobLister) *jobsCollector {
+	return &jobsCollector{
+		cronJobs: cronJobs,
+		jobs:     jobs,
+		lastSuccess: prometheus.NewDesc(namespace+"_backup_last_success_timestamp_seconds",
+			"Time of the last successful backup Job of a CronJob.", []string{"cronjob"}, nil),
+		lastSchedule: prometheus.NewDesc(namespace+"_backup_last_schedule_timestamp_seconds",
+			"Time a backup Job of a CronJob was last scheduled.", []string{"cronjob"}, nil),
+		activeRestores: prometheus.NewDesc(namespace+"_restores_active",
+			"Number of restore Jobs which have not finished yet.", nil, nil),
+		failedJobs: prometheus.NewDesc(namespace+"_jobs_failed",
+			"Number of existing failed Jobs, by component.", []string{"component"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *jobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lastSuccess
+	ch <- c.lastSchedule
+	ch <- c.activeRestores
+	ch <- c.failedJobs
+}
+
+// Collect implements prometheus.Collector.
+func (c *jobsCollector) Collect(ch chan<- prometheus.Metric) {
+	cronJobs, err := c.cronJobs.List(labels.Everything())
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.lastSuccess, err)
+		return
+	}
+	for _, cj := range cronJobs {
+		if cj.Status.LastSuccessfulTime != nil {
+			ch <- prometheus.MustNewConstMetric(c.lastSuccess, prometheus.GaugeValue,
+				float64(cj.Status.LastSuccessfulTime.Unix()), cj.Name)
+		}
+		if cj.Status.LastScheduleTime != nil {
+			ch <- prometheus.MustNewConstMetric(c.lastSchedule, prometheus.GaugeValue,
+				float64(cj.Status.LastScheduleTime.Unix()), cj.Name)
+		}
+	}
+
+	jobs, err := c.jobs.List(labels.Everything())
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.activeRestores, err)
+		return
+	}
+	activeRestores := 0
+	failed := map[string]int{ComponentBackup: 0, ComponentRestore: 0}
+	for _, job := range jobs {
+		component := job.Labels[LabelComponent]
+		switch {
+		case hasCondition(job, batchv1.JobFailed):
+			failed[component]++
+		case hasCondition(job, batchv1.JobComplete):
+		case component == ComponentRestore:
+			activeRestores++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.activeRestores, prometheus.GaugeValue, float64(activeRestores))
+	for component, count := range failed {
+		ch <- prometheus.MustNewConstMetric(c.failedJobs, prometheus.GaugeValue, float64(count), component)
+	}
+}
+
+// hasCondition reports whether job has condition of conditionType set to true.
+func hasCondition(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+
+	serversbase "github.com/oiler-backup/base/servers/backup"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Operations of JobsCreator reported in Kubernetes API metrics.
+const (
+	OperationCreateJob     = "create_job"
+	OperationCreateCronJob = "create_cronjob"
+	OperationUpdateCronJob = "update_cronjob"
+)
+
+// An instrumentedJobsCreator counts operations of a wrapped JobsCreator.
+type instrumentedJobsCreator struct {
+	next    serversbase.IJobsCreator
+	metrics *Metrics
+}
+
+// InstrumentJobsCreator returns JobsCreator counting operations of next and
+// their failures. Already existing resources are not counted as failures.
+func (m *Metrics) InstrumentJobsCreator(next serversbase.IJobsCreator) serversbase.IJobsCreator {
+	return instrumentedJobsCreator{next: next, metrics: m}
+}
+
+func (jc instrumentedJobsCreator) CreateJob(ctx context.Context, jobSpec *batchv1.Job) (string, string, error) {
+	name, namespace, err := jc.next.CreateJob(ctx, jobSpec)
+	jc.metrics.observeKube(OperationCreateJob, ignoreExists(err))
+	return name, namespace, err
+}
+
+func (jc instrumentedJobsCreator) CreateCronJob(ctx context.Context, cronJobSpec *batchv1.CronJob) (string, string, error) {
+	name, namespace, err := jc.next.CreateCronJob(ctx, cronJobSpec)
+	jc.metrics.observeKube(OperationCreateCronJob, ignoreExists(err))
+	return name, namespace, err
+}
+
+func (jc instrumentedJobsCreator) UpdateCronJob(ctx context.Context, cronJobName, cronJobNamespace string, newEnvs []corev1.EnvVar) error {
+	err := jc.next.UpdateCronJob(ctx, cronJobName, cronJobNamespace, newEnvs)
+	jc.metrics.observeKube(OperationUpdateCronJob, err)
+	return err
+}
+
+// ignoreExists returns nil if err reports already existing resource.
+func ignoreExists(err error) error {
+	if errors.Is(err, serversbase.ErrAlreadyExists) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+// Package metrics exposes Prometheus metrics of scheduler: gRPC requests,
+// Kubernetes API calls and state of backup CronJobs and restore Jobs.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// namespace prefixes names of all metrics.
+const namespace = "oiler_scheduler"
+
+// A Metrics stores collectors of scheduler metrics in its own registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	grpcHandled         *prometheus.CounterVec
+	grpcHandlingSeconds *prometheus.HistogramVec
+	kubeRequests        *prometheus.CounterVec
+	kubeErrors          *prometheus.CounterVec
+}
+
+// New is a constructor for Metrics.
+// Besides scheduler metrics, registry exposes Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		grpcHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_handled_total",
+			Help:      "Number of gRPC requests completed, by method and status code.",
+		}, []string{"grpc_method", "grpc_code"}),
+		grpcHandlingSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_server_handling_seconds",
+			Help:      "Latency of gRPC requests, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"grpc_method"}),
+		kubeRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "kubernetes_requests_total",
+			Help:      "Number of Kubernetes API operations on CronJobs and Jobs, by operation.",
+		}, []string{"operation"}),
+		kubeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "kubernetes_errors_total",
+			Help:      "Number of failed Kubernetes API operations on CronJobs and Jobs, by operation.",
+		}, []string{"operation"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.grpcHandled,
+		m.grpcHandlingSeconds,
+		m.kubeRequests,
+		m.kubeErrors,
+	)
+	return m
+}
+
+// Handler returns HTTP handler serving metrics in Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// UnaryServerInterceptor returns gRPC interceptor counting requests and
+// measuring their latency.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.grpcHandlingSeconds.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		m.grpcHandled.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return resp, err
+	}
+}
+
+// observeKube counts Kubernetes API operation and its failure.
+func (m *Metrics) observeKube(operation string, err error) {
+	m.kubeRequests.WithLabelValues(operation).Inc()
+	if err != nil {
+		m.kubeErrors.WithLabelValues(operation).Inc()
+	}
+}
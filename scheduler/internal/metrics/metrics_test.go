@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	serversbase "github.com/oiler-backup/base/servers/backup"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_UnaryServerInterceptor(t *testing.T) {
+	m := New()
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/backup.BackupService/Backup"}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.Internal, "failed")
+	})
+	require.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcHandled.WithLabelValues(info.FullMethod, "OK")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcHandled.WithLabelValues(info.FullMethod, "Internal")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.grpcHandlingSeconds))
+}
+
+type mockJobsCreator struct {
+	mock.Mock
+}
+
+func (m *mockJobsCreator) CreateJob(ctx context.Context, job *batchv1.Job) (string, string, error) {
+	args := m.Called(ctx, job)
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+func (m *mockJobsCreator) CreateCronJob(ctx context.Context, cj *batchv1.CronJob) (string, string, error) {
+	args := m.Called(ctx, cj)
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+func (m *mockJobsCreator) UpdateCronJob(ctx context.Context, name, namespace string, envs []corev1.EnvVar) error {
+	args := m.Called(ctx, name, namespace, envs)
+	return args.Error(0)
+}
+
+func Test_InstrumentJobsCreator(t *testing.T) {
+	m := New()
+	next := new(mockJobsCreator)
+	next.On("CreateJob", mock.Anything, mock.Anything).Return("job", "default", nil)
+	next.On("CreateCronJob", mock.Anything, mock.Anything).Return("cj", "default", serversbase.ErrAlreadyExists)
+	next.On("UpdateCronJob", mock.Anything, "cj", "default", mock.Anything).Return(errors.New("forbidden"))
+	jc := m.InstrumentJobsCreator(next)
+
+	_, _, err := jc.CreateJob(context.Background(), &batchv1.Job{})
+	require.NoError(t, err)
+	_, _, err = jc.CreateCronJob(context.Background(), &batchv1.CronJob{})
+	require.ErrorIs(t, err, serversbase.ErrAlreadyExists)
+	err = jc.UpdateCronJob(context.Background(), "cj", "default", nil)
+	require.Error(t, err)
+
+	for _, operation := range []string{OperationCreateJob, OperationCreateCronJob, OperationUpdateCronJob} {
+		assert.Equal(t, 1.0, testutil.ToFloat64(m.kubeRequests.WithLabelValues(operation)), operation)
+	}
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.kubeErrors.WithLabelValues(OperationCreateCronJob)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.kubeErrors.WithLabelValues(OperationUpdateCronJob)))
+}
+
+func Test_WatchJobs(t *testing.T) {
+	owned := map[string]string{LabelManagedBy: ManagedBy}
+	lastSuccess := metav1.NewTime(time.Unix(1700000000, 0))
+	client := fake.NewClientset(
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-1", Namespace: "system", Labels: owned},
+			Status:     batchv1.CronJobStatus{LastSuccessfulTime: &lastSuccess, LastScheduleTime: &lastSuccess},
+		},
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "system"},
+			Status:     batchv1.CronJobStatus{LastSuccessfulTime: &lastSuccess},
+		},
+		job("restore-running", ComponentRestore),
+		job("restore-done", ComponentRestore, batchv1.JobComplete),
+		job("backup-failed", ComponentBackup, batchv1.JobFailed),
+	)
+
+	m := New()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	require.NoError(t, m.WatchJobs(client, "system", stopCh))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	assert.Contains(t, body, `oiler_scheduler_backup_last_success_timestamp_seconds{cronjob="backup-1"} 1.7e+09`)
+	assert.NotContains(t, body, `cronjob="foreign"`)
+	assert.Contains(t, body, "oiler_scheduler_restores_active 1\n")
+	assert.Contains(t, body, `oiler_scheduler_jobs_failed{component="backup"} 1`)
+	assert.Contains(t, body, `oiler_scheduler_jobs_failed{component="restore"} 0`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+// job returns Job created by scheduler for component with conditions set to true.
+func job(name, component string, conditions ...batchv1.JobConditionType) *batchv1.Job {
+	j := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "system",
+		Labels:    map[string]string{LabelManagedBy: ManagedBy, LabelComponent: component},
+	}}
+	for _, condition := range conditions {
+		j.Status.Conditions = append(j.Status.Conditions, batchv1.JobCondition{Type: condition, Status: corev1.ConditionTrue})
+	}
+	return j
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/catalog"
+)
+
+// CatalogServiceName is a full name of gRPC service listing backups.
+// Base proto has no messages for it, so requests and responses are
+// google.protobuf.Struct values with fields of ListBackupsRequest,
+// GetBackupRequest, catalog.Page and catalog.Backup.
+const CatalogServiceName = "backup.BackupCatalog"
+
+// Keys of Secret with location and credentials of s3-compatible storage,
+// same as environment variables of backuper and restorer.
+const (
+	secretEndpoint  = "S3_ENDPOINT"
+	secretAccessKey = "S3_ACCESS_KEY"
+	secretSecretKey = "S3_SECRET_KEY"
+	secretRegion    = "S3_REGION"
+)
+
+// CatalogSecretLabel marks Secrets the catalog may read credentials from.
+// A Secret must both carry it with value "true" and be listed in
+// CatalogOptions.Secrets.
+const CatalogSecretLabel = "oiler-backup.io/s3-credentials"
+
+// catalogRoleSessionName names sessions of role assumed with web identity.
+const catalogRoleSessionName = "postgres-scheduler-catalog"
+
+// defaultS3Region is used if request does not set region.
+const defaultS3Region = "us-east-1"
+
+// A StorageRequest locates bucket backups are stored in.
+// Either S3SecretName or S3Endpoint with credentials must be set.
+type StorageRequest struct {
+	S3Endpoint       string `json:"s3Endpoint"`
+	S3AccessKey      string `json:"s3AccessKey"`
+	S3SecretKey      string `json:"s3SecretKey"`
+	S3SecretName     string `json:"s3SecretName"` // Secret in scheduler namespace with S3_ENDPOINT and credentials
+	S3BucketName     string `json:"s3BucketName"`
+	S3Region         string `json:"s3Region"`         // us-east-1 if empty
+	S3ForcePathStyle *bool  `json:"s3ForcePathStyle"` // true if not set
+	Secure           bool   `json:"secure"`           // TLS/SSL Encryption
+}
+
+// A ListBackupsRequest asks for a page of backups of DbName.
+type ListBackupsRequest struct {
+	StorageRequest
+	DbName    string `json:"dbName"`
+	PageSize  int    `json:"pageSize"`  // catalog.DefaultPageSize if zero
+	PageToken string `json:"pageToken"` // NextPageToken of the previous page, empty for the first one
+}
+
+// A GetBackupRequest asks for a single backup of DbName.
+type GetBackupRequest struct {
+	StorageRequest
+	DbName   string `json:"dbName"`
+	Revision string `json:"revision"` // Timestamp or key of the backup
+}
+
+// A CatalogServiceServer is a server of CatalogServiceName.
+type CatalogServiceServer interface {
+	ListBackups(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	GetBackup(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+// catalogServiceDesc describes CatalogServiceName as generated code would.
+var catalogServiceDesc = grpc.ServiceDesc{
+	ServiceName: CatalogServiceName,
+	HandlerType: (*CatalogServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "ListBackups", Handler: catalogHandler("ListBackups", CatalogServiceServer.ListBackups)},
+		{MethodName: "GetBackup", Handler: catalogHandler("GetBackup", CatalogServiceServer.GetBackup)},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// catalogHandler returns handler of unary method of CatalogServiceName
+// passing requests through interceptors.
+func catalogHandler(method string, call func(CatalogServiceServer, context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := new(structpb.Struct)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(CatalogServiceServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + CatalogServiceName + "/" + method,
+		}
+		handler := func(ctx context.Context, req any) (any, error) {
+			return call(srv.(CatalogServiceServer), ctx, req.(*structpb.Struct))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+// An S3ClientFactory creates client of s3-compatible storage.
+type S3ClientFactory func(ctx context.Context, cc s3client.Config) (catalog.IS3Client, error)
+
+// CatalogOptions restrict Secrets of CatalogServer and configure its
+// connections to s3-compatible storage.
+type CatalogOptions struct {
+	// Names of Secrets in scheduler namespace requests may refer to.
+	// Secrets must also carry CatalogSecretLabel.
+	Secrets []string
+
+	CAFile             string // PEM-encoded CA bundle to verify server certificate
+	InsecureSkipVerify bool   // Disables server certificate verification
+
+	// IAM role assumed with web identity if a Secret has no access keys.
+	RoleARN              string
+	WebIdentityTokenFile string
+}
+
+// A CatalogServer lists backups stored in s3-compatible storage,
+// so that core does not need to access it itself.
+type CatalogServer struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	opts       CatalogOptions
+	newClient  S3ClientFactory
+}
+
+// NewCatalogServer is a constructor for CatalogServer.
+// Secrets with credentials allowed by opts are read from namespace with kubeClient.
+func NewCatalogServer(kubeClient kubernetes.Interface, namespace string, opts CatalogOptions) *CatalogServer {
+	return &CatalogServer{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		opts:       opts,
+		newClient: func(ctx context.Context, cc s3client.Config) (catalog.IS3Client, error) { // coverage-ignore
+			return s3client.New(ctx, cc)
+		},
+	}
+}
+
+// RegisterCatalogServer registers server as CatalogServiceName.
+func RegisterCatalogServer(grpcServer *grpc.Server, server CatalogServiceServer) {
+	grpcServer.RegisterService(&catalogServiceDesc, server)
+}
+
+// ListBackups returns a page of backups of a database, oldest first.
+func (s *CatalogServer) ListBackups(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	var req ListBackupsRequest
+	err := fromStruct(in, &req)
+	if err != nil {
+		return nil, err
+	}
+	if req.DbName == "" {
+		return nil, status.Error(codes.InvalidArgument, "dbName is required")
+	}
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "pageSize must not be negative")
+	}
+	c, err := s.catalog(ctx, req.StorageRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := c.List(ctx, req.DbName, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to list backups: %v", err)
+	}
+	return toStruct(page)
+}
+
+// GetBackup returns a single backup of a database with its manifest.
+func (s *CatalogServer) GetBackup(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	var req GetBackupRequest
+	err := fromStruct(in, &req)
+	if err != nil {
+		return nil, err
+	}
+	if req.DbName == "" || req.Revision == "" {
+		return nil, status.Error(codes.InvalidArgument, "dbName and revision are required")
+	}
+	c, err := s.catalog(ctx, req.StorageRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := c.Get(ctx, req.DbName, req.Revision)
+	if errors.Is(err, catalog.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to get backup: %v", err)
+	}
+	return toStruct(backup)
+}
+
+// catalog returns catalog of bucket described by req.
+func (s *CatalogServer) catalog(ctx context.Context, req StorageRequest) (catalog.Catalog, error) {
+	if req.S3BucketName == "" {
+		return catalog.Catalog{}, status.Error(codes.InvalidArgument, "s3BucketName is required")
+	}
+	cc := s3client.Config{
+		Endpoint:           req.S3Endpoint,
+		AccessKey:          req.S3AccessKey,
+		SecretKey:          req.S3SecretKey,
+		Region:             req.S3Region,
+		ForcePathStyle:     req.S3ForcePathStyle == nil || *req.S3ForcePathStyle,
+		CAFile:             s.opts.CAFile,
+		InsecureSkipVerify: s.opts.InsecureSkipVerify,
+		Secure:             req.Secure,
+	}
+	if req.S3SecretName != "" {
+		err := s.fromSecret(ctx, req, &cc)
+		if err != nil {
+			return catalog.Catalog{}, err
+		}
+	} else if req.S3Endpoint == "" || req.S3AccessKey == "" || req.S3SecretKey == "" {
+		return catalog.Catalog{}, status.Error(codes.InvalidArgument, "either s3SecretName or s3Endpoint, s3AccessKey and s3SecretKey are required")
+	}
+	if cc.Region == "" {
+		cc.Region = defaultS3Region
+	}
+
+	client, err := s.newClient(ctx, cc)
+	if err != nil { // coverage-ignore
+		return catalog.Catalog{}, status.Errorf(codes.Internal, "failed to create S3 client: %v", err)
+	}
+	return catalog.New(client, req.S3BucketName), nil
+}
+
+// fromSecret sets endpoint, region and credentials of cc from Secret
+// named in req. Requests may not redirect credentials of a Secret to
+// another endpoint, so they may not set endpoint or keys together with it.
+func (s *CatalogServer) fromSecret(ctx context.Context, req StorageRequest, cc *s3client.Config) error {
+	if req.S3Endpoint != "" || req.S3AccessKey != "" || req.S3SecretKey != "" {
+		return status.Error(codes.InvalidArgument, "s3Endpoint, s3AccessKey and s3SecretKey must not be set together with s3SecretName")
+	}
+	if !slices.Contains(s.opts.Secrets, req.S3SecretName) {
+		return status.Errorf(codes.PermissionDenied, "secret %s is not allowed for catalog", req.S3SecretName)
+	}
+	secret, err := s.kubeClient.CoreV1().Secrets(s.namespace).Get(ctx, req.S3SecretName, metav1.GetOptions{})
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "failed to get secret %s: %v", req.S3SecretName, err)
+	}
+	if secret.Labels[CatalogSecretLabel] != "true" {
+		return status.Errorf(codes.PermissionDenied, "secret %s is not labeled %s=true", req.S3SecretName, CatalogSecretLabel)
+	}
+	cc.Endpoint = string(secret.Data[secretEndpoint])
+	if cc.Endpoint == "" {
+		return status.Errorf(codes.FailedPrecondition, "secret %s has no %s", req.S3SecretName, secretEndpoint)
+	}
+	cc.AccessKey, cc.SecretKey = string(secret.Data[secretAccessKey]), string(secret.Data[secretSecretKey])
+	if region := string(secret.Data[secretRegion]); region != "" {
+		cc.Region = region
+	}
+	if cc.AccessKey == "" {
+		cc.RoleARN = s.opts.RoleARN
+		cc.WebIdentityTokenFile = s.opts.WebIdentityTokenFile
+		cc.RoleSessionName = catalogRoleSessionName
+	}
+	return nil
+}
+
+// fromStruct decodes in to request v.
+func fromStruct(in *structpb.Struct, v any) error {
+	data, err := protojson.Marshal(in)
+	if err != nil { // coverage-ignore
+		return status.Errorf(codes.InvalidArgument, "failed to encode request: %v", err)
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+	return nil
+}
+
+// toStruct encodes response v.
+func toStruct(v any) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil { // coverage-ignore
+		return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	out := new(structpb.Struct)
+	err = protojson.Unmarshal(data, out)
+	if err != nil { // coverage-ignore
+		return nil, status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	return out, nil
+}
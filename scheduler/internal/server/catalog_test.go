@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/oiler-backup/postgres-adapter/common/s3client"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/catalog"
+)
+
+// newTestCatalogServer returns CatalogServer reading backups with client
+// and recording configs of created clients to configs.
+// Secret "s3-credentials" is allowed, "unlabeled" and "other" are not.
+func newTestCatalogServer(client catalog.IS3Client, configs *[]s3client.Config) *CatalogServer {
+	kubeClient := fake.NewClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "s3-credentials",
+				Namespace: "system",
+				Labels:    map[string]string{CatalogSecretLabel: "true"},
+			},
+			Data: map[string][]byte{
+				"S3_ENDPOINT":   []byte("https://s3.internal:9000"),
+				"S3_ACCESS_KEY": []byte("secret-access"),
+				"S3_SECRET_KEY": []byte("secret-secret"),
+				"S3_REGION":     []byte("eu-central-1"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: "system"},
+			Data:       map[string][]byte{"S3_ENDPOINT": []byte("https://s3.internal:9000")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "other",
+				Namespace: "system",
+				Labels:    map[string]string{CatalogSecretLabel: "true"},
+			},
+		},
+	)
+	server := NewCatalogServer(kubeClient, "system", CatalogOptions{
+		Secrets: []string{"s3-credentials", "unlabeled", "missing"},
+		CAFile:  "/etc/s3/ca.pem",
+	})
+	server.newClient = func(ctx context.Context, cc s3client.Config) (catalog.IS3Client, error) {
+		*configs = append(*configs, cc)
+		return client, nil
+	}
+	return server
+}
+
+// dial serves server over in-memory connection and returns client connection to it.
+func dial(t *testing.T, server CatalogServiceServer) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	RegisterCatalogServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(lis) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func Test_ListBackups(t *testing.T) {
+	client := new(catalog.MockS3Client)
+	client.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []types.Object{
+		{Key: aws.String("mydb/2025-01-01-00-00-00-backup.dump"), Size: aws.Int64(100), LastModified: aws.Time(time.Now())},
+		{Key: aws.String("mydb/2025-01-01-00-00-00-backup.dump.manifest.json"), Size: aws.Int64(10), LastModified: aws.Time(time.Now())},
+	}}, nil)
+	client.On("GetObject", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(`{"tags": ["pre-migration-v42"], "verified": true}`)),
+	}, nil)
+	configs := []s3client.Config{}
+	conn := dial(t, newTestCatalogServer(client, &configs))
+
+	req, err := structpb.NewStruct(map[string]any{
+		"s3SecretName": "s3-credentials",
+		"s3BucketName": "bucket",
+		"dbName":       "mydb",
+		"pageSize":     10,
+	})
+	require.NoError(t, err)
+	resp := new(structpb.Struct)
+	err = conn.Invoke(context.Background(), "/backup.BackupCatalog/ListBackups", req, resp)
+	require.NoError(t, err)
+
+	backups := resp.Fields["backups"].GetListValue().GetValues()
+	require.Len(t, backups, 1)
+	backup := backups[0].GetStructValue().AsMap()
+	assert.Equal(t, "2025-01-01-00-00-00", backup["revision"])
+	assert.Equal(t, 100.0, backup["size"])
+	assert.Equal(t, []any{"pre-migration-v42"}, backup["tags"])
+	assert.Equal(t, true, backup["verified"])
+	assert.NotContains(t, resp.Fields, "nextPageToken")
+	require.Len(t, configs, 1)
+	assert.Equal(t, s3client.Config{
+		Endpoint:       "https://s3.internal:9000",
+		AccessKey:      "secret-access",
+		SecretKey:      "secret-secret",
+		Region:         "eu-central-1",
+		ForcePathStyle: true,
+		CAFile:         "/etc/s3/ca.pem",
+	}, configs[0])
+}
+
+func Test_GetBackup(t *testing.T) {
+	client := new(catalog.MockS3Client)
+	client.On("ListObjectsV2", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{}, nil)
+	configs := []s3client.Config{}
+	server := newTestCatalogServer(client, &configs)
+
+	req, err := structpb.NewStruct(map[string]any{
+		"s3Endpoint":       "s3.example.com",
+		"s3AccessKey":      "request-access",
+		"s3SecretKey":      "request-secret",
+		"s3BucketName":     "bucket",
+		"s3ForcePathStyle": false,
+		"dbName":           "mydb",
+		"revision":         "2025-01-01-00-00-00",
+	})
+	require.NoError(t, err)
+	_, err = server.GetBackup(context.Background(), req)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	require.Len(t, configs, 1)
+	assert.Equal(t, s3client.Config{
+		Endpoint:  "s3.example.com",
+		AccessKey: "request-access",
+		SecretKey: "request-secret",
+		Region:    "us-east-1",
+		CAFile:    "/etc/s3/ca.pem",
+	}, configs[0])
+}
+
+func Test_Catalog_InvalidRequests(t *testing.T) {
+	client := new(catalog.MockS3Client)
+	configs := []s3client.Config{}
+	server := newTestCatalogServer(client, &configs)
+
+	for _, tc := range []struct {
+		name   string
+		call   func(context.Context, *structpb.Struct) (*structpb.Struct, error)
+		fields map[string]any
+		code   codes.Code
+	}{
+		{"missing database", server.ListBackups, map[string]any{"s3SecretName": "s3-credentials", "s3BucketName": "bucket"}, codes.InvalidArgument},
+		{"negative page size", server.ListBackups, map[string]any{"dbName": "mydb", "pageSize": -1}, codes.InvalidArgument},
+		{"missing bucket", server.ListBackups, map[string]any{"dbName": "mydb", "s3SecretName": "s3-credentials"}, codes.InvalidArgument},
+		{"wrong type", server.ListBackups, map[string]any{"dbName": 1}, codes.InvalidArgument},
+		{"missing revision", server.GetBackup, map[string]any{"dbName": "mydb", "s3SecretName": "s3-credentials", "s3BucketName": "bucket"}, codes.InvalidArgument},
+		{"missing credentials", server.ListBackups, map[string]any{"dbName": "mydb", "s3Endpoint": "s3", "s3BucketName": "bucket"}, codes.InvalidArgument},
+		{"endpoint with secret", server.ListBackups, map[string]any{"dbName": "mydb", "s3Endpoint": "evil.example.com", "s3BucketName": "bucket", "s3SecretName": "s3-credentials"}, codes.InvalidArgument},
+		{"secret not allowed", server.ListBackups, map[string]any{"dbName": "mydb", "s3BucketName": "bucket", "s3SecretName": "other"}, codes.PermissionDenied},
+		{"secret not labeled", server.ListBackups, map[string]any{"dbName": "mydb", "s3BucketName": "bucket", "s3SecretName": "unlabeled"}, codes.PermissionDenied},
+		{"missing secret", server.GetBackup, map[string]any{"dbName": "mydb", "revision": "r", "s3BucketName": "bucket", "s3SecretName": "missing"}, codes.FailedPrecondition},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := structpb.NewStruct(tc.fields)
+			require.NoError(t, err)
+			_, err = tc.call(context.Background(), req)
+			assert.Equal(t, tc.code, status.Code(err), err)
+		})
+	}
+	assert.Empty(t, configs)
+}
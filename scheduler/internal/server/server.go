@@ -2,19 +2,36 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"google.golang.org/grpc"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	pb "github.com/oiler-backup/base/proto"
 	serversbase "github.com/oiler-backup/base/servers/backup"
 	eg "github.com/oiler-backup/base/servers/backup/envgetters"
+
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/envgetters"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/metrics"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/tracing"
 )
 
+// restoreDeadlineGrace is added to restore timeout to get deadline of restore job.
+const restoreDeadlineGrace = 2 * time.Minute
+
+// postRestoreSQLVolume is a name of volume with post-restore SQL files in restore jobs.
+const postRestoreSQLVolume = "post-restore-sql"
+
 // An ErrBackupServer is required for more verbosity.
 type ErrBackupServer = error
 
@@ -23,18 +40,47 @@ type ErrBackupServer = error
 // and create underlying resources.
 type BackupServer struct {
 	pb.UnimplementedBackupServiceServer
-	kubeClient    *kubernetes.Clientset
+	kubeClient    kubernetes.Interface
 	jobsCreator   serversbase.IJobsCreator
 	namespace     string
 	backuperImage string
 	restorerImage string
 	jobsStub      serversbase.IJobStub
+
+	serviceAccount string
+	restoreOpts    envgetters.RestoreOptionsEnvGetter
+	backupHooks    envgetters.BackupHooksEnvGetter
+	backupDump     envgetters.BackupDumpEnvGetter
+	backupStandby  envgetters.BackupStandbyEnvGetter
+	backupMetrics  envgetters.BackupMetricsEnvGetter
+	otlpEndpoint   string
+}
+
+// An Options configures CronJobs and Jobs created by BackupServer.
+type Options struct {
+	BackuperImage string // Image of backup CronJobs
+	RestorerImage string // Image of restore Jobs
+	// Service account pods run under, e.g. to obtain cloud credentials.
+	// Default service account is used if empty.
+	ServiceAccount string
+
+	Restore       envgetters.RestoreOptionsEnvGetter // Passed to every restore Job
+	BackupHooks   envgetters.BackupHooksEnvGetter    // Passed to every backup CronJob
+	BackupDump    envgetters.BackupDumpEnvGetter     // Passed to every backup CronJob
+	BackupStandby envgetters.BackupStandbyEnvGetter  // Passed to backup CronJobs of databases on primaries having a standby
+	BackupMetrics envgetters.BackupMetricsEnvGetter  // Passed to every backup CronJob
+	Catalog       CatalogOptions                     // Options of CatalogServer registered along
+
+	// If not empty, Kubernetes API calls are traced and CronJobs and Jobs
+	// export their spans to OtlpEndpoint in trace of the request which created them.
+	OtlpEndpoint string
+	// If not nil, Kubernetes API calls and created CronJobs and Jobs are reported to Metrics.
+	Metrics *metrics.Metrics
 }
 
 // NewBackupServer is a constructor for BackupServer.
 // Accepts systemNamespace where underlying resources will be created.
-// backuperImg and restorerImg will be used as images in Kubernetes pods
-func NewBackupServer(systemNamespace, backuperImg, restorerImg string) (*BackupServer, error) { // coverage-ignore
+func NewBackupServer(systemNamespace string, opts Options) (*BackupServer, error) { // coverage-ignore
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load Kubernetes config: %w", err)
@@ -45,29 +91,50 @@ func NewBackupServer(systemNamespace, backuperImg, restorerImg string) (*BackupS
 		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
 	}
 
-	jobsCreator := serversbase.NewJobsCreator(clientset)
+	var jobsCreator serversbase.IJobsCreator = serversbase.NewJobsCreator(clientset)
+	if opts.OtlpEndpoint != "" {
+		jobsCreator = tracing.TraceJobsCreator(jobsCreator)
+	}
+	if opts.Metrics != nil {
+		jobsCreator = opts.Metrics.InstrumentJobsCreator(jobsCreator)
+		err = opts.Metrics.WatchJobs(clientset, systemNamespace, wait.NeverStop)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch jobs: %w", err)
+		}
+	}
 	jobsStub := serversbase.NewJobsStub(
 		"postgres",
 		systemNamespace,
-		backuperImg,
-		restorerImg,
+		opts.BackuperImage,
+		opts.RestorerImage,
 	)
 	return &BackupServer{
 		kubeClient:    clientset,
 		jobsCreator:   jobsCreator,
 		namespace:     systemNamespace,
-		backuperImage: backuperImg,
-		restorerImage: restorerImg,
+		backuperImage: opts.BackuperImage,
+		restorerImage: opts.RestorerImage,
 		jobsStub:      jobsStub,
+
+		serviceAccount: opts.ServiceAccount,
+		restoreOpts:    opts.Restore,
+		backupHooks:    opts.BackupHooks,
+		backupDump:     opts.BackupDump,
+		backupStandby:  opts.BackupStandby,
+		backupMetrics:  opts.BackupMetrics,
+		otlpEndpoint:   opts.OtlpEndpoint,
 	}, nil
 }
 
-func RegisterBackupServer(grpcServer *grpc.Server, systemNamespace, backuperImage, restorerImage string) error { // coverage-ignore
-	server, err := NewBackupServer(systemNamespace, backuperImage, restorerImage)
+// RegisterBackupServer registers BackupServer and CatalogServer
+// sharing its Kubernetes client on grpcServer.
+func RegisterBackupServer(grpcServer *grpc.Server, systemNamespace string, opts Options) error { // coverage-ignore
+	server, err := NewBackupServer(systemNamespace, opts)
 	if err != nil {
 		return err
 	}
 	pb.RegisterBackupServiceServer(grpcServer, server)
+	RegisterCatalogServer(grpcServer, NewCatalogServer(server.kubeClient, systemNamespace, opts.Catalog))
 
 	return nil
 }
@@ -94,8 +161,16 @@ func (s *BackupServer) Backup(ctx context.Context, req *pb.BackupRequest) (*pb.B
 			eg.BackuperEnvGetter{
 				MaxBackupCount: int(req.MaxBackupCount),
 			},
+			s.backupHooks,
+			s.backupDump,
+			s.backupStandby.For(req.DbUri),
+			s.backupMetrics,
+			s.tracingEnv(ctx),
 		}),
 	)
+	s.applyServiceAccount(&cj.Spec.JobTemplate.Spec.Template.Spec)
+	applyLabels(&cj.ObjectMeta, metrics.ComponentBackup)
+	applyLabels(&cj.Spec.JobTemplate.ObjectMeta, metrics.ComponentBackup)
 	name, namespace, err := s.jobsCreator.CreateCronJob(ctx, cj)
 	if errors.Is(err, serversbase.ErrAlreadyExists) {
 		return &pb.BackupResponse{
@@ -117,7 +192,8 @@ func (s *BackupServer) Backup(ctx context.Context, req *pb.BackupRequest) (*pb.B
 }
 
 // Update performs update of a CronJob with backuper.
-// Currently only changes environment variables.
+// Changes environment variables and re-applies labels and service account,
+// so that CronJobs created by older schedulers are updated too.
 func (s *BackupServer) Update(ctx context.Context, req *pb.UpdateBackupRequest) (*pb.BackupResponse, error) {
 	err := s.jobsCreator.UpdateCronJob(
 		ctx,
@@ -139,8 +215,16 @@ func (s *BackupServer) Update(ctx context.Context, req *pb.UpdateBackupRequest)
 			eg.BackuperEnvGetter{
 				MaxBackupCount: int(req.Request.MaxBackupCount),
 			},
+			s.backupHooks,
+			s.backupDump,
+			s.backupStandby.For(req.Request.DbUri),
+			s.backupMetrics,
+			s.tracingEnv(ctx),
 		}).GetEnvs(),
 	)
+	if err == nil {
+		err = s.reapplyCronJobSettings(ctx, req.CronjobName, req.CronjobNamespace)
+	}
 	if err != nil {
 		return &pb.BackupResponse{
 			Status: "Failed to update cronjob",
@@ -173,9 +257,15 @@ func (s *BackupServer) Restore(ctx context.Context, req *pb.BackupRestore) (*pb.
 			eg.RestorerEnvGetter{
 				BackupRevision: req.BackupRevision,
 			},
+			s.restoreOpts,
+			s.tracingEnv(ctx),
 		},
 		),
 	)
+	s.applyServiceAccount(&job.Spec.Template.Spec)
+	applyLabels(&job.ObjectMeta, metrics.ComponentRestore)
+	s.applyRestoreDeadline(job)
+	s.applyPostRestoreSQL(&job.Spec.Template.Spec)
 	name, namespace, err := s.jobsCreator.CreateJob(ctx, job)
 	if errors.Is(err, serversbase.ErrAlreadyExists) {
 		return &pb.BackupRestoreResponse{
@@ -195,3 +285,99 @@ func (s *BackupServer) Restore(ctx context.Context, req *pb.BackupRestore) (*pb.
 		JobNamespace: namespace,
 	}, nil
 }
+
+// tracingEnv returns OTLP endpoint and trace context of ctx passed to
+// CronJobs and Jobs created in ctx.
+func (s *BackupServer) tracingEnv(ctx context.Context) envgetters.TracingEnvGetter {
+	traceParent, traceState := tracing.Inject(ctx)
+	return envgetters.TracingEnvGetter{
+		Endpoint:    s.otlpEndpoint,
+		TraceParent: traceParent,
+		TraceState:  traceState,
+	}
+}
+
+// applyRestoreDeadline limits duration of restore job, so that a hung restorer
+// does not run forever. Restorer is given restoreDeadlineGrace to report
+// timeout to core before it is killed.
+func (s *BackupServer) applyRestoreDeadline(job *batchv1.Job) {
+	if s.restoreOpts.Timeout <= 0 {
+		return
+	}
+	deadline := int64((s.restoreOpts.Timeout + restoreDeadlineGrace).Seconds())
+	job.Spec.ActiveDeadlineSeconds = &deadline
+}
+
+// applyPostRestoreSQL mounts ConfigMap with post-restore SQL files to
+// containers of podSpec, so that restorer runs them after restore.
+func (s *BackupServer) applyPostRestoreSQL(podSpec *corev1.PodSpec) {
+	if s.restoreOpts.PostRestoreSQLConfigMap == "" {
+		return
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: postRestoreSQLVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.restoreOpts.PostRestoreSQLConfigMap},
+			},
+		},
+	})
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      postRestoreSQLVolume,
+			MountPath: envgetters.PostRestoreSQLDir,
+			ReadOnly:  true,
+		})
+	}
+}
+
+// reapplyCronJobSettings patches labels and service account Backup sets into
+// an existing CronJob, as UpdateCronJob of jobsCreator changes only environment variables.
+func (s *BackupServer) reapplyCronJobSettings(ctx context.Context, name, namespace string) error {
+	var cj batchv1.CronJob
+	s.applyServiceAccount(&cj.Spec.JobTemplate.Spec.Template.Spec)
+	applyLabels(&cj.ObjectMeta, metrics.ComponentBackup)
+	applyLabels(&cj.Spec.JobTemplate.ObjectMeta, metrics.ComponentBackup)
+
+	podSpec := map[string]any{}
+	if cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName != "" {
+		podSpec["serviceAccountName"] = cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"labels": cj.Labels},
+		"spec": map[string]any{
+			"jobTemplate": map[string]any{
+				"metadata": map[string]any{"labels": cj.Spec.JobTemplate.Labels},
+				"spec": map[string]any{
+					"template": map[string]any{"spec": podSpec},
+				},
+			},
+		},
+	})
+	if err != nil { // coverage-ignore
+		return fmt.Errorf("failed to encode CronJob patch: %w", err)
+	}
+
+	_, err = s.kubeClient.BatchV1().CronJobs(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch CronJob labels and service account: %w", err)
+	}
+	return nil
+}
+
+// applyLabels marks object as created by scheduler for component,
+// so that it is watched for metrics.
+func applyLabels(meta *metav1.ObjectMeta, component string) {
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	meta.Labels[metrics.LabelManagedBy] = metrics.ManagedBy
+	meta.Labels[metrics.LabelComponent] = component
+}
+
+// applyServiceAccount sets configured service account to podSpec.
+func (s *BackupServer) applyServiceAccount(podSpec *corev1.PodSpec) {
+	if s.serviceAccount != "" {
+		podSpec.ServiceAccountName = s.serviceAccount
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -11,8 +12,16 @@ import (
 
 	pb "github.com/oiler-backup/base/proto"
 	serversbase "github.com/oiler-backup/base/servers/backup"
+	eg "github.com/oiler-backup/base/servers/backup/envgetters"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/envgetters"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func Test_Backup(t *testing.T) {
@@ -134,6 +143,7 @@ func Test_Update(t *testing.T) {
 	mockJobsCreator := new(MockJobsCreator)
 
 	server := &BackupServer{
+		kubeClient:  fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "old-cj", Namespace: "default"}}),
 		jobsCreator: mockJobsCreator,
 		namespace:   "default",
 	}
@@ -181,6 +191,46 @@ func Test_Update(t *testing.T) {
 	mockJobsCreator.AssertExpectations(t)
 }
 
+func Test_Update_ReappliesLabelsAndServiceAccount(t *testing.T) {
+	mockJobsCreator := new(MockJobsCreator)
+	kubeClient := fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+		Name:      "old-cj",
+		Namespace: "default",
+		Labels:    map[string]string{"team": "db"},
+	}})
+	server := &BackupServer{
+		kubeClient:     kubeClient,
+		jobsCreator:    mockJobsCreator,
+		namespace:      "default",
+		serviceAccount: "backup-sa",
+	}
+	mockJobsCreator.On("UpdateCronJob", mock.Anything, mock.Anything, "default", mock.Anything).Return(nil)
+
+	_, err := server.Update(context.Background(), &pb.UpdateBackupRequest{
+		CronjobName:      "old-cj",
+		CronjobNamespace: "default",
+		Request:          &pb.BackupRequest{DbUri: "localhost", DbName: "mydb"},
+	})
+	require.NoError(t, err)
+
+	cj, err := kubeClient.BatchV1().CronJobs("default").Get(context.Background(), "old-cj", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"team":                 "db",
+		metrics.LabelManagedBy: metrics.ManagedBy,
+		metrics.LabelComponent: metrics.ComponentBackup,
+	}, cj.Labels)
+	assert.Equal(t, metrics.ComponentBackup, cj.Spec.JobTemplate.Labels[metrics.LabelComponent])
+	assert.Equal(t, "backup-sa", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+
+	_, err = server.Update(context.Background(), &pb.UpdateBackupRequest{
+		CronjobName:      "missing-cj",
+		CronjobNamespace: "default",
+		Request:          &pb.BackupRequest{},
+	})
+	assert.Error(t, err)
+}
+
 func Test_Update_Error(t *testing.T) {
 	mockJobsCreator := new(MockJobsCreator)
 
@@ -266,6 +316,43 @@ func Test_Restore(t *testing.T) {
 	assert.Equal(t, "default", resp.JobNamespace)
 }
 
+func Test_Restore_TraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:     mockJobsStub,
+		jobsCreator:  mockJobsCreator,
+		namespace:    "default",
+		otlpEndpoint: "http://otel-collector:4317",
+	}
+
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	job := &batchv1.Job{}
+	mockJobsStub.On("BuildRestorerJob", mock.MatchedBy(func(merger eg.EnvGetterMerger) bool {
+		envs := map[string]string{}
+		for _, env := range merger.GetEnvs() {
+			envs[env.Name] = env.Value
+		}
+		return envs["OTEL_EXPORTER_OTLP_ENDPOINT"] == "http://otel-collector:4317" &&
+			envs["TRACEPARENT"] == "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	})).Return(job)
+	mockJobsCreator.On("CreateJob", mock.Anything, job).Return("job-name", "default", nil)
+
+	resp, err := server.Restore(ctx, &pb.BackupRestore{DbUri: "localhost", DbName: "mydb", BackupRevision: "0"})
+	require.NoError(t, err)
+	assert.Equal(t, "Job created successfully", resp.Status)
+	mockJobsStub.AssertExpectations(t)
+}
+
 func Test_Restore_AlreadyExists(t *testing.T) {
 	mockJobsStub := new(MockJobsStub)
 	mockJobsCreator := new(MockJobsCreator)
@@ -333,3 +420,303 @@ func Test_Restore_Job_CreationError(t *testing.T) {
 	assert.Empty(t, resp.JobName)
 	assert.Empty(t, resp.JobNamespace)
 }
+
+func Test_Backup_ServiceAccount(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:       mockJobsStub,
+		jobsCreator:    mockJobsCreator,
+		namespace:      "default",
+		serviceAccount: "backup-sa",
+	}
+
+	req := &pb.BackupRequest{
+		Schedule:     "0 0 * * *",
+		DbUri:        "localhost",
+		DbPort:       5432,
+		DbName:       "mydb",
+		S3Endpoint:   "s3.example.com",
+		S3BucketName: "bucket",
+	}
+
+	cj := &batchv1.CronJob{}
+	mockJobsStub.On("BuildBackuperCj", req.Schedule, mock.AnythingOfType("envgetters.EnvGetterMerger")).Return(cj)
+	mockJobsCreator.On("CreateCronJob", mock.Anything, cj).Return("cj-name", "default", nil)
+
+	_, err := server.Backup(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "backup-sa", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+}
+
+func Test_Restore_ServiceAccount(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:       mockJobsStub,
+		jobsCreator:    mockJobsCreator,
+		namespace:      "default",
+		serviceAccount: "backup-sa",
+	}
+
+	req := &pb.BackupRestore{
+		DbUri:          "localhost",
+		DbPort:         5432,
+		DbName:         "mydb",
+		S3Endpoint:     "s3.example.com",
+		S3BucketName:   "bucket",
+		BackupRevision: "revision",
+	}
+
+	job := &batchv1.Job{}
+	mockJobsStub.On("BuildRestorerJob", mock.AnythingOfType("envgetters.EnvGetterMerger")).Return(job)
+	mockJobsCreator.On("CreateJob", mock.Anything, job).Return("job-name", "default", nil)
+
+	_, err := server.Restore(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "backup-sa", job.Spec.Template.Spec.ServiceAccountName)
+}
+
+func Test_Restore_AllowOverwrite(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:    mockJobsStub,
+		jobsCreator: mockJobsCreator,
+		namespace:   "default",
+		restoreOpts: envgetters.RestoreOptionsEnvGetter{AllowOverwrite: true},
+	}
+
+	req := &pb.BackupRestore{
+		DbUri:          "localhost",
+		DbPort:         5432,
+		DbName:         "mydb",
+		S3Endpoint:     "s3.example.com",
+		S3BucketName:   "bucket",
+		BackupRevision: "revision",
+	}
+
+	job := &batchv1.Job{}
+	mockJobsStub.On("BuildRestorerJob", mock.MatchedBy(func(merger eg.EnvGetterMerger) bool {
+		for _, env := range merger.GetEnvs() {
+			if env.Name == "ALLOW_OVERWRITE" {
+				return env.Value == "true"
+			}
+		}
+		return false
+	})).Return(job)
+	mockJobsCreator.On("CreateJob", mock.Anything, job).Return("job-name", "default", nil)
+
+	resp, err := server.Restore(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "Job created successfully", resp.Status)
+	mockJobsStub.AssertExpectations(t)
+}
+
+func Test_Restore_Deadline(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:    mockJobsStub,
+		jobsCreator: mockJobsCreator,
+		namespace:   "default",
+		restoreOpts: envgetters.RestoreOptionsEnvGetter{Timeout: time.Hour},
+	}
+
+	req := &pb.BackupRestore{
+		DbUri:          "localhost",
+		DbPort:         5432,
+		DbName:         "mydb",
+		S3Endpoint:     "s3.example.com",
+		S3BucketName:   "bucket",
+		BackupRevision: "revision",
+	}
+
+	job := &batchv1.Job{}
+	mockJobsStub.On("BuildRestorerJob", mock.AnythingOfType("envgetters.EnvGetterMerger")).Return(job)
+	mockJobsCreator.On("CreateJob", mock.Anything, job).Return("job-name", "default", nil)
+
+	_, err := server.Restore(context.Background(), req)
+	require.NoError(t, err)
+	require.NotNil(t, job.Spec.ActiveDeadlineSeconds)
+	assert.Equal(t, int64(3720), *job.Spec.ActiveDeadlineSeconds)
+}
+
+func Test_Backup_Hooks(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:    mockJobsStub,
+		jobsCreator: mockJobsCreator,
+		namespace:   "default",
+		backupHooks: envgetters.BackupHooksEnvGetter{Pre: `[{"name": "checkpoint", "sql": "CHECKPOINT"}]`},
+	}
+
+	req := &pb.BackupRequest{
+		Schedule:     "0 0 * * *",
+		DbUri:        "localhost",
+		DbPort:       5432,
+		DbName:       "mydb",
+		S3Endpoint:   "s3.example.com",
+		S3BucketName: "bucket",
+	}
+
+	cj := &batchv1.CronJob{}
+	mockJobsStub.On("BuildBackuperCj", req.Schedule, mock.MatchedBy(func(merger eg.EnvGetterMerger) bool {
+		for _, env := range merger.GetEnvs() {
+			if env.Name == "PRE_BACKUP_HOOKS" {
+				return env.Value == server.backupHooks.Pre
+			}
+		}
+		return false
+	})).Return(cj)
+	mockJobsCreator.On("CreateCronJob", mock.Anything, cj).Return("cj-name", "default", nil)
+
+	resp, err := server.Backup(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "CronJob created successfully", resp.Status)
+	mockJobsStub.AssertExpectations(t)
+}
+
+func Test_Backup_Metrics(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:      mockJobsStub,
+		jobsCreator:   mockJobsCreator,
+		namespace:     "default",
+		backupMetrics: envgetters.BackupMetricsEnvGetter{PushgatewayURL: "http://pushgateway:9091"},
+	}
+
+	req := &pb.BackupRequest{
+		Schedule:     "0 0 * * *",
+		DbUri:        "localhost",
+		DbPort:       5432,
+		DbName:       "mydb",
+		S3Endpoint:   "s3.example.com",
+		S3BucketName: "bucket",
+	}
+
+	cj := &batchv1.CronJob{}
+	mockJobsStub.On("BuildBackuperCj", req.Schedule, mock.MatchedBy(func(merger eg.EnvGetterMerger) bool {
+		for _, env := range merger.GetEnvs() {
+			if env.Name == "PUSHGATEWAY_URL" {
+				return env.Value == server.backupMetrics.PushgatewayURL
+			}
+		}
+		return false
+	})).Return(cj)
+	mockJobsCreator.On("CreateCronJob", mock.Anything, cj).Return("cj-name", "default", nil)
+
+	resp, err := server.Backup(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "CronJob created successfully", resp.Status)
+	mockJobsStub.AssertExpectations(t)
+}
+
+func Test_Backup_Standby(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:      mockJobsStub,
+		jobsCreator:   mockJobsCreator,
+		namespace:     "default",
+		backupStandby: envgetters.BackupStandbyEnvGetter{Hosts: map[string]string{"pg-main": "pg-replica"}},
+	}
+
+	req := &pb.BackupRequest{
+		Schedule:     "0 0 * * *",
+		DbUri:        "pg-main",
+		DbPort:       5432,
+		DbName:       "mydb",
+		S3Endpoint:   "s3.example.com",
+		S3BucketName: "bucket",
+	}
+
+	cj := &batchv1.CronJob{}
+	mockJobsStub.On("BuildBackuperCj", req.Schedule, mock.MatchedBy(func(merger eg.EnvGetterMerger) bool {
+		for _, env := range merger.GetEnvs() {
+			if env.Name == "STANDBY_HOST" {
+				return env.Value == "pg-replica"
+			}
+		}
+		return false
+	})).Return(cj)
+	mockJobsCreator.On("CreateCronJob", mock.Anything, cj).Return("cj-name", "default", nil)
+
+	resp, err := server.Backup(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "CronJob created successfully", resp.Status)
+	mockJobsStub.AssertExpectations(t)
+}
+
+func Test_Restore_PostRestoreSQL(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:    mockJobsStub,
+		jobsCreator: mockJobsCreator,
+		namespace:   "default",
+		restoreOpts: envgetters.RestoreOptionsEnvGetter{PostRestoreSQLConfigMap: "post-restore-sql"},
+	}
+
+	req := &pb.BackupRestore{
+		DbUri:          "localhost",
+		DbPort:         5432,
+		DbName:         "mydb",
+		S3Endpoint:     "s3.example.com",
+		S3BucketName:   "bucket",
+		BackupRevision: "revision",
+	}
+
+	job := &batchv1.Job{}
+	job.Spec.Template.Spec.Containers = []corev1.Container{{Name: "restorer"}}
+	mockJobsStub.On("BuildRestorerJob", mock.AnythingOfType("envgetters.EnvGetterMerger")).Return(job)
+	mockJobsCreator.On("CreateJob", mock.Anything, job).Return("job-name", "default", nil)
+
+	_, err := server.Restore(context.Background(), req)
+	require.NoError(t, err)
+	podSpec := job.Spec.Template.Spec
+	require.Len(t, podSpec.Volumes, 1)
+	assert.Equal(t, "post-restore-sql", podSpec.Volumes[0].ConfigMap.Name)
+	require.Len(t, podSpec.Containers[0].VolumeMounts, 1)
+	assert.Equal(t, envgetters.PostRestoreSQLDir, podSpec.Containers[0].VolumeMounts[0].MountPath)
+}
+
+func Test_Backup_Labels(t *testing.T) {
+	mockJobsStub := new(MockJobsStub)
+	mockJobsCreator := new(MockJobsCreator)
+
+	server := &BackupServer{
+		jobsStub:    mockJobsStub,
+		jobsCreator: mockJobsCreator,
+		namespace:   "default",
+	}
+
+	req := &pb.BackupRequest{
+		Schedule:     "0 0 * * *",
+		DbUri:        "localhost",
+		DbPort:       5432,
+		DbName:       "mydb",
+		S3Endpoint:   "s3.example.com",
+		S3BucketName: "bucket",
+	}
+
+	cj := &batchv1.CronJob{}
+	mockJobsStub.On("BuildBackuperCj", req.Schedule, mock.AnythingOfType("envgetters.EnvGetterMerger")).Return(cj)
+	mockJobsCreator.On("CreateCronJob", mock.Anything, cj).Return("cj-name", "default", nil)
+
+	_, err := server.Backup(context.Background(), req)
+	require.NoError(t, err)
+	expected := map[string]string{metrics.LabelManagedBy: metrics.ManagedBy, metrics.LabelComponent: metrics.ComponentBackup}
+	assert.Equal(t, expected, cj.Labels)
+	assert.Equal(t, expected, cj.Spec.JobTemplate.Labels)
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+
+	serversbase "github.com/oiler-backup/base/servers/backup"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// A tracedJobsCreator starts a span for every operation of a wrapped JobsCreator.
+type tracedJobsCreator struct {
+	next serversbase.IJobsCreator
+}
+
+// TraceJobsCreator returns JobsCreator tracing Kubernetes API calls of next.
+func TraceJobsCreator(next serversbase.IJobsCreator) serversbase.IJobsCreator {
+	return tracedJobsCreator{next: next}
+}
+
+func (jc tracedJobsCreator) CreateJob(ctx context.Context, jobSpec *batchv1.Job) (string, string, error) {
+	ctx, span := tracer().Start(ctx, "kubernetes.CreateJob", trace.WithSpanKind(trace.SpanKindClient))
+	name, namespace, err := jc.next.CreateJob(ctx, jobSpec)
+	span.SetAttributes(attribute.String("k8s.job.name", name), attribute.String("k8s.namespace.name", namespace))
+	end(span, err)
+	return name, namespace, err
+}
+
+func (jc tracedJobsCreator) CreateCronJob(ctx context.Context, cronJobSpec *batchv1.CronJob) (string, string, error) {
+	ctx, span := tracer().Start(ctx, "kubernetes.CreateCronJob", trace.WithSpanKind(trace.SpanKindClient))
+	name, namespace, err := jc.next.CreateCronJob(ctx, cronJobSpec)
+	span.SetAttributes(attribute.String("k8s.cronjob.name", name), attribute.String("k8s.namespace.name", namespace))
+	end(span, err)
+	return name, namespace, err
+}
+
+func (jc tracedJobsCreator) UpdateCronJob(ctx context.Context, cronJobName, cronJobNamespace string, newEnvs []corev1.EnvVar) error {
+	ctx, span := tracer().Start(ctx, "kubernetes.UpdateCronJob",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("k8s.cronjob.name", cronJobName), attribute.String("k8s.namespace.name", cronJobNamespace)),
+	)
+	err := jc.next.UpdateCronJob(ctx, cronJobName, cronJobNamespace, newEnvs)
+	end(span, err)
+	return err
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+// recordSpans installs tracer provider recording ended spans for the duration of t.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func Test_Setup_Disabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func Test_UnaryServerInterceptor(t *testing.T) {
+	recorder := recordSpans(t)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceParent))
+
+	var handlerParent string
+	_, err := UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/BackupService/Restore"},
+		func(ctx context.Context, req any) (any, error) {
+			handlerParent, _ = Inject(ctx)
+			return nil, errors.New("failed")
+		})
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "/BackupService/Restore", spans[0].Name())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Contains(t, handlerParent, spans[0].SpanContext().SpanID().String())
+}
+
+func Test_Inject_NoSpan(t *testing.T) {
+	recordSpans(t)
+	traceParent, traceState := Inject(context.Background())
+	assert.Empty(t, traceParent)
+	assert.Empty(t, traceState)
+}
+
+func Test_TraceJobsCreator(t *testing.T) {
+	recorder := recordSpans(t)
+	next := new(mockJobsCreator)
+	job := &batchv1.Job{}
+	next.On("CreateJob", mock.Anything, job).Return("restore", "default", nil)
+	next.On("UpdateCronJob", mock.Anything, "backup", "default", []corev1.EnvVar(nil)).Return(errors.New("not found"))
+
+	jc := TraceJobsCreator(next)
+	_, _, err := jc.CreateJob(context.Background(), job)
+	require.NoError(t, err)
+	err = jc.UpdateCronJob(context.Background(), "backup", "default", nil)
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "kubernetes.CreateJob", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "kubernetes.UpdateCronJob", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+type mockJobsCreator struct {
+	mock.Mock
+}
+
+func (m *mockJobsCreator) CreateJob(ctx context.Context, job *batchv1.Job) (string, string, error) {
+	args := m.Called(ctx, job)
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+func (m *mockJobsCreator) CreateCronJob(ctx context.Context, cj *batchv1.CronJob) (string, string, error) {
+	args := m.Called(ctx, cj)
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+func (m *mockJobsCreator) UpdateCronJob(ctx context.Context, name, namespace string, envs []corev1.EnvVar) error {
+	args := m.Called(ctx, name, namespace, envs)
+	return args.Error(0)
+}
@@ -3,13 +3,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/http"
 
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 
 	"github.com/oiler-backup/postgres-adapter/scheduler/internal/config"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/metrics"
 	"github.com/oiler-backup/postgres-adapter/scheduler/internal/server"
+	"github.com/oiler-backup/postgres-adapter/scheduler/internal/tracing"
 
 	loggerbase "github.com/oiler-backup/base/logger"
 )
@@ -30,9 +35,42 @@ func main() {
 		logger.Panicw("Failed to listen port", "error", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.OtlpEndpoint)
+	if err != nil {
+		logger.Panicw("Failed to set up tracing", "error", err)
+	}
+	defer func() {
+		err := shutdownTracing(context.Background())
+		if err != nil {
+			logger.Errorw("Failed to flush traces", "error", err)
+		}
+	}()
+
+	var m *metrics.Metrics
+	interceptors := []grpc.UnaryServerInterceptor{}
+	if cfg.OtlpEndpoint != "" {
+		interceptors = append(interceptors, tracing.UnaryServerInterceptor())
+	}
+	if cfg.MetricsPort != 0 {
+		m = metrics.New()
+		interceptors = append(interceptors, m.UnaryServerInterceptor())
+		go serveMetrics(logger, m, cfg.MetricsPort)
+	}
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
 
-	err = server.RegisterBackupServer(grpcServer, cfg.SystemNamespace, cfg.BackuperVersion, cfg.RestorerVersion)
+	err = server.RegisterBackupServer(grpcServer, cfg.SystemNamespace, server.Options{
+		BackuperImage:  cfg.BackuperVersion,
+		RestorerImage:  cfg.RestorerVersion,
+		ServiceAccount: cfg.JobsServiceAccount,
+		Restore:        cfg.RestoreOptions(),
+		BackupHooks:    cfg.BackupHooks(),
+		BackupDump:     cfg.BackupDump(),
+		BackupStandby:  cfg.BackupStandby(),
+		BackupMetrics:  cfg.BackupMetrics(),
+		Catalog:        cfg.Catalog(),
+		OtlpEndpoint:   cfg.OtlpEndpoint,
+		Metrics:        m,
+	})
 	if err != nil {
 		logger.Panicw("Failed to register backup server", "error", err)
 	}
@@ -41,3 +79,14 @@ func main() {
 		logger.Fatalw("Failed running server", "error", err)
 	}
 }
+
+// serveMetrics serves metrics over HTTP on /metrics.
+func serveMetrics(logger *zap.SugaredLogger, m *metrics.Metrics, port int64) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	logger.Infof("Serving metrics on port %d...", port)
+	err := http.ListenAndServe(fmt.Sprint(":", port), mux)
+	if err != nil {
+		logger.Fatalw("Failed serving metrics", "error", err)
+	}
+}